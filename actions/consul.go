@@ -0,0 +1,239 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker-flow/docker-flow-proxy/proxy"
+)
+
+const consulTagPrefix = "dfp."
+const consulMetaPrefix = "dfp_"
+
+// consulAddressesParam is the internal parameter used to pass instance addresses to consulParameterProvider.
+// It is not a reconfigure parameter and it is never passed to the proxy.
+const consulAddressesParam = "consul.addresses"
+
+type consulCatalogService struct {
+	ID             string            `json:"ID"`
+	Node           string            `json:"Node"`
+	Address        string            `json:"Address"`
+	ServiceID      string            `json:"ServiceID"`
+	ServiceName    string            `json:"ServiceName"`
+	ServiceAddress string            `json:"ServiceAddress"`
+	ServicePort    int               `json:"ServicePort"`
+	ServiceTags    []string          `json:"ServiceTags"`
+	ServiceMeta    map[string]string `json:"ServiceMeta"`
+}
+
+// consulParameterProvider translates parameters extracted from Consul catalog entries into proxy.Service.
+// Instance addresses registered in the catalog are used as the service tasks.
+type consulParameterProvider struct {
+	params map[string]string
+	tasks  []string
+}
+
+func newConsulParameterProvider(params map[string]string) proxy.ServiceParameterProvider {
+	p := consulParameterProvider{params: map[string]string{}}
+	for key, value := range params {
+		if key == consulAddressesParam {
+			if len(value) > 0 {
+				p.tasks = strings.Split(value, ",")
+			}
+			continue
+		}
+		p.params[key] = value
+	}
+	return &p
+}
+
+// Fill converts Consul parameters into proxy.Service struct
+func (p *consulParameterProvider) Fill(service *proxy.Service) {
+	proxy.NewMapParameterProvider(&p.params).Fill(service)
+	service.Tasks = p.tasks
+}
+
+// GetString returns parameter value
+func (p *consulParameterProvider) GetString(name string) string {
+	return p.params[name]
+}
+
+// Consul watches the Consul catalog with blocking queries and reconfigures the proxy whenever it changes.
+// Only services with at least one `dfp.` tag (e.g. `dfp.servicePath=/api` or `dfp.enable`) are used.
+// Meta keys prefixed with `dfp_` (e.g. `dfp_servicePath`) are used as parameters of those services as well.
+type Consul struct {
+	BaseReconfigure
+	// The address of the Consul HTTP API (e.g. http://consul:8500).
+	Address string
+	// The datacenter to query. The datacenter of the agent is used if empty.
+	Datacenter string
+	// ACL token sent with each request.
+	Token string
+	// The maximum duration of a blocking query.
+	WaitTime time.Duration
+	// The pause between two attempts to contact Consul after a failure.
+	RetryInterval time.Duration
+	client        *http.Client
+	sync          *serviceSync
+}
+
+// NewConsul returns a Consul discovery provider configured through environment variables
+var NewConsul = func(baseData BaseReconfigure, address string) Discoverer {
+	if !strings.HasPrefix(address, "http://") && !strings.HasPrefix(address, "https://") {
+		address = "http://" + address
+	}
+	return &Consul{
+		BaseReconfigure: baseData,
+		Address:         strings.TrimRight(address, "/"),
+		Datacenter:      os.Getenv("CONSUL_DATACENTER"),
+		Token:           os.Getenv("CONSUL_TOKEN"),
+		WaitTime:        5 * time.Minute,
+		RetryInterval:   getRetryInterval(),
+		client:          &http.Client{},
+	}
+}
+
+// Run watches the Consul catalog until the stop channel is closed.
+// Connection problems are logged and retried.
+func (m *Consul) Run(stop <-chan struct{}) error {
+	if len(m.Address) == 0 {
+		return fmt.Errorf("Consul address is missing")
+	}
+	if m.sync == nil {
+		m.sync = newServiceSync(m.BaseReconfigure)
+		m.sync.newProvider = newConsulParameterProvider
+	}
+	watchRegistry(stop, "Consul catalog", m.RetryInterval, func(ctx context.Context) error {
+		// The catalog is fetched without blocking after each failure
+		index := "0"
+		for {
+			newIndex, err := m.syncCatalog(ctx, index)
+			if err != nil {
+				return err
+			}
+			index = newIndex
+		}
+	})
+	return nil
+}
+
+// syncCatalog waits until the catalog changes after the index and synchronizes the proxy with it.
+// It returns the index that should be used with the next blocking query.
+func (m *Consul) syncCatalog(ctx context.Context, index string) (string, error) {
+	services := map[string][]string{}
+	newIndex, err := m.get(ctx, "/v1/catalog/services", index, &services)
+	if err != nil {
+		return "", err
+	}
+	if newIndex == index {
+		return newIndex, nil
+	}
+	objects := map[string][]map[string]string{}
+	for name, tags := range services {
+		if !m.hasDfpTag(tags) {
+			continue
+		}
+		instances := []consulCatalogService{}
+		if _, err := m.get(ctx, "/v1/catalog/service/"+url.PathEscape(name), "", &instances); err != nil {
+			return "", err
+		}
+		if params := m.getParams(name, instances); params != nil {
+			objects[name] = []map[string]string{params}
+		}
+	}
+	if m.sync.replace(objects) {
+		m.sync.reload()
+	}
+	return newIndex, nil
+}
+
+func (m *Consul) get(ctx context.Context, path, index string, value interface{}) (string, error) {
+	query := url.Values{}
+	if len(index) > 0 {
+		query.Set("index", index)
+		query.Set("wait", fmt.Sprintf("%ds", int(m.WaitTime/time.Second)))
+	}
+	if len(m.Datacenter) > 0 {
+		query.Set("dc", m.Datacenter)
+	}
+	addr := m.Address + path
+	if len(query) > 0 {
+		addr += "?" + query.Encode()
+	}
+	header := http.Header{}
+	if len(m.Token) > 0 {
+		header.Set("X-Consul-Token", m.Token)
+	}
+	resp, err := getFromRegistry(ctx, m.client, addr, header, "Consul")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(value); err != nil {
+		return "", err
+	}
+	return resp.Header.Get("X-Consul-Index"), nil
+}
+
+func (m *Consul) hasDfpTag(tags []string) bool {
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, consulTagPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// getParams translates catalog instances of a service into reconfigure parameters.
+// It returns nil if the service has no instances.
+func (m *Consul) getParams(name string, instances []consulCatalogService) map[string]string {
+	if len(instances) == 0 {
+		return nil
+	}
+	params := map[string]string{}
+	for _, instance := range instances {
+		for key, value := range instance.ServiceMeta {
+			if strings.HasPrefix(key, consulMetaPrefix) {
+				params[strings.TrimPrefix(key, consulMetaPrefix)] = value
+			}
+		}
+		for _, tag := range instance.ServiceTags {
+			if !strings.HasPrefix(tag, consulTagPrefix) {
+				continue
+			}
+			keyValue := strings.SplitN(strings.TrimPrefix(tag, consulTagPrefix), "=", 2)
+			if len(keyValue) == 2 {
+				params[keyValue[0]] = keyValue[1]
+			} else {
+				params[keyValue[0]] = "true"
+			}
+		}
+	}
+	if len(params["serviceName"]) == 0 {
+		params["serviceName"] = name
+	}
+	if len(params["port"]) == 0 && instances[0].ServicePort > 0 {
+		params["port"] = strconv.Itoa(instances[0].ServicePort)
+	}
+	addresses := []string{}
+	for _, instance := range instances {
+		address := instance.ServiceAddress
+		if len(address) == 0 {
+			address = instance.Address
+		}
+		if len(address) > 0 && !containsString(addresses, address) {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Strings(addresses)
+	params[consulAddressesParam] = strings.Join(addresses, ",")
+	return params
+}
@@ -0,0 +1,245 @@
+package actions
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker-flow/docker-flow-proxy/proxy"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type ConsulTestSuite struct {
+	suite.Suite
+	base BaseReconfigure
+}
+
+func TestConsulUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	separatorOrig := os.Getenv("SEPARATOR")
+	defer func() { os.Setenv("SEPARATOR", separatorOrig) }()
+	os.Setenv("SEPARATOR", ",")
+	suite.Run(t, new(ConsulTestSuite))
+}
+
+func (s *ConsulTestSuite) SetupTest() {
+	s.base = BaseReconfigure{
+		ConfigsPath:   "/cfg",
+		InstanceName:  "docker-flow",
+		TemplatesPath: "/cfg/tmpl",
+	}
+}
+
+// NewConsul
+
+func (s *ConsulTestSuite) Test_NewConsul_AddsSchemeToAddress() {
+	c := NewConsul(s.base, "consul:8500/").(*Consul)
+
+	s.Equal("http://consul:8500", c.Address)
+}
+
+func (s *ConsulTestSuite) Test_NewConsul_ReadsEnvVars() {
+	dcOrig := os.Getenv("CONSUL_DATACENTER")
+	tokenOrig := os.Getenv("CONSUL_TOKEN")
+	defer func() {
+		os.Setenv("CONSUL_DATACENTER", dcOrig)
+		os.Setenv("CONSUL_TOKEN", tokenOrig)
+	}()
+	os.Setenv("CONSUL_DATACENTER", "dc1")
+	os.Setenv("CONSUL_TOKEN", "my-token")
+
+	c := NewConsul(s.base, "http://consul:8500").(*Consul)
+
+	s.Equal("dc1", c.Datacenter)
+	s.Equal("my-token", c.Token)
+}
+
+// getParams
+
+func (s *ConsulTestSuite) Test_GetParams_UsesTagsAndMeta() {
+	c := Consul{}
+
+	actual := c.getParams("api", []consulCatalogService{
+		{
+			Address:     "10.0.0.1",
+			ServicePort: 8080,
+			ServiceTags: []string{"dfp.servicePath=/api", "dfp.httpsOnly", "other"},
+			ServiceMeta: map[string]string{"dfp_serviceDomain": "my-domain.com", "version": "1"},
+		},
+	})
+
+	s.Equal(map[string]string{
+		"serviceName":        "api",
+		"servicePath":        "/api",
+		"httpsOnly":          "true",
+		"serviceDomain":      "my-domain.com",
+		"port":               "8080",
+		consulAddressesParam: "10.0.0.1",
+	}, actual)
+}
+
+func (s *ConsulTestSuite) Test_GetParams_DoesNotOverwriteServiceNameAndPort() {
+	c := Consul{}
+
+	actual := c.getParams("api", []consulCatalogService{
+		{
+			Address:     "10.0.0.1",
+			ServicePort: 8080,
+			ServiceTags: []string{"dfp.serviceName=my-api", "dfp.port=9090"},
+		},
+	})
+
+	s.Equal("my-api", actual["serviceName"])
+	s.Equal("9090", actual["port"])
+}
+
+func (s *ConsulTestSuite) Test_GetParams_CollectsUniqueAddresses() {
+	c := Consul{}
+
+	actual := c.getParams("api", []consulCatalogService{
+		{Address: "10.0.0.2", ServiceTags: []string{"dfp.enable"}},
+		{Address: "10.0.0.9", ServiceAddress: "10.0.0.1", ServiceTags: []string{"dfp.enable"}},
+		{Address: "10.0.0.2", ServiceTags: []string{"dfp.enable"}},
+	})
+
+	s.Equal("10.0.0.1,10.0.0.2", actual[consulAddressesParam])
+}
+
+func (s *ConsulTestSuite) Test_GetParams_ReturnsNil_WhenThereAreNoInstances() {
+	c := Consul{}
+
+	actual := c.getParams("api", []consulCatalogService{})
+
+	s.Nil(actual)
+}
+
+// consulParameterProvider
+
+func (s *ConsulTestSuite) Test_ConsulParameterProvider_UsesAddressesAsTasks() {
+	provider := newConsulParameterProvider(map[string]string{
+		"serviceName":        "api",
+		"servicePath":        "/api",
+		"port":               "8080",
+		"sessionType":        "sticky-server",
+		consulAddressesParam: "10.0.0.1,10.0.0.2",
+	})
+
+	actual := proxy.GetServiceFromProvider(provider)
+
+	s.Equal("api", actual.ServiceName)
+	s.Equal([]string{"10.0.0.1", "10.0.0.2"}, actual.Tasks)
+	s.Empty(provider.GetString(consulAddressesParam))
+}
+
+// Run
+
+func (s *ConsulTestSuite) Test_Run_ReturnsError_WhenAddressIsEmpty() {
+	c := Consul{}
+
+	err := c.Run(nil)
+
+	s.Error(err)
+}
+
+func (s *ConsulTestSuite) Test_Run_ReconfiguresAndRemovesServices() {
+	mu := sync.Mutex{}
+	index := 1
+	registered := true
+	changed := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("my-token", r.Header.Get("X-Consul-Token"))
+		s.Equal("dc1", r.URL.Query().Get("dc"))
+		switch r.URL.Path {
+		case "/v1/catalog/services":
+			switch r.URL.Query().Get("index") {
+			case "1":
+				select {
+				case <-changed:
+				case <-r.Context().Done():
+					return
+				}
+			case "2":
+				<-r.Context().Done()
+				return
+			}
+			mu.Lock()
+			services := map[string][]string{"consul": {}}
+			if registered {
+				services["api"] = []string{"dfp.servicePath=/api"}
+			}
+			w.Header().Set("X-Consul-Index", []string{"", "1", "2"}[index])
+			mu.Unlock()
+			js, _ := json.Marshal(services)
+			w.Write(js)
+		case "/v1/catalog/service/api":
+			js, _ := json.Marshal([]consulCatalogService{{
+				Address:     "10.0.0.1",
+				ServicePort: 8080,
+				ServiceTags: []string{"dfp.servicePath=/api"},
+			}})
+			w.Write(js)
+		default:
+			s.Fail("Unexpected request to " + r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+	reconfigured := make(chan proxy.Service, 10)
+	defer MockReconfigureAndReload(reconfigured)()
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	removed := make(chan string, 10)
+	proxyMock := getProxyMock("RemoveService")
+	proxyMock.On("RemoveService", mock.Anything).Return(true).Run(func(args mock.Arguments) {
+		removed <- args.String(0)
+	})
+	proxy.Instance = proxyMock
+	osRemoveOrig := osRemove
+	defer func() { osRemove = osRemoveOrig }()
+	osRemove = func(name string) error { return nil }
+	c := Consul{
+		BaseReconfigure: s.base,
+		Address:         srv.URL,
+		Datacenter:      "dc1",
+		Token:           "my-token",
+		WaitTime:        time.Minute,
+		RetryInterval:   time.Millisecond,
+		client:          &http.Client{},
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	go func() {
+		c.Run(stop)
+		close(done)
+	}()
+
+	select {
+	case actual := <-reconfigured:
+		s.Equal("api", actual.ServiceName)
+		s.Equal([]string{"/api"}, actual.ServiceDest[0].ServicePath)
+		s.Equal("8080", actual.ServiceDest[0].Port)
+	case <-time.After(5 * time.Second):
+		s.FailNow("Timed out waiting for the service to be reconfigured")
+	}
+
+	mu.Lock()
+	index = 2
+	registered = false
+	mu.Unlock()
+	close(changed)
+	select {
+	case name := <-removed:
+		s.Equal("api", name)
+	case <-time.After(5 * time.Second):
+		s.Fail("Timed out waiting for the service to be removed")
+	}
+}
@@ -0,0 +1,283 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker-flow/docker-flow-proxy/proxy"
+)
+
+// Discoverer defines the interface implemented by service discovery providers.
+// A provider watches an external registry and keeps the proxy configuration in sync with it.
+type Discoverer interface {
+	// Run watches the registry until the stop channel is closed.
+	Run(stop <-chan struct{}) error
+}
+
+// serviceSync keeps track of the services configured from registry objects.
+// Each object (e.g. Kubernetes Ingress) is identified by a key and can produce any number of services.
+// When an object stops producing a service or disappears, the service is removed from the proxy.
+type serviceSync struct {
+	BaseReconfigure
+	// Converts parameters into a provider. If nil, parameters are treated as a plain map.
+	newProvider func(params map[string]string) proxy.ServiceParameterProvider
+	mu          sync.Mutex
+	owners      map[string][]string
+	params      map[string]map[string]string
+}
+
+// discoveredServices counts, for each service name, the providers that configured the service.
+// Reconciliation with Swarm Listener leaves those services alone.
+var discoveredServices = struct {
+	sync.Mutex
+	names map[string]int
+}{names: map[string]int{}}
+
+func isDiscoveredService(name string) bool {
+	discoveredServices.Lock()
+	defer discoveredServices.Unlock()
+	return discoveredServices.names[name] > 0
+}
+
+// getRetryInterval returns the pause between two attempts to contact a registry after a failure.
+// It is defined in milliseconds through `RELOAD_INTERVAL` and defaults to five seconds.
+func getRetryInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("RELOAD_INTERVAL") + "ms")
+	if err != nil || interval <= 0 {
+		interval = 5 * time.Second
+	}
+	return interval
+}
+
+// watchRegistry invokes watch until the stop channel is closed.
+// The context passed to watch is canceled when the stop channel is closed.
+// Failures are logged and watch is invoked again after the retry interval.
+func watchRegistry(stop <-chan struct{}, registry string, retryInterval time.Duration, watch func(ctx context.Context) error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+	for {
+		err := watch(ctx)
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		if err != nil {
+			logPrintf(
+				"Error: Watching %s failed: %s. Will retry in %d seconds.",
+				registry,
+				err.Error(),
+				retryInterval/time.Second,
+			)
+			select {
+			case <-stop:
+				return
+			case <-time.After(retryInterval):
+			}
+		}
+	}
+}
+
+// getFromRegistry sends a GET request to the registry.
+// An error is returned, and the body is closed, if the response status code is not 200.
+func getFromRegistry(ctx context.Context, client *http.Client, addr string, header http.Header, registry string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s responded with the status code %d", registry, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+func newServiceSync(baseData BaseReconfigure) *serviceSync {
+	return &serviceSync{
+		BaseReconfigure: baseData,
+		owners:          map[string][]string{},
+		params:          map[string]map[string]string{},
+	}
+}
+
+// put reconfigures the proxy with the services produced by the object identified with the key.
+// Services previously produced by the same object that are not part of the list anymore are removed.
+// The proxy is not reloaded. The returned value is true if the configuration changed.
+func (m *serviceSync) put(key string, services []map[string]string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.putObject(key, services)
+}
+
+// delete removes all the services produced by the object identified with the key.
+// The proxy is not reloaded. The returned value is true if the configuration changed.
+func (m *serviceSync) delete(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.putObject(key, nil)
+}
+
+// replace synchronizes the proxy with a full snapshot of the registry.
+// Objects that are not part of the snapshot are treated as deleted.
+// The proxy is not reloaded. The returned value is true if the configuration changed.
+func (m *serviceSync) replace(objects map[string][]map[string]string) bool {
+	return m.replaceScope("", objects)
+}
+
+// replaceScope synchronizes the proxy with a full snapshot of the objects whose keys start with the prefix.
+// Objects with other keys are left alone.
+func (m *serviceSync) replaceScope(prefix string, objects map[string][]map[string]string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changed := false
+	for _, key := range m.keys() {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if _, ok := objects[key]; !ok {
+			changed = m.putObject(key, nil) || changed
+		}
+	}
+	keys := []string{}
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		changed = m.putObject(key, objects[key]) || changed
+	}
+	return changed
+}
+
+// reload recreates the configuration and reloads the proxy.
+// Errors are logged since the registry is synchronized again with the next change.
+func (m *serviceSync) reload() {
+	if err := NewReload().Execute(true); err != nil {
+		logPrintf("Error: Could not reload the proxy: %s", err.Error())
+	}
+}
+
+func (m *serviceSync) keys() []string {
+	keys := []string{}
+	for key := range m.owners {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *serviceSync) putObject(key string, services []map[string]string) bool {
+	changed := false
+	names := []string{}
+	for _, params := range services {
+		name := params["serviceName"]
+		if len(name) == 0 {
+			continue
+		}
+		previous, ok := m.params[name]
+		// Services that were applied before stay configured with their previous parameters
+		if ok {
+			names = append(names, name)
+		}
+		if ok && reflect.DeepEqual(previous, params) {
+			continue
+		}
+		service := m.getService(params)
+		if statusCode, msg := proxy.IsValidReconf(service); statusCode != http.StatusOK {
+			logPrintf("Skipping %s: %s", name, msg)
+			continue
+		}
+		if err := NewReconfigure(m.BaseReconfigure, *service).Execute(false); err != nil {
+			logPrintf("Could not reconfigure %s: %s", name, err.Error())
+			continue
+		}
+		// Parameters are recorded only once they are applied so that failures are retried with the next change
+		if !ok {
+			discoveredServices.Lock()
+			discoveredServices.names[name]++
+			discoveredServices.Unlock()
+			names = append(names, name)
+		}
+		m.params[name] = params
+		changed = true
+	}
+	for _, name := range m.owners[key] {
+		if !containsString(names, name) && !m.isOwnedByOthers(key, name) {
+			changed = m.removeService(name) || changed
+		}
+	}
+	if len(names) > 0 {
+		m.owners[key] = names
+	} else {
+		delete(m.owners, key)
+	}
+	return changed
+}
+
+func (m *serviceSync) getService(params map[string]string) *proxy.Service {
+	if m.newProvider != nil {
+		return proxy.GetServiceFromProvider(m.newProvider(params))
+	}
+	return proxy.GetServiceFromMap(&params)
+}
+
+func (m *serviceSync) isOwnedByOthers(key, name string) bool {
+	for owner, names := range m.owners {
+		if owner != key && containsString(names, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *serviceSync) removeService(name string) bool {
+	params := m.params[name]
+	delete(m.params, name)
+	discoveredServices.Lock()
+	if discoveredServices.names[name]--; discoveredServices.names[name] <= 0 {
+		delete(discoveredServices.names, name)
+	}
+	discoveredServices.Unlock()
+	action := Remove{
+		ServiceName:   name,
+		AclName:       params["aclName"],
+		ConfigsPath:   m.ConfigsPath,
+		TemplatesPath: m.TemplatesPath,
+		InstanceName:  m.InstanceName,
+	}
+	logPrintf("Removing %s configuration", name)
+	didRemove, err := action.removeConfigsAndService()
+	if err != nil {
+		return false
+	}
+	return didRemove
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
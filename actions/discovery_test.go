@@ -0,0 +1,256 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/docker-flow/docker-flow-proxy/proxy"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type DiscoveryTestSuite struct {
+	suite.Suite
+	proxyMock    *ProxyMock
+	reconfigured chan proxy.Service
+	restore      []func()
+}
+
+func TestDiscoveryUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	separatorOrig := os.Getenv("SEPARATOR")
+	defer func() { os.Setenv("SEPARATOR", separatorOrig) }()
+	os.Setenv("SEPARATOR", ",")
+	suite.Run(t, new(DiscoveryTestSuite))
+}
+
+func (s *DiscoveryTestSuite) SetupTest() {
+	s.reconfigured = make(chan proxy.Service, 10)
+	s.restore = []func(){MockReconfigureAndReload(s.reconfigured)}
+	proxyOrig := proxy.Instance
+	osRemoveOrig := osRemove
+	s.restore = append(s.restore, func() {
+		proxy.Instance = proxyOrig
+		osRemove = osRemoveOrig
+	})
+	s.proxyMock = getProxyMock("")
+	proxy.Instance = s.proxyMock
+	osRemove = func(name string) error { return nil }
+}
+
+func (s *DiscoveryTestSuite) TearDownTest() {
+	for _, restore := range s.restore {
+		restore()
+	}
+}
+
+// put
+
+func (s *DiscoveryTestSuite) Test_Put_ReconfiguresServices() {
+	discovery := newServiceSync(BaseReconfigure{})
+
+	changed := discovery.put("my-object", []map[string]string{
+		{"serviceName": "my-service", "servicePath": "/api", "port": "8080"},
+	})
+
+	s.True(changed)
+	s.Len(s.reconfigured, 1)
+	s.Equal("my-service", (<-s.reconfigured).ServiceName)
+}
+
+func (s *DiscoveryTestSuite) Test_Put_DoesNotReconfigure_WhenParamsDidNotChange() {
+	discovery := newServiceSync(BaseReconfigure{})
+	params := []map[string]string{
+		{"serviceName": "my-service", "servicePath": "/api", "port": "8080"},
+	}
+	discovery.put("my-object", params)
+	<-s.reconfigured
+
+	changed := discovery.put("my-object", params)
+
+	s.False(changed)
+	s.Len(s.reconfigured, 0)
+}
+
+func (s *DiscoveryTestSuite) Test_Put_RetriesReconfigure_WhenItFailed() {
+	newReconfigureOrig := NewReconfigure
+	defer func() { NewReconfigure = newReconfigureOrig }()
+	attempts := 0
+	NewReconfigure = func(baseData BaseReconfigure, serviceData proxy.Service) Reconfigurable {
+		attempts++
+		reconfigureMock := getReconfigureMock("Execute")
+		if attempts == 1 {
+			reconfigureMock.On("Execute", mock.Anything).Return(fmt.Errorf("This is an error"))
+		} else {
+			reconfigureMock.On("Execute", mock.Anything).Return(nil)
+		}
+		return reconfigureMock
+	}
+	discovery := newServiceSync(BaseReconfigure{})
+	params := []map[string]string{
+		{"serviceName": "retried-service", "servicePath": "/api", "port": "8080"},
+	}
+	s.False(discovery.put("my-object", params))
+	s.False(isDiscoveredService("retried-service"))
+
+	changed := discovery.put("my-object", params)
+
+	s.True(changed)
+	s.Equal(2, attempts)
+	s.True(isDiscoveredService("retried-service"))
+	discovery.delete("my-object")
+}
+
+func (s *DiscoveryTestSuite) Test_Put_SkipsInvalidServices() {
+	discovery := newServiceSync(BaseReconfigure{})
+
+	changed := discovery.put("my-object", []map[string]string{
+		{"serviceName": "my-service", "port": "8080"},
+	})
+
+	s.False(changed)
+	s.Len(s.reconfigured, 0)
+}
+
+func (s *DiscoveryTestSuite) Test_Put_RemovesServicesNoLongerProducedByTheObject() {
+	discovery := newServiceSync(BaseReconfigure{})
+	discovery.put("my-object", []map[string]string{
+		{"serviceName": "service-1", "servicePath": "/api", "port": "8080"},
+		{"serviceName": "service-2", "servicePath": "/web", "port": "8080"},
+	})
+
+	changed := discovery.put("my-object", []map[string]string{
+		{"serviceName": "service-1", "servicePath": "/api", "port": "8080"},
+	})
+
+	s.True(changed)
+	s.proxyMock.AssertCalled(s.T(), "RemoveService", "service-2")
+	s.proxyMock.AssertNotCalled(s.T(), "RemoveService", "service-1")
+}
+
+// delete
+
+func (s *DiscoveryTestSuite) Test_Delete_RemovesAllServicesOfTheObject() {
+	discovery := newServiceSync(BaseReconfigure{})
+	discovery.put("my-object", []map[string]string{
+		{"serviceName": "service-1", "servicePath": "/api", "port": "8080"},
+	})
+	discovery.put("other-object", []map[string]string{
+		{"serviceName": "service-2", "servicePath": "/web", "port": "8080"},
+	})
+
+	changed := discovery.delete("my-object")
+
+	s.True(changed)
+	s.proxyMock.AssertCalled(s.T(), "RemoveService", "service-1")
+	s.proxyMock.AssertNotCalled(s.T(), "RemoveService", "service-2")
+}
+
+// replace
+
+func (s *DiscoveryTestSuite) Test_Replace_RemovesObjectsMissingFromTheSnapshot() {
+	discovery := newServiceSync(BaseReconfigure{})
+	discovery.put("my-object", []map[string]string{
+		{"serviceName": "service-1", "servicePath": "/api", "port": "8080"},
+	})
+
+	changed := discovery.replace(map[string][]map[string]string{
+		"other-object": {{"serviceName": "service-2", "servicePath": "/web", "port": "8080"}},
+	})
+
+	s.True(changed)
+	s.proxyMock.AssertCalled(s.T(), "RemoveService", "service-1")
+	s.proxyMock.AssertNotCalled(s.T(), "RemoveService", "service-2")
+}
+
+func (s *DiscoveryTestSuite) Test_Replace_ReturnsFalse_WhenNothingChanged() {
+	discovery := newServiceSync(BaseReconfigure{})
+	objects := map[string][]map[string]string{
+		"my-object": {{"serviceName": "service-1", "servicePath": "/api", "port": "8080"}},
+	}
+	discovery.replace(objects)
+
+	changed := discovery.replace(objects)
+
+	s.False(changed)
+	s.proxyMock.AssertNotCalled(s.T(), "RemoveService", mock.Anything)
+}
+
+// isDiscoveredService
+
+func (s *DiscoveryTestSuite) Test_IsDiscoveredService_ReturnsTrue_WhileServiceIsConfigured() {
+	discovery := newServiceSync(BaseReconfigure{})
+	discovery.put("my-object", []map[string]string{
+		{"serviceName": "discovered-service", "servicePath": "/api", "port": "8080"},
+	})
+
+	s.True(isDiscoveredService("discovered-service"))
+
+	discovery.delete("my-object")
+
+	s.False(isDiscoveredService("discovered-service"))
+}
+
+// getRetryInterval
+
+func (s *DiscoveryTestSuite) Test_GetRetryInterval_ReturnsReloadInterval() {
+	intervalOrig := os.Getenv("RELOAD_INTERVAL")
+	defer func() { os.Setenv("RELOAD_INTERVAL", intervalOrig) }()
+	os.Setenv("RELOAD_INTERVAL", "1500")
+
+	s.Equal(1500*time.Millisecond, getRetryInterval())
+
+	os.Setenv("RELOAD_INTERVAL", "not-a-number")
+
+	s.Equal(5*time.Second, getRetryInterval())
+}
+
+// watchRegistry
+
+func (s *DiscoveryTestSuite) Test_WatchRegistry_RetriesUntilStopped() {
+	stop := make(chan struct{})
+	attempts := 0
+
+	watchRegistry(stop, "my-registry", time.Millisecond, func(ctx context.Context) error {
+		attempts++
+		if attempts == 3 {
+			close(stop)
+			<-ctx.Done()
+		}
+		return fmt.Errorf("This is an error")
+	})
+
+	s.Equal(3, attempts)
+}
+
+// getFromRegistry
+
+func (s *DiscoveryTestSuite) Test_GetFromRegistry_SendsHeaders() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("my-token", r.Header.Get("X-Token"))
+	}))
+	defer srv.Close()
+	header := http.Header{}
+	header.Set("X-Token", "my-token")
+
+	resp, err := getFromRegistry(context.Background(), &http.Client{}, srv.URL, header, "My registry")
+
+	s.Require().NoError(err)
+	resp.Body.Close()
+}
+
+func (s *DiscoveryTestSuite) Test_GetFromRegistry_ReturnsError_WhenStatusIsNot200() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	_, err := getFromRegistry(context.Background(), &http.Client{}, srv.URL, nil, "My registry")
+
+	s.EqualError(err, "My registry responded with the status code 403")
+}
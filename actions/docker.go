@@ -0,0 +1,200 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dockerLabelPrefix = "com.df."
+
+type dockerService struct {
+	ID   string `json:"ID"`
+	Spec struct {
+		Name   string            `json:"Name"`
+		Labels map[string]string `json:"Labels"`
+		Mode   struct {
+			Replicated *struct {
+				Replicas *int `json:"Replicas"`
+			} `json:"Replicated"`
+			Global *struct{} `json:"Global"`
+		} `json:"Mode"`
+	} `json:"Spec"`
+}
+
+type dockerEvent struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+}
+
+// Docker watches Swarm services through the Docker Engine API and reconfigures the proxy whenever they change.
+// It is a built-in alternative to Docker Flow Swarm Listener.
+// Only services with the `com.df.notify` label set to `true` are used.
+type Docker struct {
+	BaseReconfigure
+	// The address of the Docker Engine API (e.g. unix:///var/run/docker.sock or tcp://manager:2375).
+	Address string
+	// The pause between two attempts to contact the Docker Engine after a failure.
+	RetryInterval time.Duration
+	baseURL       string
+	client        *http.Client
+	sync          *serviceSync
+}
+
+// NewDocker returns a Docker discovery provider configured through environment variables
+var NewDocker = func(baseData BaseReconfigure, address string) Discoverer {
+	d := &Docker{
+		BaseReconfigure: baseData,
+		Address:         address,
+		RetryInterval:   getRetryInterval(),
+		client:          &http.Client{},
+	}
+	if strings.HasPrefix(address, "unix://") {
+		socket := strings.TrimPrefix(address, "unix://")
+		d.baseURL = "http://docker"
+		d.client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		}
+	} else {
+		d.baseURL = "http://" + strings.TrimPrefix(strings.TrimPrefix(address, "tcp://"), "http://")
+	}
+	d.baseURL = strings.TrimRight(d.baseURL, "/")
+	return d
+}
+
+// Run lists and watches Docker services until the stop channel is closed.
+// Connection problems are logged and retried.
+func (m *Docker) Run(stop <-chan struct{}) error {
+	if len(m.Address) == 0 {
+		return fmt.Errorf("Docker Engine address is missing")
+	}
+	if m.sync == nil {
+		m.sync = newServiceSync(m.BaseReconfigure)
+	}
+	watchRegistry(stop, "Docker services", m.RetryInterval, m.watch)
+	return nil
+}
+
+// watch subscribes to service events, synchronizes the proxy with all the services and applies events until the stream closes.
+// The subscription is made before the services are listed so that no change is missed in between.
+func (m *Docker) watch(ctx context.Context) error {
+	filters, _ := json.Marshal(map[string][]string{"type": {"service"}})
+	resp, err := m.get(ctx, "/events?filters="+url.QueryEscape(string(filters)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := m.syncServices(ctx); err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		event := dockerEvent{}
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := m.applyEvent(ctx, &event); err != nil {
+			return err
+		}
+	}
+}
+
+func (m *Docker) syncServices(ctx context.Context) error {
+	resp, err := m.get(ctx, "/services")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	services := []dockerService{}
+	if err := json.NewDecoder(resp.Body).Decode(&services); err != nil {
+		return err
+	}
+	objects := map[string][]map[string]string{}
+	for i := range services {
+		if params := m.getParams(&services[i]); params != nil {
+			objects[services[i].ID] = []map[string]string{params}
+		}
+	}
+	if m.sync.replace(objects) {
+		m.sync.reload()
+	}
+	return nil
+}
+
+func (m *Docker) applyEvent(ctx context.Context, event *dockerEvent) error {
+	if event.Type != "service" || len(event.Actor.ID) == 0 {
+		return nil
+	}
+	changed := false
+	switch event.Action {
+	case "create", "update":
+		resp, err := m.get(ctx, "/services/"+url.PathEscape(event.Actor.ID))
+		if err != nil {
+			return err
+		}
+		service := dockerService{}
+		err = json.NewDecoder(resp.Body).Decode(&service)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if params := m.getParams(&service); params != nil {
+			changed = m.sync.put(service.ID, []map[string]string{params})
+		} else {
+			changed = m.sync.delete(service.ID)
+		}
+	case "remove":
+		changed = m.sync.delete(event.Actor.ID)
+	}
+	if changed {
+		m.sync.reload()
+	}
+	return nil
+}
+
+func (m *Docker) get(ctx context.Context, path string) (*http.Response, error) {
+	return getFromRegistry(ctx, m.client, m.baseURL+path, nil, "Docker Engine")
+}
+
+// getParams translates labels of a Docker service into reconfigure parameters the same way Swarm Listener does.
+// It returns nil if the service should not be used by this proxy.
+func (m *Docker) getParams(service *dockerService) map[string]string {
+	labels := service.Spec.Labels
+	if !strings.EqualFold(labels[dockerLabelPrefix+"notify"], "true") {
+		return nil
+	}
+	params := map[string]string{}
+	for key, value := range labels {
+		if strings.HasPrefix(key, dockerLabelPrefix) && key != dockerLabelPrefix+"notify" {
+			params[strings.TrimPrefix(key, dockerLabelPrefix)] = value
+		}
+	}
+	if strings.EqualFold(os.Getenv("FILTER_PROXY_INSTANCE_NAME"), "true") &&
+		!strings.EqualFold(m.InstanceName, params["proxyInstanceName"]) {
+		return nil
+	}
+	if len(params["serviceName"]) == 0 {
+		params["serviceName"] = service.Spec.Name
+	}
+	if replicated := service.Spec.Mode.Replicated; replicated != nil && replicated.Replicas != nil {
+		params["replicas"] = strconv.Itoa(*replicated.Replicas)
+	}
+	return params
+}
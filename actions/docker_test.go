@@ -0,0 +1,271 @@
+package actions
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker-flow/docker-flow-proxy/proxy"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type DockerTestSuite struct {
+	suite.Suite
+	base BaseReconfigure
+}
+
+func TestDockerUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	separatorOrig := os.Getenv("SEPARATOR")
+	defer func() { os.Setenv("SEPARATOR", separatorOrig) }()
+	os.Setenv("SEPARATOR", ",")
+	suite.Run(t, new(DockerTestSuite))
+}
+
+func (s *DockerTestSuite) SetupTest() {
+	s.base = BaseReconfigure{
+		ConfigsPath:   "/cfg",
+		InstanceName:  "docker-flow",
+		TemplatesPath: "/cfg/tmpl",
+	}
+}
+
+// NewDocker
+
+func (s *DockerTestSuite) Test_NewDocker_UsesHttp_WhenAddressIsTcp() {
+	d := NewDocker(s.base, "tcp://manager:2375/").(*Docker)
+
+	s.Equal("http://manager:2375", d.baseURL)
+	s.Nil(d.client.Transport)
+}
+
+func (s *DockerTestSuite) Test_NewDocker_DialsSocket_WhenAddressIsUnix() {
+	d := NewDocker(s.base, "unix:///var/run/docker.sock").(*Docker)
+
+	s.Equal("http://docker", d.baseURL)
+	s.NotNil(d.client.Transport)
+}
+
+// getParams
+
+func (s *DockerTestSuite) Test_GetParams_ReturnsComDfLabels() {
+	d := Docker{BaseReconfigure: s.base}
+	service := s.getService("id-1", "api", 3, map[string]string{
+		"com.df.notify":      "true",
+		"com.df.servicePath": "/api",
+		"com.df.port":        "8080",
+		"other.label":        "ignored",
+	})
+
+	actual := d.getParams(&service)
+
+	s.Equal(map[string]string{
+		"serviceName": "api",
+		"servicePath": "/api",
+		"port":        "8080",
+		"replicas":    "3",
+	}, actual)
+}
+
+func (s *DockerTestSuite) Test_GetParams_DoesNotSetReplicas_WhenServiceIsGlobal() {
+	d := Docker{BaseReconfigure: s.base}
+	service := s.getService("id-1", "api", -1, map[string]string{
+		"com.df.notify":      "true",
+		"com.df.servicePath": "/api",
+	})
+
+	actual := d.getParams(&service)
+
+	s.NotContains(actual, "replicas")
+}
+
+func (s *DockerTestSuite) Test_GetParams_ReturnsNil_WhenNotifyLabelIsNotSet() {
+	d := Docker{BaseReconfigure: s.base}
+	service := s.getService("id-1", "api", 1, map[string]string{
+		"com.df.servicePath": "/api",
+	})
+
+	actual := d.getParams(&service)
+
+	s.Nil(actual)
+}
+
+func (s *DockerTestSuite) Test_GetParams_ReturnsNil_WhenProxyInstanceNameDoesNotMatch() {
+	filterOrig := os.Getenv("FILTER_PROXY_INSTANCE_NAME")
+	defer func() { os.Setenv("FILTER_PROXY_INSTANCE_NAME", filterOrig) }()
+	os.Setenv("FILTER_PROXY_INSTANCE_NAME", "true")
+	d := Docker{BaseReconfigure: s.base}
+	other := s.getService("id-1", "api", 1, map[string]string{
+		"com.df.notify":            "true",
+		"com.df.proxyInstanceName": "other-proxy",
+	})
+	own := s.getService("id-2", "web", 1, map[string]string{
+		"com.df.notify":            "true",
+		"com.df.proxyInstanceName": "docker-flow",
+	})
+
+	s.Nil(d.getParams(&other))
+	s.NotNil(d.getParams(&own))
+}
+
+// Run
+
+func (s *DockerTestSuite) Test_Run_ReturnsError_WhenAddressIsEmpty() {
+	d := Docker{}
+
+	err := d.Run(nil)
+
+	s.Error(err)
+}
+
+func (s *DockerTestSuite) Test_Run_ReconfiguresAndRemovesServices() {
+	mu := sync.Mutex{}
+	services := map[string]dockerService{
+		"id-1": s.getService("id-1", "api", 2, map[string]string{
+			"com.df.notify":      "true",
+			"com.df.servicePath": "/api",
+			"com.df.port":        "8080",
+		}),
+	}
+	events := make(chan dockerEvent)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/events" {
+			s.Equal(`{"type":["service"]}`, r.URL.Query().Get("filters"))
+			w.(http.Flusher).Flush()
+			for {
+				select {
+				case <-r.Context().Done():
+					return
+				case event := <-events:
+					js, _ := json.Marshal(event)
+					w.Write(js)
+					w.(http.Flusher).Flush()
+				}
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/services":
+			list := []dockerService{}
+			for _, service := range services {
+				list = append(list, service)
+			}
+			js, _ := json.Marshal(list)
+			w.Write(js)
+		case strings.HasPrefix(r.URL.Path, "/services/"):
+			service, ok := services[strings.TrimPrefix(r.URL.Path, "/services/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			js, _ := json.Marshal(service)
+			w.Write(js)
+		default:
+			s.Fail("Unexpected request to " + r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+	reconfigured := make(chan proxy.Service, 10)
+	defer MockReconfigureAndReload(reconfigured)()
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	removed := make(chan string, 10)
+	proxyMock := getProxyMock("RemoveService")
+	proxyMock.On("RemoveService", mock.Anything).Return(true).Run(func(args mock.Arguments) {
+		removed <- args.String(0)
+	})
+	proxy.Instance = proxyMock
+	osRemoveOrig := osRemove
+	defer func() { osRemove = osRemoveOrig }()
+	osRemove = func(name string) error { return nil }
+	d := NewDocker(s.base, strings.Replace(srv.URL, "http://", "tcp://", 1)).(*Docker)
+	d.RetryInterval = time.Millisecond
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	go func() {
+		d.Run(stop)
+		close(done)
+	}()
+
+	actual := s.waitForService(reconfigured)
+	s.Equal("api", actual.ServiceName)
+	s.Equal(2, actual.Replicas)
+	s.Equal([]string{"/api"}, actual.ServiceDest[0].ServicePath)
+
+	mu.Lock()
+	services["id-2"] = s.getService("id-2", "web", 1, map[string]string{
+		"com.df.notify":      "true",
+		"com.df.servicePath": "/web",
+		"com.df.port":        "80",
+	})
+	mu.Unlock()
+	events <- s.getEvent("create", "id-2")
+	actual = s.waitForService(reconfigured)
+	s.Equal("web", actual.ServiceName)
+
+	mu.Lock()
+	services["id-1"] = s.getService("id-1", "api", 2, map[string]string{
+		"com.df.notify":      "true",
+		"com.df.servicePath": "/api/v2",
+		"com.df.port":        "8080",
+	})
+	mu.Unlock()
+	events <- s.getEvent("update", "id-1")
+	actual = s.waitForService(reconfigured)
+	s.Equal([]string{"/api/v2"}, actual.ServiceDest[0].ServicePath)
+
+	mu.Lock()
+	delete(services, "id-2")
+	mu.Unlock()
+	events <- s.getEvent("remove", "id-2")
+	select {
+	case name := <-removed:
+		s.Equal("web", name)
+	case <-time.After(5 * time.Second):
+		s.Fail("Timed out waiting for the service to be removed")
+	}
+}
+
+// Util
+
+func (s *DockerTestSuite) getService(id, name string, replicas int, labels map[string]string) dockerService {
+	service := dockerService{ID: id}
+	service.Spec.Name = name
+	service.Spec.Labels = labels
+	if replicas < 0 {
+		service.Spec.Mode.Global = &struct{}{}
+	} else {
+		service.Spec.Mode.Replicated = &struct {
+			Replicas *int `json:"Replicas"`
+		}{Replicas: &replicas}
+	}
+	return service
+}
+
+func (s *DockerTestSuite) getEvent(action, id string) dockerEvent {
+	event := dockerEvent{Type: "service", Action: action}
+	event.Actor.ID = id
+	return event
+}
+
+func (s *DockerTestSuite) waitForService(services chan proxy.Service) proxy.Service {
+	select {
+	case service := <-services:
+		return service
+	case <-time.After(5 * time.Second):
+		s.FailNow("Timed out waiting for the service to be reconfigured")
+	}
+	return proxy.Service{}
+}
@@ -1,10 +1,18 @@
 package actions
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/docker-flow/docker-flow-proxy/proxy"
 )
@@ -17,15 +25,45 @@ type Fetchable interface {
 	// This is synchronous.
 	// If listenerAddr is nil, unreachable or any other problem error is returned.
 	ReloadConfig(baseData BaseReconfigure, listenerAddr string) error
+	// Subscribes to service events streamed by swarm-listener and reconfigures this instance of proxy
+	// until the stop channel is closed. All the listenerAddrs are subscribed to at the same time.
+	// onSync is invoked each time the proxy is synchronized with the full list of services.
+	SubscribeConfig(baseData BaseReconfigure, listenerAddrs []string, onSync func(), stop <-chan struct{}) error
+}
+
+// listenerEvent is a single Server-Sent Event received from swarm-listener
+type listenerEvent struct {
+	id   string
+	name string
+	data string
 }
 type fetch struct {
 	BaseReconfigure
+	listenerAddrs []string
+	orphans       orphans
+	// reconcileSkipped makes sure that skipped reconciliation is reported only once
+	reconcileSkipped sync.Once
+}
+
+// orphans holds the services that were returned by Swarm Listener
+// and the time each orphaned service was noticed for the first time
+type orphans struct {
+	sync.Mutex
+	fromListener map[string]bool
+	since        map[string]time.Time
 }
 
-// NewFetch returns instance of the Fetchable object
-var NewFetch = func(baseData BaseReconfigure) Fetchable {
+var envServiceNameRegexp = regexp.MustCompile(`^DFP_SERVICE(_[0-9]+)?_SERVICE_NAME$`)
+
+// errEventsNotSupported is returned when the listener does not expose the events endpoint
+var errEventsNotSupported = errors.New("Swarm Listener does not stream events")
+
+// NewFetch returns instance of the Fetchable object.
+// listenerAddrs are the addresses of all the Swarm Listeners the proxy is configured with.
+var NewFetch = func(baseData BaseReconfigure, listenerAddrs []string) Fetchable {
 	return &fetch{
 		BaseReconfigure: baseData,
+		listenerAddrs:   listenerAddrs,
 	}
 }
 
@@ -54,9 +92,13 @@ func (m *fetch) ReloadConfig(baseData BaseReconfigure, listenerAddr string) erro
 		if statusCode, _ := proxy.IsValidReconf(proxyService); statusCode == http.StatusOK {
 			reconfigure := NewReconfigure(baseData, *proxyService)
 			reconfigure.Execute(false)
+			m.markListenerService(proxyService.ServiceName)
 			needsReload = true
 		}
 	}
+	if m.removeOrphans(baseData, services) {
+		needsReload = true
+	}
 	if needsReload {
 		reload := m.getReload()
 		reload.Execute(true)
@@ -84,6 +126,328 @@ func (m *fetch) ReloadClusterConfig(listenerAddr string) error {
 	return nil
 }
 
+// SubscribeConfig keeps proxy configuration in sync with service events streamed by Swarm Listener.
+// Events are received as Server-Sent Events. After a disconnect, the stream is resumed from the last received event
+// by sending its ID in the `Last-Event-ID` header. If there is no event to resume from, or the listener responds with
+// `410 Gone` because it cannot resume, the full list of services is fetched and services that are not part of it
+// anymore are removed.
+// All the listeners are subscribed to at the same time and each of them manages only the services it returned.
+// Listeners that do not expose the events endpoint (`404 Not Found`) are queried for services every `RELOAD_INTERVAL`.
+func (m *fetch) SubscribeConfig(baseData BaseReconfigure, listenerAddrs []string, onSync func(), stop <-chan struct{}) error {
+	addrs := []string{}
+	for _, addr := range listenerAddrs {
+		if len(addr) > 0 {
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("Swarm Listener address is missing")
+	}
+	interval, err := time.ParseDuration(os.Getenv("RELOAD_INTERVAL") + "ms")
+	if err != nil || interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+	discovery := newServiceSync(baseData)
+	wg := sync.WaitGroup{}
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			m.watchListener(ctx, discovery, addr, interval, onSync)
+		}(addr)
+	}
+	wg.Wait()
+	return nil
+}
+
+// watchListener keeps the services returned by a single listener in sync until the context is canceled
+func (m *fetch) watchListener(ctx context.Context, discovery *serviceSync, listenerAddr string, interval time.Duration, onSync func()) {
+	lastEventID := ""
+	polling := false
+	for {
+		var err error
+		if polling {
+			if err = m.syncServices(ctx, discovery, listenerAddr); err == nil && onSync != nil {
+				onSync()
+			}
+		} else {
+			lastEventID, err = m.subscribe(ctx, discovery, listenerAddr, lastEventID, onSync)
+			if err == errEventsNotSupported {
+				logPrintf("%s does not stream events. Services will be fetched every %d seconds.", listenerAddr, interval/time.Second)
+				polling = true
+				continue
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logPrintf(
+				"Error: Fetching config from swarm listener %s failed: %s. Will retry in %d seconds.",
+				listenerAddr,
+				err.Error(),
+				interval/time.Second,
+			)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// subscribe opens the event stream and applies events until the stream is closed.
+// It returns the ID of the last applied event.
+func (m *fetch) subscribe(ctx context.Context, discovery *serviceSync, listenerAddr, lastEventID string, onSync func()) (string, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/v1/docker-flow-swarm-listener/events", listenerAddr), nil)
+	if err != nil {
+		return lastEventID, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if len(lastEventID) > 0 {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := httpDo(req.WithContext(ctx))
+	if err != nil {
+		return lastEventID, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return lastEventID, errEventsNotSupported
+	} else if resp.StatusCode == http.StatusGone {
+		logPrintf("Swarm Listener cannot resume from the event %s. The full list of services will be fetched.", lastEventID)
+		return "", nil
+	} else if resp.StatusCode != http.StatusOK {
+		return lastEventID, fmt.Errorf("Swarm Listener responded with the status code %d", resp.StatusCode)
+	}
+	// The stream is opened before services are fetched so that no event is missed in between
+	if len(lastEventID) == 0 {
+		if err := m.syncServices(ctx, discovery, listenerAddr); err != nil {
+			return lastEventID, err
+		}
+		if onSync != nil {
+			onSync()
+		}
+	}
+	logPrintf("Subscribed to events from %s.", listenerAddr)
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	event := listenerEvent{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) > 0 {
+			event.parseLine(line)
+			continue
+		}
+		if len(event.name) > 0 || len(event.data) > 0 {
+			if err := m.applyEvent(discovery, listenerAddr, &event); err != nil {
+				logPrintf("Error: Could not apply the event %s: %s", event.id, err.Error())
+			}
+		}
+		if len(event.id) > 0 {
+			lastEventID = event.id
+		}
+		event = listenerEvent{}
+	}
+	return lastEventID, scanner.Err()
+}
+
+func (m *fetch) syncServices(ctx context.Context, discovery *serviceSync, listenerAddr string) error {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/v1/docker-flow-swarm-listener/get-services", listenerAddr), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpDo(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Swarm Listener responded with the status code %d", resp.StatusCode)
+	}
+	services := []map[string]string{}
+	if err = json.NewDecoder(resp.Body).Decode(&services); err != nil {
+		return err
+	}
+	objects := map[string][]map[string]string{}
+	for _, s := range services {
+		if name := s["serviceName"]; len(name) > 0 {
+			objects[getListenerObjectKey(listenerAddr, name)] = []map[string]string{s}
+		}
+	}
+	logPrintf("Got configuration from %s.", listenerAddr)
+	if discovery.replaceScope(getListenerObjectKey(listenerAddr, ""), objects) {
+		return m.getReload().Execute(true)
+	}
+	return nil
+}
+
+// applyEvent applies `create` and `remove` events. Other events are ignored.
+func (m *fetch) applyEvent(discovery *serviceSync, listenerAddr string, event *listenerEvent) error {
+	if event.name != "create" && event.name != "remove" {
+		return nil
+	}
+	params := map[string]string{}
+	if err := json.Unmarshal([]byte(event.data), &params); err != nil {
+		return err
+	}
+	name := params["serviceName"]
+	if len(name) == 0 {
+		return fmt.Errorf("serviceName is missing")
+	}
+	key := getListenerObjectKey(listenerAddr, name)
+	changed := false
+	if event.name == "create" {
+		changed = discovery.put(key, []map[string]string{params})
+	} else {
+		changed = discovery.delete(key)
+	}
+	if changed {
+		return m.getReload().Execute(true)
+	}
+	return nil
+}
+
+// getListenerObjectKey returns the key of the service in the sync shared by all the listeners.
+// Keys are prefixed with the address of the listener so that each listener replaces only its own services.
+func getListenerObjectKey(listenerAddr, serviceName string) string {
+	return listenerAddr + "#" + serviceName
+}
+
+func (e *listenerEvent) parseLine(line string) {
+	if strings.HasPrefix(line, ":") {
+		return
+	}
+	field := strings.SplitN(line, ":", 2)
+	value := ""
+	if len(field) == 2 {
+		value = strings.TrimPrefix(field[1], " ")
+	}
+	switch field[0] {
+	case "id":
+		e.id = value
+	case "event":
+		e.name = value
+	case "data":
+		if len(e.data) > 0 {
+			e.data += "\n"
+		}
+		e.data += value
+	}
+}
+
+// removeOrphans removes services that were returned by Swarm Listener in the past but are not returned anymore.
+// Services that were never returned by Swarm Listener (e.g. services sent directly to the `reconfigure` endpoint),
+// services defined through environment variables, services with custom templates, and services configured
+// by other discovery providers are left alone.
+// A service is removed only after it has been missing for at least `RECONCILE_GRACE_PERIOD` seconds.
+// If `RECONCILE_SERVICES` is set to `dry-run`, orphans are only logged.
+// The proxy is not reloaded. The returned value is true if any service was removed.
+func (m *fetch) removeOrphans(baseData BaseReconfigure, services []map[string]string) bool {
+	mode := strings.ToLower(os.Getenv("RECONCILE_SERVICES"))
+	if mode != "true" && mode != "dry-run" {
+		return false
+	}
+	if len(m.getListenerAddrs()) > 1 {
+		m.reconcileSkipped.Do(func() {
+			logPrintf("Warning: RECONCILE_SERVICES is ignored since LISTENER_ADDRESS contains multiple addresses")
+		})
+		return false
+	}
+	gracePeriod, _ := strconv.Atoi(os.Getenv("RECONCILE_GRACE_PERIOD"))
+	listenerServices := map[string]bool{}
+	for _, s := range services {
+		listenerServices[s["serviceName"]] = true
+	}
+	envServices := getEnvVarServiceNames()
+	m.orphans.Lock()
+	defer m.orphans.Unlock()
+	now := time.Now()
+	missing := map[string]time.Time{}
+	removed := false
+	fromListener := map[string]bool{}
+	for name, service := range proxy.Instance.GetServices() {
+		if !m.orphans.fromListener[name] {
+			continue
+		}
+		fromListener[name] = true
+		if listenerServices[name] ||
+			envServices[name] ||
+			service.HasTemplate() ||
+			isDiscoveredService(name) {
+			continue
+		}
+		since, ok := m.orphans.since[name]
+		if !ok {
+			since = now
+		}
+		missing[name] = since
+		if now.Sub(since) < time.Duration(gracePeriod)*time.Second {
+			logPrintf("%s is not returned by Swarm Listener. It will be removed if it is still missing after the grace period.", name)
+			continue
+		}
+		if mode == "dry-run" {
+			logPrintf("%s is not returned by Swarm Listener and would be removed (dry-run)", name)
+			continue
+		}
+		logPrintf("%s is not returned by Swarm Listener and will be removed", name)
+		action := Remove{
+			ServiceName:   name,
+			AclName:       service.AclName,
+			ConfigsPath:   baseData.ConfigsPath,
+			TemplatesPath: baseData.TemplatesPath,
+			InstanceName:  baseData.InstanceName,
+		}
+		if didRemove, err := action.removeConfigsAndService(); err == nil && didRemove {
+			removed = true
+		}
+		delete(missing, name)
+		delete(fromListener, name)
+	}
+	m.orphans.fromListener = fromListener
+	m.orphans.since = missing
+	return removed
+}
+
+// markListenerService records that the service was returned by Swarm Listener so that it can be reconciled later
+func (m *fetch) markListenerService(name string) {
+	m.orphans.Lock()
+	defer m.orphans.Unlock()
+	if m.orphans.fromListener == nil {
+		m.orphans.fromListener = map[string]bool{}
+	}
+	m.orphans.fromListener[name] = true
+}
+
+func (m *fetch) getListenerAddrs() []string {
+	addrs := []string{}
+	for _, addr := range m.listenerAddrs {
+		if len(addr) > 0 {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// getEnvVarServiceNames returns the names of the services defined through `DFP_SERVICE` environment variables
+func getEnvVarServiceNames() map[string]bool {
+	names := map[string]bool{}
+	for _, env := range os.Environ() {
+		keyValue := strings.SplitN(env, "=", 2)
+		if len(keyValue) == 2 && envServiceNameRegexp.MatchString(keyValue[0]) {
+			names[keyValue[1]] = true
+		}
+	}
+	return names
+}
+
 func (m *fetch) getReconfigure(service *proxy.Service) Reconfigurable {
 	return NewReconfigure(m.BaseReconfigure, *service)
 }
@@ -6,10 +6,14 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/docker-flow/docker-flow-proxy/proxy"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -201,3 +205,407 @@ func (s *FetchTestSuite) Test_ReloadConfig_ReturnsError_WhenSwarmListenerFails()
 
 	s.Error(err)
 }
+
+func (s *FetchTestSuite) Test_ReloadConfig_RemovesOrphans_WhenReconcileServicesIsTrue() {
+	defer s.mockReconcileEnv("true", "")()
+	srv := s.getListenerServer("listener-service")
+	defer srv.Close()
+	proxyMock := s.getReconcileProxyMock()
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxy.Instance = proxyMock
+	defer MockReconfigureAndReload(make(chan proxy.Service, 10))()
+
+	err := s.fetch.ReloadConfig(BaseReconfigure{}, srv.URL)
+
+	s.NoError(err)
+	proxyMock.AssertCalled(s.T(), "RemoveService", "orphan-service")
+	proxyMock.AssertNumberOfCalls(s.T(), "RemoveService", 1)
+}
+
+func (s *FetchTestSuite) Test_ReloadConfig_RemovesOrphans_WhenTheyAreMissingAfterBeingReturnedByListener() {
+	defer s.mockReconcileEnv("true", "")()
+	s.fetch.orphans.fromListener = map[string]bool{}
+	srv := s.getListenerServer("orphan-service")
+	proxyMock := s.getReconcileProxyMock()
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxy.Instance = proxyMock
+	defer MockReconfigureAndReload(make(chan proxy.Service, 10))()
+	s.fetch.ReloadConfig(BaseReconfigure{}, srv.URL)
+	srv.Close()
+	srv = s.getListenerServer("listener-service")
+	defer srv.Close()
+
+	s.fetch.ReloadConfig(BaseReconfigure{}, srv.URL)
+
+	proxyMock.AssertCalled(s.T(), "RemoveService", "orphan-service")
+	proxyMock.AssertNumberOfCalls(s.T(), "RemoveService", 1)
+	s.Equal(map[string]bool{"listener-service": true}, s.fetch.orphans.fromListener)
+}
+
+func (s *FetchTestSuite) Test_ReloadConfig_DoesNotRemoveOrphans_WhenReconcileServicesIsNotSet() {
+	defer s.mockReconcileEnv("", "")()
+	srv := s.getListenerServer("listener-service")
+	defer srv.Close()
+	proxyMock := s.getReconcileProxyMock()
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxy.Instance = proxyMock
+	defer MockReconfigureAndReload(make(chan proxy.Service, 10))()
+
+	s.fetch.ReloadConfig(BaseReconfigure{}, srv.URL)
+
+	proxyMock.AssertNotCalled(s.T(), "GetServices")
+	proxyMock.AssertNotCalled(s.T(), "RemoveService", mock.Anything)
+}
+
+func (s *FetchTestSuite) Test_ReloadConfig_DoesNotRemoveOrphans_WhenReconcileServicesIsDryRun() {
+	defer s.mockReconcileEnv("dry-run", "")()
+	srv := s.getListenerServer("listener-service")
+	defer srv.Close()
+	proxyMock := s.getReconcileProxyMock()
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxy.Instance = proxyMock
+	defer MockReconfigureAndReload(make(chan proxy.Service, 10))()
+	logged := []string{}
+	logPrintfOrig := logPrintf
+	defer func() { logPrintf = logPrintfOrig }()
+	logPrintf = func(format string, v ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, v...))
+	}
+
+	s.fetch.ReloadConfig(BaseReconfigure{}, srv.URL)
+
+	proxyMock.AssertNotCalled(s.T(), "RemoveService", mock.Anything)
+	s.Contains(logged, "orphan-service is not returned by Swarm Listener and would be removed (dry-run)")
+}
+
+func (s *FetchTestSuite) Test_ReloadConfig_RemovesOrphans_AfterGracePeriod() {
+	defer s.mockReconcileEnv("true", "60")()
+	srv := s.getListenerServer("listener-service")
+	defer srv.Close()
+	proxyMock := s.getReconcileProxyMock()
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxy.Instance = proxyMock
+	defer MockReconfigureAndReload(make(chan proxy.Service, 10))()
+
+	s.fetch.ReloadConfig(BaseReconfigure{}, srv.URL)
+	proxyMock.AssertNotCalled(s.T(), "RemoveService", mock.Anything)
+
+	s.fetch.orphans.since["orphan-service"] = time.Now().Add(-time.Minute)
+	s.fetch.ReloadConfig(BaseReconfigure{}, srv.URL)
+	proxyMock.AssertCalled(s.T(), "RemoveService", "orphan-service")
+}
+
+func (s *FetchTestSuite) Test_ReloadConfig_DoesNotRemoveOrphans_WhenThereAreMultipleListenerAddresses() {
+	defer s.mockReconcileEnv("true", "")()
+	s.fetch.listenerAddrs = []string{"listener-1", "listener-2"}
+	srv := s.getListenerServer("listener-service")
+	defer srv.Close()
+	proxyMock := s.getReconcileProxyMock()
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxy.Instance = proxyMock
+	defer MockReconfigureAndReload(make(chan proxy.Service, 10))()
+
+	logged := []string{}
+	logPrintfOrig := logPrintf
+	defer func() { logPrintf = logPrintfOrig }()
+	logPrintf = func(format string, v ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, v...))
+	}
+
+	s.fetch.ReloadConfig(BaseReconfigure{}, srv.URL)
+	s.fetch.ReloadConfig(BaseReconfigure{}, srv.URL)
+
+	proxyMock.AssertNotCalled(s.T(), "RemoveService", mock.Anything)
+	warnings := 0
+	for _, line := range logged {
+		if strings.HasPrefix(line, "Warning: RECONCILE_SERVICES is ignored") {
+			warnings++
+		}
+	}
+	s.Equal(1, warnings)
+}
+
+// SubscribeConfig
+
+func (s *FetchTestSuite) Test_SubscribeConfig_ReturnsError_WhenListenerAddressIsEmpty() {
+	err := s.fetch.SubscribeConfig(BaseReconfigure{}, []string{""}, nil, nil)
+
+	s.Error(err)
+}
+
+func (s *FetchTestSuite) Test_SubscribeConfig_AppliesEventsAndResumesAfterDisconnect() {
+	mu := sync.Mutex{}
+	services := []map[string]string{
+		{"serviceName": "api", "servicePath": "/api", "port": "8080"},
+	}
+	events := make(chan string)
+	disconnect := make(chan bool)
+	lastEventIDs := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/docker-flow-swarm-listener/get-services":
+			mu.Lock()
+			js, _ := json.Marshal(services)
+			mu.Unlock()
+			w.Write(js)
+		case "/v1/docker-flow-swarm-listener/events":
+			s.Equal("text/event-stream", r.Header.Get("Accept"))
+			lastEventID := r.Header.Get("Last-Event-ID")
+			lastEventIDs <- lastEventID
+			if lastEventID == "gone" {
+				w.WriteHeader(http.StatusGone)
+				return
+			}
+			w.(http.Flusher).Flush()
+			for {
+				select {
+				case <-r.Context().Done():
+					return
+				case <-disconnect:
+					return
+				case event := <-events:
+					w.Write([]byte(event))
+					w.(http.Flusher).Flush()
+				}
+			}
+		default:
+			s.Fail("Unexpected request to " + r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+	intervalOrig := os.Getenv("RELOAD_INTERVAL")
+	defer func() { os.Setenv("RELOAD_INTERVAL", intervalOrig) }()
+	os.Setenv("RELOAD_INTERVAL", "1")
+	reconfigured := make(chan proxy.Service, 10)
+	defer MockReconfigureAndReload(reconfigured)()
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	removed := make(chan string, 10)
+	proxyMock := getProxyMock("RemoveService")
+	proxyMock.On("RemoveService", mock.Anything).Return(true).Run(func(args mock.Arguments) {
+		removed <- args.String(0)
+	})
+	proxy.Instance = proxyMock
+	osRemoveOrig := osRemove
+	defer func() { osRemove = osRemoveOrig }()
+	osRemove = func(name string) error { return nil }
+	synced := make(chan string, 10)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	go func() {
+		s.fetch.SubscribeConfig(BaseReconfigure{}, []string{srv.URL}, func() { synced <- "synced" }, stop)
+		close(done)
+	}()
+
+	s.Equal("", s.waitForString(lastEventIDs))
+	s.Equal("api", s.waitForReconfigure(reconfigured).ServiceName)
+	s.waitForString(synced)
+
+	events <- ": keep-alive\n\n"
+	events <- "id: 1\nevent: create\ndata: {\"serviceName\": \"web\", \"servicePath\": \"/web\", \"port\": \"80\"}\n\n"
+	s.Equal("web", s.waitForReconfigure(reconfigured).ServiceName)
+	events <- "id: gone\nevent: remove\ndata: {\"serviceName\": \"api\"}\n\n"
+	s.Equal("api", s.waitForString(removed))
+
+	mu.Lock()
+	services = []map[string]string{
+		{"serviceName": "other", "servicePath": "/other", "port": "8080"},
+	}
+	mu.Unlock()
+	disconnect <- true
+	s.Equal("gone", s.waitForString(lastEventIDs))
+	s.Equal("", s.waitForString(lastEventIDs))
+	s.Equal("other", s.waitForReconfigure(reconfigured).ServiceName)
+	s.Equal("web", s.waitForString(removed))
+	s.waitForString(synced)
+}
+
+func (s *FetchTestSuite) Test_SubscribeConfig_SubscribesToAllListeners() {
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	getServer := func(serviceName string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v1/docker-flow-swarm-listener/get-services":
+				js, _ := json.Marshal([]map[string]string{
+					{"serviceName": serviceName, "servicePath": "/" + serviceName, "port": "8080"},
+				})
+				w.Write(js)
+			case "/v1/docker-flow-swarm-listener/events":
+				w.(http.Flusher).Flush()
+				<-r.Context().Done()
+			}
+		}))
+	}
+	srv1 := getServer("api")
+	defer srv1.Close()
+	srv2 := getServer("web")
+	defer srv2.Close()
+	intervalOrig := os.Getenv("RELOAD_INTERVAL")
+	defer func() { os.Setenv("RELOAD_INTERVAL", intervalOrig) }()
+	os.Setenv("RELOAD_INTERVAL", "1")
+	reconfigured := make(chan proxy.Service, 10)
+	defer MockReconfigureAndReload(reconfigured)()
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	go func() {
+		s.fetch.SubscribeConfig(BaseReconfigure{}, []string{unavailable.URL, srv1.URL, srv2.URL}, nil, stop)
+		close(done)
+	}()
+
+	actual := []string{
+		s.waitForReconfigure(reconfigured).ServiceName,
+		s.waitForReconfigure(reconfigured).ServiceName,
+	}
+	sort.Strings(actual)
+	s.Equal([]string{"api", "web"}, actual)
+}
+
+func (s *FetchTestSuite) Test_SubscribeConfig_PollsServices_WhenListenerDoesNotStreamEvents() {
+	mu := sync.Mutex{}
+	services := []map[string]string{
+		{"serviceName": "api", "servicePath": "/api", "port": "8080"},
+	}
+	srv1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/docker-flow-swarm-listener/get-services" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		mu.Lock()
+		js, _ := json.Marshal(services)
+		mu.Unlock()
+		w.Write(js)
+	}))
+	defer srv1.Close()
+	srv2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/docker-flow-swarm-listener/get-services" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		js, _ := json.Marshal([]map[string]string{
+			{"serviceName": "web", "servicePath": "/web", "port": "8080"},
+		})
+		w.Write(js)
+	}))
+	defer srv2.Close()
+	intervalOrig := os.Getenv("RELOAD_INTERVAL")
+	defer func() { os.Setenv("RELOAD_INTERVAL", intervalOrig) }()
+	os.Setenv("RELOAD_INTERVAL", "1")
+	reconfigured := make(chan proxy.Service, 10)
+	defer MockReconfigureAndReload(reconfigured)()
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	removed := make(chan string, 10)
+	proxyMock := getProxyMock("RemoveService")
+	proxyMock.On("RemoveService", mock.Anything).Return(true).Run(func(args mock.Arguments) {
+		removed <- args.String(0)
+	})
+	proxy.Instance = proxyMock
+	osRemoveOrig := osRemove
+	defer func() { osRemove = osRemoveOrig }()
+	osRemove = func(name string) error { return nil }
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	go func() {
+		s.fetch.SubscribeConfig(BaseReconfigure{}, []string{srv1.URL, srv2.URL}, nil, stop)
+		close(done)
+	}()
+
+	actual := []string{
+		s.waitForReconfigure(reconfigured).ServiceName,
+		s.waitForReconfigure(reconfigured).ServiceName,
+	}
+	sort.Strings(actual)
+	s.Equal([]string{"api", "web"}, actual)
+	mu.Lock()
+	services = []map[string]string{}
+	mu.Unlock()
+	s.Equal("api", s.waitForString(removed))
+	select {
+	case name := <-removed:
+		s.Fail("Services of other listeners should not be removed", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func (s *FetchTestSuite) mockReconcileEnv(mode, gracePeriod string) func() {
+	modeOrig := os.Getenv("RECONCILE_SERVICES")
+	gracePeriodOrig := os.Getenv("RECONCILE_GRACE_PERIOD")
+	envServiceOrig := os.Getenv("DFP_SERVICE_1_SERVICE_NAME")
+	os.Setenv("RECONCILE_SERVICES", mode)
+	os.Setenv("RECONCILE_GRACE_PERIOD", gracePeriod)
+	os.Setenv("DFP_SERVICE_1_SERVICE_NAME", "env-service")
+	s.fetch.orphans.since = map[string]time.Time{}
+	s.fetch.orphans.fromListener = map[string]bool{"orphan-service": true, "env-service": true, "template-service": true}
+	return func() {
+		os.Setenv("RECONCILE_SERVICES", modeOrig)
+		os.Setenv("RECONCILE_GRACE_PERIOD", gracePeriodOrig)
+		os.Setenv("DFP_SERVICE_1_SERVICE_NAME", envServiceOrig)
+	}
+}
+
+func (s *FetchTestSuite) getListenerServer(serviceName string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		js, _ := json.Marshal([]map[string]string{
+			{"serviceName": serviceName, "servicePath": "/demo", "port": "8080"},
+		})
+		w.Write(js)
+	}))
+}
+
+func (s *FetchTestSuite) getReconcileProxyMock() *ProxyMock {
+	proxyMock := getProxyMock("GetServices")
+	proxyMock.On("GetServices").Return(map[string]proxy.Service{
+		"listener-service": {ServiceName: "listener-service"},
+		"orphan-service":   {ServiceName: "orphan-service"},
+		"env-service":      {ServiceName: "env-service"},
+		"template-service": {ServiceName: "template-service", TemplateFePath: "/tmpl/fe.tmpl"},
+		"manual-service":   {ServiceName: "manual-service"},
+	})
+	return proxyMock
+}
+
+// Util
+
+func (s *FetchTestSuite) waitForReconfigure(services chan proxy.Service) proxy.Service {
+	select {
+	case service := <-services:
+		return service
+	case <-time.After(5 * time.Second):
+		s.FailNow("Timed out waiting for the service to be reconfigured")
+	}
+	return proxy.Service{}
+}
+
+func (s *FetchTestSuite) waitForString(values chan string) string {
+	select {
+	case value := <-values:
+		return value
+	case <-time.After(5 * time.Second):
+		s.FailNow("Timed out waiting for the value")
+	}
+	return ""
+}
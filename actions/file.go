@@ -0,0 +1,243 @@
+package actions
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v2"
+)
+
+type fileConfig struct {
+	Services []map[string]interface{} `yaml:"services"`
+}
+
+// File reads service definitions from a YAML or JSON file, or from all `*.yml`, `*.yaml`, and `*.json` files in a directory.
+// Files are watched and the proxy is reconfigured, with a single reload, whenever they change.
+// Each service accepts the same parameters as the reconfigure request.
+// Destinations can be specified as a `serviceDest` list instead of indexed parameters (e.g. `port.1`).
+type File struct {
+	BaseReconfigure
+	// The path to a file or a directory with service definitions.
+	Path string
+	// The time to wait for further changes before the proxy is reconfigured.
+	// Editors tend to produce multiple events for a single save.
+	Delay time.Duration
+	sync  *serviceSync
+	// The last valid services of each file. They are kept if a file cannot be parsed.
+	objects map[string][]map[string]string
+}
+
+// NewFile returns a file provider that reads service definitions from the path
+var NewFile = func(baseData BaseReconfigure, path string) Discoverer {
+	return &File{
+		BaseReconfigure: baseData,
+		Path:            filepath.Clean(path),
+		Delay:           500 * time.Millisecond,
+	}
+}
+
+// Run reads service definitions and watches them until the stop channel is closed.
+func (m *File) Run(stop <-chan struct{}) error {
+	if len(m.Path) == 0 || m.Path == "." {
+		return fmt.Errorf("Services config path is missing")
+	}
+	info, err := os.Stat(m.Path)
+	if err != nil {
+		return err
+	}
+	if m.sync == nil {
+		m.sync = newServiceSync(m.BaseReconfigure)
+		m.objects = map[string][]map[string]string{}
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	// Editors often replace files instead of writing to them so the directory is watched even when the path is a file
+	dir := m.Path
+	if !info.IsDir() {
+		dir = filepath.Dir(m.Path)
+	}
+	if err := watcher.Add(dir); err != nil {
+		return err
+	}
+	m.syncFiles()
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-stop:
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if m.isServiceFile(event.Name, info.IsDir()) {
+				timer = time.After(m.Delay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logPrintf("Error: Watching %s failed: %s", m.Path, err.Error())
+		case <-timer:
+			timer = nil
+			m.syncFiles()
+		}
+	}
+}
+
+// syncFiles reads all the files and reconfigures the proxy with the services they contain
+func (m *File) syncFiles() {
+	files, err := m.getFiles()
+	if err != nil {
+		logPrintf("Error: Could not read %s: %s", m.Path, err.Error())
+		return
+	}
+	objects := map[string][]map[string]string{}
+	for _, file := range files {
+		services, err := m.readFile(file)
+		if err != nil {
+			logPrintf("Error: Could not parse %s: %s", file, err.Error())
+			if previous, ok := m.objects[file]; ok {
+				objects[file] = previous
+			}
+			continue
+		}
+		objects[file] = services
+	}
+	m.objects = objects
+	if m.sync.replace(objects) {
+		m.sync.reload()
+	}
+}
+
+func (m *File) getFiles() ([]string, error) {
+	info, err := os.Stat(m.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{m.Path}, nil
+	}
+	entries, err := ioutil.ReadDir(m.Path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, entry := range entries {
+		path := filepath.Join(m.Path, entry.Name())
+		if !entry.IsDir() && m.isServiceFile(path, true) {
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (m *File) isServiceFile(path string, isDir bool) bool {
+	path = filepath.Clean(path)
+	if !isDir {
+		return path == m.Path
+	}
+	if filepath.Dir(path) != m.Path || strings.HasPrefix(filepath.Base(path), ".") {
+		return false
+	}
+	switch filepath.Ext(path) {
+	case ".yml", ".yaml", ".json":
+		return true
+	}
+	return false
+}
+
+func (m *File) readFile(path string) ([]map[string]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := fileConfig{}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return nil, err
+	}
+	services := []map[string]string{}
+	for i, service := range config.Services {
+		params, err := getFileServiceParams(service)
+		if err != nil {
+			return nil, fmt.Errorf("service %d: %s", i+1, err.Error())
+		}
+		if len(params["serviceName"]) == 0 {
+			return nil, fmt.Errorf("service %d: serviceName is missing", i+1)
+		}
+		services = append(services, params)
+	}
+	return services, nil
+}
+
+// getFileServiceParams converts a service definition into reconfigure parameters.
+// Lists are joined with `SEPARATOR` and `serviceDest` entries are converted into indexed parameters.
+func getFileServiceParams(service map[string]interface{}) (map[string]string, error) {
+	params := map[string]string{}
+	for key, value := range service {
+		if key != "serviceDest" {
+			str, err := getFileParamValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", key, err.Error())
+			}
+			params[key] = str
+			continue
+		}
+		dests, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("serviceDest must be a list")
+		}
+		for i, dest := range dests {
+			destParams, ok := dest.(map[interface{}]interface{})
+			if !ok {
+				return nil, fmt.Errorf("serviceDest %d must be a map", i+1)
+			}
+			for destKey, destValue := range destParams {
+				str, err := getFileParamValue(destValue)
+				if err != nil {
+					return nil, fmt.Errorf("serviceDest %d: %v: %s", i+1, destKey, err.Error())
+				}
+				params[fmt.Sprintf("%v.%d", destKey, i+1)] = str
+			}
+		}
+	}
+	return params, nil
+}
+
+func getFileParamValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	case []interface{}:
+		values := []string{}
+		for _, item := range v {
+			str, err := getFileParamValue(item)
+			if err != nil {
+				return "", err
+			}
+			values = append(values, str)
+		}
+		separator := os.Getenv("SEPARATOR")
+		if len(separator) == 0 {
+			separator = ","
+		}
+		return strings.Join(values, separator), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", value)
+}
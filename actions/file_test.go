@@ -0,0 +1,252 @@
+package actions
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker-flow/docker-flow-proxy/proxy"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type FileTestSuite struct {
+	suite.Suite
+	dir          string
+	reconfigured chan proxy.Service
+	removed      chan string
+	reloads      chan bool
+	restore      []func()
+}
+
+func TestFileUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	separatorOrig := os.Getenv("SEPARATOR")
+	defer func() { os.Setenv("SEPARATOR", separatorOrig) }()
+	os.Setenv("SEPARATOR", ",")
+	suite.Run(t, new(FileTestSuite))
+}
+
+func (s *FileTestSuite) SetupTest() {
+	s.dir, _ = ioutil.TempDir("", "dfp-file-test")
+	s.reconfigured = make(chan proxy.Service, 10)
+	s.removed = make(chan string, 10)
+	s.reloads = make(chan bool, 10)
+	newReloadOrig := NewReload
+	s.restore = []func(){MockReconfigureAndReload(s.reconfigured)}
+	proxyOrig := proxy.Instance
+	osRemoveOrig := osRemove
+	s.restore = append(s.restore, func() {
+		NewReload = newReloadOrig
+		proxy.Instance = proxyOrig
+		osRemove = osRemoveOrig
+		os.RemoveAll(s.dir)
+	})
+	NewReload = func() Reloader {
+		s.reloads <- true
+		return &ReloaderMock{}
+	}
+	proxyMock := getProxyMock("RemoveService")
+	proxyMock.On("RemoveService", mock.Anything).Return(true).Run(func(args mock.Arguments) {
+		s.removed <- args.String(0)
+	})
+	proxy.Instance = proxyMock
+	osRemove = func(name string) error { return nil }
+}
+
+func (s *FileTestSuite) TearDownTest() {
+	for _, restore := range s.restore {
+		restore()
+	}
+}
+
+// readFile
+
+func (s *FileTestSuite) Test_ReadFile_ConvertsYaml() {
+	path := s.writeFile("services.yml", `
+services:
+- serviceName: go-demo
+  outboundHostname: 10.100.192.200
+  httpsOnly: true
+  serviceDest:
+  - servicePath: [/demo, /api]
+    port: 8080
+  - servicePath: /admin
+    port: 8081
+`)
+	f := File{Path: s.dir}
+
+	actual, err := f.readFile(path)
+
+	s.NoError(err)
+	s.Equal([]map[string]string{{
+		"serviceName":      "go-demo",
+		"outboundHostname": "10.100.192.200",
+		"httpsOnly":        "true",
+		"servicePath.1":    "/demo,/api",
+		"port.1":           "8080",
+		"servicePath.2":    "/admin",
+		"port.2":           "8081",
+	}}, actual)
+}
+
+func (s *FileTestSuite) Test_ReadFile_ConvertsJson() {
+	path := s.writeFile("services.json", `{"services": [{"serviceName": "go-demo", "servicePath": "/demo", "port": 8080}]}`)
+	f := File{Path: s.dir}
+
+	actual, err := f.readFile(path)
+
+	s.NoError(err)
+	s.Equal([]map[string]string{{
+		"serviceName": "go-demo",
+		"servicePath": "/demo",
+		"port":        "8080",
+	}}, actual)
+}
+
+func (s *FileTestSuite) Test_ReadFile_ReturnsError_WhenServiceNameIsMissing() {
+	path := s.writeFile("services.yml", `
+services:
+- servicePath: /demo
+  port: 8080
+`)
+	f := File{Path: s.dir}
+
+	_, err := f.readFile(path)
+
+	s.Error(err)
+}
+
+func (s *FileTestSuite) Test_ReadFile_ReturnsError_WhenValueIsAMap() {
+	path := s.writeFile("services.yml", `
+services:
+- serviceName: go-demo
+  servicePath:
+    path: /demo
+`)
+	f := File{Path: s.dir}
+
+	_, err := f.readFile(path)
+
+	s.Error(err)
+}
+
+// Run
+
+func (s *FileTestSuite) Test_Run_ReturnsError_WhenPathDoesNotExist() {
+	f := NewFile(BaseReconfigure{}, filepath.Join(s.dir, "missing.yml"))
+
+	err := f.Run(nil)
+
+	s.Error(err)
+}
+
+func (s *FileTestSuite) Test_Run_ReconfiguresAndRemovesServicesFromDirectory() {
+	s.writeFile("demo.yml", `
+services:
+- serviceName: go-demo
+  servicePath: /demo
+  port: 8080
+`)
+	s.writeFile("ignored.txt", `services: [{serviceName: ignored, servicePath: /ignored, port: 80}]`)
+	f := NewFile(BaseReconfigure{}, s.dir).(*File)
+	f.Delay = 10 * time.Millisecond
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	go func() {
+		f.Run(stop)
+		close(done)
+	}()
+
+	actual := s.waitForService()
+	s.Equal("go-demo", actual.ServiceName)
+	s.waitForReload()
+
+	s.writeFile("jenkins.json", `{"services": [
+		{"serviceName": "jenkins", "servicePath": "/jenkins", "port": 8080},
+		{"serviceName": "nexus", "servicePath": "/nexus", "port": 8081}
+	]}`)
+	names := []string{s.waitForService().ServiceName, s.waitForService().ServiceName}
+	s.ElementsMatch([]string{"jenkins", "nexus"}, names)
+	s.waitForReload()
+	s.Len(s.reloads, 0)
+
+	os.Remove(filepath.Join(s.dir, "demo.yml"))
+	select {
+	case name := <-s.removed:
+		s.Equal("go-demo", name)
+	case <-time.After(5 * time.Second):
+		s.Fail("Timed out waiting for the service to be removed")
+	}
+	s.waitForReload()
+}
+
+func (s *FileTestSuite) Test_Run_KeepsServices_WhenFileCannotBeParsed() {
+	path := s.writeFile("demo.yml", `
+services:
+- serviceName: go-demo
+  servicePath: /demo
+  port: 8080
+`)
+	f := NewFile(BaseReconfigure{}, path).(*File)
+	f.Delay = 10 * time.Millisecond
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	go func() {
+		f.Run(stop)
+		close(done)
+	}()
+	s.waitForService()
+	s.waitForReload()
+
+	s.writeFile("demo.yml", `services: [`)
+	time.Sleep(100 * time.Millisecond)
+	s.writeFile("demo.yml", `
+services:
+- serviceName: go-demo
+  servicePath: /demo/v2
+  port: 8080
+`)
+
+	actual := s.waitForService()
+	s.Equal([]string{"/demo/v2"}, actual.ServiceDest[0].ServicePath)
+	s.Len(s.removed, 0)
+}
+
+// Util
+
+func (s *FileTestSuite) writeFile(name, content string) string {
+	path := filepath.Join(s.dir, name)
+	ioutil.WriteFile(path, []byte(content), 0644)
+	return path
+}
+
+func (s *FileTestSuite) waitForService() proxy.Service {
+	select {
+	case service := <-s.reconfigured:
+		return service
+	case <-time.After(5 * time.Second):
+		s.FailNow("Timed out waiting for the service to be reconfigured")
+	}
+	return proxy.Service{}
+}
+
+func (s *FileTestSuite) waitForReload() {
+	select {
+	case <-s.reloads:
+	case <-time.After(5 * time.Second):
+		s.FailNow("Timed out waiting for the proxy to be reloaded")
+	}
+}
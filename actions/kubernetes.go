@@ -0,0 +1,387 @@
+package actions
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const kubernetesAnnotationPrefix = "com.df."
+const kubernetesServiceAccountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+type kubernetesMetadata struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	ResourceVersion string            `json:"resourceVersion"`
+	Annotations     map[string]string `json:"annotations"`
+}
+
+type kubernetesServiceBackend struct {
+	Name string `json:"name"`
+	Port struct {
+		Name   string `json:"name"`
+		Number int    `json:"number"`
+	} `json:"port"`
+}
+
+type kubernetesIngressBackend struct {
+	Service *kubernetesServiceBackend `json:"service"`
+}
+
+type kubernetesIngressPath struct {
+	Path     string                   `json:"path"`
+	PathType string                   `json:"pathType"`
+	Backend  kubernetesIngressBackend `json:"backend"`
+}
+
+type kubernetesHTTPIngressRuleValue struct {
+	Paths []kubernetesIngressPath `json:"paths"`
+}
+
+type kubernetesIngressRule struct {
+	Host string                          `json:"host"`
+	HTTP *kubernetesHTTPIngressRuleValue `json:"http"`
+}
+
+type kubernetesServicePort struct {
+	Name string `json:"name"`
+	Port int    `json:"port"`
+}
+
+type kubernetesObject struct {
+	Metadata kubernetesMetadata `json:"metadata"`
+	Spec     struct {
+		// Ingress
+		IngressClassName string                    `json:"ingressClassName"`
+		DefaultBackend   *kubernetesIngressBackend `json:"defaultBackend"`
+		Rules            []kubernetesIngressRule   `json:"rules"`
+		// Service
+		Ports []kubernetesServicePort `json:"ports"`
+	} `json:"spec"`
+}
+
+type kubernetesList struct {
+	Metadata kubernetesMetadata `json:"metadata"`
+	Items    []kubernetesObject `json:"items"`
+}
+
+type kubernetesEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+type kubernetesResource struct {
+	kind     string
+	path     string
+	toParams func(obj *kubernetesObject) []map[string]string
+	sync     *serviceSync
+}
+
+// Kubernetes watches Ingress (and, optionally, annotated Service) objects through the Kubernetes API
+// and reconfigures the proxy whenever they change.
+type Kubernetes struct {
+	BaseReconfigure
+	// The address of the Kubernetes API (e.g. https://kubernetes.default.svc).
+	Address string
+	// The namespace to watch. All namespaces are watched if empty.
+	Namespace string
+	// If set, only Ingress objects of that class are used.
+	IngressClass string
+	// Whether to watch Service objects with the `com.df.notify` annotation set to `true`.
+	WatchServices bool
+	// The pause between two attempts to contact the API after a failure.
+	RetryInterval time.Duration
+	token         string
+	client        *http.Client
+}
+
+// NewKubernetes returns a Kubernetes discovery provider configured through environment variables
+var NewKubernetes = func(baseData BaseReconfigure, address string) Discoverer {
+	watchServices, _ := strconv.ParseBool(os.Getenv("KUBERNETES_WATCH_SERVICES"))
+	k := &Kubernetes{
+		BaseReconfigure: baseData,
+		Address:         strings.TrimRight(address, "/"),
+		Namespace:       os.Getenv("KUBERNETES_NAMESPACE"),
+		IngressClass:    os.Getenv("KUBERNETES_INGRESS_CLASS"),
+		WatchServices:   watchServices,
+		RetryInterval:   getRetryInterval(),
+		client:          &http.Client{},
+	}
+	if token, err := readKubernetesFile(kubernetesServiceAccountPath + "/token"); err == nil {
+		k.token = strings.TrimSpace(string(token))
+	}
+	if ca, err := readKubernetesFile(kubernetesServiceAccountPath + "/ca.crt"); err == nil {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca)
+		k.client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+	return k
+}
+
+// Run lists and watches Kubernetes objects until the stop channel is closed.
+// Connection problems are logged and retried.
+func (m *Kubernetes) Run(stop <-chan struct{}) error {
+	if len(m.Address) == 0 {
+		return fmt.Errorf("Kubernetes API address is missing")
+	}
+	resources := []*kubernetesResource{{
+		kind:     "ingress",
+		path:     "/apis/networking.k8s.io/v1" + m.namespacePath() + "/ingresses",
+		toParams: m.getIngressParams,
+		sync:     newServiceSync(m.BaseReconfigure),
+	}}
+	if m.WatchServices {
+		resources = append(resources, &kubernetesResource{
+			kind:     "service",
+			path:     "/api/v1" + m.namespacePath() + "/services",
+			toParams: m.getServiceParams,
+			sync:     newServiceSync(m.BaseReconfigure),
+		})
+	}
+	done := make(chan struct{}, len(resources))
+	for _, r := range resources {
+		go func(r *kubernetesResource) {
+			m.watchResource(r, stop)
+			done <- struct{}{}
+		}(r)
+	}
+	for range resources {
+		<-done
+	}
+	return nil
+}
+
+func (m *Kubernetes) namespacePath() string {
+	if len(m.Namespace) == 0 {
+		return ""
+	}
+	return "/namespaces/" + m.Namespace
+}
+
+func (m *Kubernetes) watchResource(r *kubernetesResource, stop <-chan struct{}) {
+	watchRegistry(stop, fmt.Sprintf("Kubernetes %s objects", r.kind), m.RetryInterval, func(ctx context.Context) error {
+		resourceVersion, err := m.list(ctx, r)
+		if err != nil {
+			return err
+		}
+		return m.watch(ctx, r, resourceVersion)
+	})
+}
+
+// list fetches all the objects and synchronizes the proxy with them.
+// It returns the resource version the watch should start from.
+func (m *Kubernetes) list(ctx context.Context, r *kubernetesResource) (string, error) {
+	resp, err := m.get(ctx, r.path)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	list := kubernetesList{}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return "", err
+	}
+	objects := map[string][]map[string]string{}
+	for i := range list.Items {
+		obj := &list.Items[i]
+		objects[m.getKey(obj)] = r.toParams(obj)
+	}
+	logPrintf("Got %d Kubernetes %s objects", len(list.Items), r.kind)
+	if r.sync.replace(objects) {
+		r.sync.reload()
+	}
+	return list.Metadata.ResourceVersion, nil
+}
+
+// watch applies the changes streamed by the API until the stream is closed or fails.
+func (m *Kubernetes) watch(ctx context.Context, r *kubernetesResource, resourceVersion string) error {
+	path := fmt.Sprintf("%s?watch=true&resourceVersion=%s", r.path, resourceVersion)
+	resp, err := m.get(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		event := kubernetesEvent{}
+		if err := decoder.Decode(&event); err != nil {
+			if ctx.Err() != nil || err == io.EOF {
+				// The API closes watches periodically; the objects are listed again
+				return nil
+			}
+			return err
+		}
+		if event.Type == "ERROR" {
+			// Usually "410 Gone" meaning that the resource version is too old; the objects are listed again
+			return fmt.Errorf("Kubernetes API watch error %s", string(event.Object))
+		}
+		obj := kubernetesObject{}
+		if err := json.Unmarshal(event.Object, &obj); err != nil {
+			return err
+		}
+		changed := false
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			changed = r.sync.put(m.getKey(&obj), r.toParams(&obj))
+		case "DELETED":
+			changed = r.sync.delete(m.getKey(&obj))
+		}
+		if changed {
+			r.sync.reload()
+		}
+	}
+}
+
+func (m *Kubernetes) get(ctx context.Context, path string) (*http.Response, error) {
+	header := http.Header{}
+	if len(m.token) > 0 {
+		header.Set("Authorization", "Bearer "+m.token)
+	}
+	return getFromRegistry(ctx, m.client, m.Address+path, header, "Kubernetes API")
+}
+
+func (m *Kubernetes) getKey(obj *kubernetesObject) string {
+	return fmt.Sprintf("%s/%s", obj.Metadata.Namespace, obj.Metadata.Name)
+}
+
+// getIngressParams translates an Ingress into reconfigure parameters.
+// Each backend service referenced by the Ingress becomes a proxy service with one destination per rule path.
+// Annotations prefixed with `com.df.` are added to each of the services.
+func (m *Kubernetes) getIngressParams(obj *kubernetesObject) []map[string]string {
+	if len(m.IngressClass) > 0 {
+		class := obj.Spec.IngressClassName
+		if len(class) == 0 {
+			class = obj.Metadata.Annotations["kubernetes.io/ingress.class"]
+		}
+		if class != m.IngressClass {
+			return nil
+		}
+	}
+	services := []map[string]string{}
+	byName := map[string]map[string]string{}
+	addDest := func(backend *kubernetesIngressBackend, host, path, pathType string) {
+		if backend == nil || backend.Service == nil || len(backend.Service.Name) == 0 {
+			return
+		}
+		name := backend.Service.Name
+		port := strconv.Itoa(backend.Service.Port.Number)
+		if backend.Service.Port.Number <= 0 {
+			resolved, err := m.getServicePort(obj.Metadata.Namespace, name, backend.Service.Port.Name)
+			if err != nil {
+				logPrintf("Error: The path %s of the Ingress %s is skipped: %s", path, m.getKey(obj), err.Error())
+				return
+			}
+			port = resolved
+		}
+		params, ok := byName[name]
+		if !ok {
+			params = m.getAnnotationParams(obj)
+			params["serviceName"] = m.getServiceName(obj.Metadata.Namespace, name)
+			if _, ok := params["outboundHostname"]; !ok {
+				params["outboundHostname"] = fmt.Sprintf("%s.%s", name, obj.Metadata.Namespace)
+			}
+			byName[name] = params
+			services = append(services, params)
+		}
+		index := 1
+		for len(params[fmt.Sprintf("port.%d", index)]) > 0 {
+			index++
+		}
+		if index > 10 {
+			logPrintf("Ingress %s has more than 10 paths for the service %s. The rest are ignored.", m.getKey(obj), name)
+			return
+		}
+		if len(path) == 0 {
+			path = "/"
+		}
+		params[fmt.Sprintf("port.%d", index)] = port
+		params[fmt.Sprintf("servicePath.%d", index)] = path
+		if strings.EqualFold(pathType, "Exact") {
+			params[fmt.Sprintf("pathType.%d", index)] = "path"
+		} else if strings.EqualFold(pathType, "Prefix") {
+			params[fmt.Sprintf("pathType.%d", index)] = "path_beg"
+		}
+		if len(host) > 0 {
+			params[fmt.Sprintf("serviceDomain.%d", index)] = host
+		}
+	}
+	for _, rule := range obj.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for i := range rule.HTTP.Paths {
+			p := &rule.HTTP.Paths[i]
+			addDest(&p.Backend, rule.Host, p.Path, p.PathType)
+		}
+	}
+	addDest(obj.Spec.DefaultBackend, "", "/", "Prefix")
+	return services
+}
+
+// getServiceParams translates a Service with the `com.df.notify` annotation into reconfigure parameters.
+// The service name and the port default to the name and the first port of the Service.
+func (m *Kubernetes) getServiceParams(obj *kubernetesObject) []map[string]string {
+	if !strings.EqualFold(obj.Metadata.Annotations[kubernetesAnnotationPrefix+"notify"], "true") {
+		return nil
+	}
+	params := m.getAnnotationParams(obj)
+	delete(params, "notify")
+	if len(params["serviceName"]) == 0 {
+		params["serviceName"] = m.getServiceName(obj.Metadata.Namespace, obj.Metadata.Name)
+	}
+	if len(params["port"]) == 0 && len(obj.Spec.Ports) > 0 {
+		params["port"] = strconv.Itoa(obj.Spec.Ports[0].Port)
+	}
+	if _, ok := params["outboundHostname"]; !ok {
+		params["outboundHostname"] = fmt.Sprintf("%s.%s", obj.Metadata.Name, obj.Metadata.Namespace)
+	}
+	return []map[string]string{params}
+}
+
+// getServiceName returns the name of the proxy service prefixed with the namespace
+// so that services with the same name in different namespaces do not collide
+func (m *Kubernetes) getServiceName(namespace, name string) string {
+	if len(namespace) == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s-%s", namespace, name)
+}
+
+// getServicePort returns the number of the port of the Service with the name
+func (m *Kubernetes) getServicePort(namespace, serviceName, portName string) (string, error) {
+	if len(portName) == 0 {
+		return "", fmt.Errorf("The port of the service %s is not specified", serviceName)
+	}
+	resp, err := m.get(context.Background(), fmt.Sprintf("/api/v1/namespaces/%s/services/%s", namespace, serviceName))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	obj := kubernetesObject{}
+	if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		return "", err
+	}
+	for _, port := range obj.Spec.Ports {
+		if port.Name == portName {
+			return strconv.Itoa(port.Port), nil
+		}
+	}
+	return "", fmt.Errorf("The service %s does not have the port %s", serviceName, portName)
+}
+
+func (m *Kubernetes) getAnnotationParams(obj *kubernetesObject) map[string]string {
+	params := map[string]string{}
+	for key, value := range obj.Metadata.Annotations {
+		if strings.HasPrefix(key, kubernetesAnnotationPrefix) {
+			params[strings.TrimPrefix(key, kubernetesAnnotationPrefix)] = value
+		}
+	}
+	return params
+}
@@ -0,0 +1,344 @@
+package actions
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/docker-flow/docker-flow-proxy/proxy"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type KubernetesTestSuite struct {
+	suite.Suite
+	base BaseReconfigure
+}
+
+func TestKubernetesUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	separatorOrig := os.Getenv("SEPARATOR")
+	defer func() { os.Setenv("SEPARATOR", separatorOrig) }()
+	os.Setenv("SEPARATOR", ",")
+	suite.Run(t, new(KubernetesTestSuite))
+}
+
+func (s *KubernetesTestSuite) SetupTest() {
+	s.base = BaseReconfigure{
+		ConfigsPath:   "/cfg",
+		InstanceName:  "docker-flow",
+		TemplatesPath: "/cfg/tmpl",
+	}
+}
+
+// getIngressParams
+
+func (s *KubernetesTestSuite) Test_GetIngressParams_CreatesDestinationPerPath() {
+	obj := s.getIngress("my-ingress", "my-ns", map[string]string{
+		"com.df.httpsOnly": "true",
+		"other.annotation": "ignored",
+	}, []kubernetesIngressRule{
+		s.getRule("my-domain.com", "/api", "Prefix", "api", 8080),
+		s.getRule("my-domain.com", "/health", "Exact", "api", 8081),
+		s.getRule("", "/web", "", "web", 80),
+	})
+	k := Kubernetes{}
+
+	actual := k.getIngressParams(&obj)
+
+	s.Equal([]map[string]string{
+		{
+			"serviceName":      "my-ns-api",
+			"outboundHostname": "api.my-ns",
+			"httpsOnly":        "true",
+			"port.1":           "8080",
+			"servicePath.1":    "/api",
+			"pathType.1":       "path_beg",
+			"serviceDomain.1":  "my-domain.com",
+			"port.2":           "8081",
+			"servicePath.2":    "/health",
+			"pathType.2":       "path",
+			"serviceDomain.2":  "my-domain.com",
+		},
+		{
+			"serviceName":      "my-ns-web",
+			"outboundHostname": "web.my-ns",
+			"httpsOnly":        "true",
+			"port.1":           "80",
+			"servicePath.1":    "/web",
+		},
+	}, actual)
+}
+
+func (s *KubernetesTestSuite) Test_GetIngressParams_ProducesServicesAcceptedByGetServiceFromMap() {
+	obj := s.getIngress("my-ingress", "my-ns", nil, []kubernetesIngressRule{
+		s.getRule("my-domain.com", "/api", "Prefix", "api", 8080),
+	})
+	k := Kubernetes{}
+
+	params := k.getIngressParams(&obj)
+	actual := proxy.GetServiceFromMap(&params[0])
+
+	s.Equal("my-ns-api", actual.ServiceName)
+	s.Equal("8080", actual.ServiceDest[0].Port)
+	s.Equal([]string{"/api"}, actual.ServiceDest[0].ServicePath)
+	s.Equal([]string{"my-domain.com"}, actual.ServiceDest[0].ServiceDomain)
+	s.Equal("api.my-ns", actual.ServiceDest[0].OutboundHostname)
+}
+
+func (s *KubernetesTestSuite) Test_GetIngressParams_ResolvesNamedPorts() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("/api/v1/namespaces/my-ns/services/api", r.URL.Path)
+		obj := kubernetesObject{}
+		obj.Spec.Ports = []kubernetesServicePort{{Name: "metrics", Port: 9090}, {Name: "http", Port: 8080}}
+		js, _ := json.Marshal(obj)
+		w.Write(js)
+	}))
+	defer srv.Close()
+	rule := s.getRule("", "/api", "Prefix", "api", 0)
+	rule.HTTP.Paths[0].Backend.Service.Port.Name = "http"
+	obj := s.getIngress("my-ingress", "my-ns", nil, []kubernetesIngressRule{rule})
+	k := Kubernetes{Address: srv.URL, client: &http.Client{}}
+
+	actual := k.getIngressParams(&obj)
+
+	s.Require().Len(actual, 1)
+	s.Equal("8080", actual[0]["port.1"])
+}
+
+func (s *KubernetesTestSuite) Test_GetIngressParams_SkipsPath_WhenNamedPortCannotBeResolved() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+	rule := s.getRule("", "/api", "Prefix", "api", 0)
+	rule.HTTP.Paths[0].Backend.Service.Port.Name = "http"
+	obj := s.getIngress("my-ingress", "my-ns", nil, []kubernetesIngressRule{
+		rule,
+		s.getRule("", "/web", "Prefix", "web", 80),
+	})
+	k := Kubernetes{Address: srv.URL, client: &http.Client{}}
+
+	actual := k.getIngressParams(&obj)
+
+	s.Require().Len(actual, 1)
+	s.Equal("my-ns-web", actual[0]["serviceName"])
+}
+
+func (s *KubernetesTestSuite) Test_GetIngressParams_PrefixesServiceNamesWithNamespaces() {
+	obj1 := s.getIngress("my-ingress", "ns-1", nil, []kubernetesIngressRule{
+		s.getRule("", "/api", "Prefix", "api", 8080),
+	})
+	obj2 := s.getIngress("my-ingress", "ns-2", nil, []kubernetesIngressRule{
+		s.getRule("", "/api", "Prefix", "api", 8080),
+	})
+	k := Kubernetes{}
+
+	actual1 := k.getIngressParams(&obj1)
+	actual2 := k.getIngressParams(&obj2)
+
+	s.Equal("ns-1-api", actual1[0]["serviceName"])
+	s.Equal("ns-2-api", actual2[0]["serviceName"])
+}
+
+func (s *KubernetesTestSuite) Test_GetIngressParams_ReturnsNil_WhenIngressClassDoesNotMatch() {
+	obj := s.getIngress("my-ingress", "my-ns", map[string]string{
+		"kubernetes.io/ingress.class": "nginx",
+	}, []kubernetesIngressRule{
+		s.getRule("", "/api", "Prefix", "api", 8080),
+	})
+	k := Kubernetes{IngressClass: "dfp"}
+
+	actual := k.getIngressParams(&obj)
+
+	s.Empty(actual)
+}
+
+// getServiceParams
+
+func (s *KubernetesTestSuite) Test_GetServiceParams_ReturnsNil_WhenNotifyAnnotationIsNotSet() {
+	obj := kubernetesObject{}
+	obj.Metadata.Name = "api"
+	k := Kubernetes{}
+
+	actual := k.getServiceParams(&obj)
+
+	s.Empty(actual)
+}
+
+func (s *KubernetesTestSuite) Test_GetServiceParams_UsesNameAndFirstPort() {
+	obj := kubernetesObject{}
+	obj.Metadata.Name = "api"
+	obj.Metadata.Namespace = "my-ns"
+	obj.Metadata.Annotations = map[string]string{
+		"com.df.notify":      "true",
+		"com.df.servicePath": "/api",
+	}
+	obj.Spec.Ports = []kubernetesServicePort{{Name: "http", Port: 8080}}
+	k := Kubernetes{}
+
+	actual := k.getServiceParams(&obj)
+
+	s.Equal([]map[string]string{{
+		"serviceName":      "my-ns-api",
+		"servicePath":      "/api",
+		"port":             "8080",
+		"outboundHostname": "api.my-ns",
+	}}, actual)
+}
+
+// Run
+
+func (s *KubernetesTestSuite) Test_Run_ReturnsError_WhenAddressIsEmpty() {
+	k := Kubernetes{}
+
+	err := k.Run(nil)
+
+	s.Error(err)
+}
+
+func (s *KubernetesTestSuite) Test_Run_ReconfiguresAndRemovesServices() {
+	events := make(chan kubernetesEvent)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("Bearer my-token", r.Header.Get("Authorization"))
+		s.Equal("/apis/networking.k8s.io/v1/namespaces/my-ns/ingresses", r.URL.Path)
+		if r.URL.Query().Get("watch") != "true" {
+			list := kubernetesList{Items: []kubernetesObject{
+				s.getIngress("my-ingress", "my-ns", nil, []kubernetesIngressRule{
+					s.getRule("", "/api", "Prefix", "api", 8080),
+				}),
+			}}
+			list.Metadata.ResourceVersion = "10"
+			js, _ := json.Marshal(list)
+			w.Write(js)
+			return
+		}
+		s.Equal("10", r.URL.Query().Get("resourceVersion"))
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event := <-events:
+				js, _ := json.Marshal(event)
+				w.Write(js)
+				w.(http.Flusher).Flush()
+			}
+		}
+	}))
+	defer srv.Close()
+	reconfigured := make(chan proxy.Service, 10)
+	defer MockReconfigureAndReload(reconfigured)()
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	removed := make(chan string, 10)
+	proxyMock := getProxyMock("RemoveService")
+	proxyMock.On("RemoveService", mock.Anything).Return(true).Run(func(args mock.Arguments) {
+		removed <- args.String(0)
+	})
+	proxy.Instance = proxyMock
+	osRemoveOrig := osRemove
+	defer func() { osRemove = osRemoveOrig }()
+	osRemove = func(name string) error { return nil }
+	k := Kubernetes{
+		BaseReconfigure: s.base,
+		Address:         srv.URL,
+		Namespace:       "my-ns",
+		RetryInterval:   time.Millisecond,
+		token:           "my-token",
+		client:          &http.Client{},
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	go func() {
+		k.Run(stop)
+		close(done)
+	}()
+
+	actual := s.waitForService(reconfigured)
+	s.Equal("my-ns-api", actual.ServiceName)
+	s.Equal([]string{"/api"}, actual.ServiceDest[0].ServicePath)
+
+	obj := s.getIngress("my-ingress", "my-ns", nil, []kubernetesIngressRule{
+		s.getRule("", "/api/v2", "Prefix", "api", 8080),
+	})
+	js, _ := json.Marshal(obj)
+	events <- kubernetesEvent{Type: "MODIFIED", Object: js}
+	actual = s.waitForService(reconfigured)
+	s.Equal([]string{"/api/v2"}, actual.ServiceDest[0].ServicePath)
+
+	events <- kubernetesEvent{Type: "DELETED", Object: js}
+	select {
+	case name := <-removed:
+		s.Equal("my-ns-api", name)
+	case <-time.After(5 * time.Second):
+		s.Fail("Timed out waiting for the service to be removed")
+	}
+}
+
+// Util
+
+func (s *KubernetesTestSuite) getIngress(name, namespace string, annotations map[string]string, rules []kubernetesIngressRule) kubernetesObject {
+	obj := kubernetesObject{}
+	obj.Metadata.Name = name
+	obj.Metadata.Namespace = namespace
+	obj.Metadata.Annotations = annotations
+	obj.Spec.Rules = rules
+	return obj
+}
+
+func (s *KubernetesTestSuite) getRule(host, path, pathType, serviceName string, port int) kubernetesIngressRule {
+	backend := kubernetesServiceBackend{Name: serviceName}
+	backend.Port.Number = port
+	rule := kubernetesIngressRule{Host: host}
+	rule.HTTP = &kubernetesHTTPIngressRuleValue{Paths: []kubernetesIngressPath{{
+		Path:     path,
+		PathType: pathType,
+		Backend:  kubernetesIngressBackend{Service: &backend},
+	}}}
+	return rule
+}
+
+func (s *KubernetesTestSuite) waitForService(services chan proxy.Service) proxy.Service {
+	select {
+	case service := <-services:
+		return service
+	case <-time.After(5 * time.Second):
+		s.FailNow("Timed out waiting for the service to be reconfigured")
+	}
+	return proxy.Service{}
+}
+
+// Mock
+
+// MockReconfigureAndReload replaces NewReconfigure and NewReload with mocks.
+// Each reconfigured service is sent to the channel.
+func MockReconfigureAndReload(services chan proxy.Service) func() {
+	newReconfigureOrig := NewReconfigure
+	newReloadOrig := NewReload
+	NewReconfigure = func(baseData BaseReconfigure, serviceData proxy.Service) Reconfigurable {
+		services <- serviceData
+		return getReconfigureMock("")
+	}
+	NewReload = func() Reloader {
+		return &ReloaderMock{}
+	}
+	return func() {
+		NewReconfigure = newReconfigureOrig
+		NewReload = newReloadOrig
+	}
+}
+
+type ReloaderMock struct{}
+
+func (m *ReloaderMock) Execute(recreate bool) error {
+	return nil
+}
@@ -76,7 +76,7 @@ func (m *Reconfigure) Execute(reloadAfter bool) error {
 	if reloadAfter {
 		reload := reload{}
 		if err := reload.Execute(true); err != nil {
-			logPrintf(err.Error())
+			logPrintf("%s", err.Error())
 			action := NewRemove(
 				m.Service.ServiceName,
 				m.Service.AclName,
@@ -98,9 +98,7 @@ func (m *Reconfigure) createConfigsAddService() error {
 	if err := m.createConfigs(); err != nil {
 		return err
 	}
-	if !m.hasTemplate() {
-		proxy.Instance.AddService(m.Service)
-	}
+	proxy.Instance.AddService(m.Service)
 	return nil
 }
 
@@ -116,21 +114,33 @@ func (m *Reconfigure) GetTemplates() (front, back string, err error) {
 		sr.CheckResolvers = value
 	}
 	proxy.FormatServiceForTemplates(sr)
-	if len(sr.TemplateFePath) > 0 {
-		feTmpl, err := readTemplateFile(sr.TemplateFePath)
+	fePath := sr.TemplateFePath
+	if len(sr.TemplateFeName) > 0 {
+		fePath = proxy.GetServiceTemplatePath(sr.TemplateFeName, "frontend")
+	}
+	bePath := sr.TemplateBePath
+	if len(sr.TemplateBeName) > 0 {
+		bePath = proxy.GetServiceTemplatePath(sr.TemplateBeName, "backend")
+	}
+	if len(fePath) > 0 {
+		feTmpl, err := readTemplateFile(fePath)
 		if err != nil {
 			return "", "", err
 		}
-		front = m.parseFrontTemplate(string(feTmpl), sr)
+		if front, err = ParseTemplate(fePath, string(feTmpl), sr); err != nil {
+			return "", "", err
+		}
 	}
-	if len(sr.TemplateBePath) > 0 {
-		beTmpl, err := readTemplateFile(sr.TemplateBePath)
+	if len(bePath) > 0 {
+		beTmpl, err := readTemplateFile(bePath)
 		if err != nil {
 			return "", "", err
 		}
-		back = m.parseBackTemplate(string(beTmpl), "", sr)
-	} else {
-		back = m.parseBackTemplate(proxy.GetBackTemplate(sr), m.getUsersList(sr), sr)
+		if back, err = ParseTemplate(bePath, string(beTmpl), sr); err != nil {
+			return "", "", err
+		}
+	} else if back, err = proxy.GetBackend(sr); err != nil {
+		return "", "", err
 	}
 	return front, back, nil
 }
@@ -146,6 +156,9 @@ func (m *Reconfigure) createConfigs() error {
 	if len(sr.AclName) == 0 {
 		sr.AclName = sr.ServiceName
 	}
+	if err := proxy.WriteErrorPages(sr); err != nil {
+		return err
+	}
 	destFe := fmt.Sprintf("%s/%s-fe.cfg", templatesPath, sr.AclName)
 	writeFeTemplate(destFe, []byte(feTemplate), 0664)
 	destBe := fmt.Sprintf("%s/%s-be.cfg", templatesPath, sr.AclName)
@@ -153,35 +166,20 @@ func (m *Reconfigure) createConfigs() error {
 	return nil
 }
 
-func (m *Reconfigure) getUsersList(sr *proxy.Service) string {
-	if len(sr.Users) > 0 {
-		return `userlist {{.ServiceName}}Users{{range .Users}}
-    user {{.Username}} {{if .PassEncrypted}}password{{end}}{{if not .PassEncrypted}}insecure-password{{end}} {{.Password}}{{end}}
-
-`
+// ParseTemplate executes a custom frontend or backend template with the data of the service.
+// The name of the template (usually the path of the file it was read from) and the line
+// that caused the error are part of the returned errors.
+func ParseTemplate(name, src string, sr *proxy.Service) (string, error) {
+	if len(src) == 0 {
+		return "", nil
 	}
-	return ""
-}
-
-func (m *Reconfigure) parseFrontTemplate(src string, sr *proxy.Service) string {
-	var buf bytes.Buffer
-	if len(src) > 0 {
-		tmpl, _ := template.New("").Parse(src)
-		tmpl.Execute(&buf, sr)
+	tmpl, err := template.New(name).Parse(src)
+	if err != nil {
+		return "", err
 	}
-	return buf.String()
-}
-
-func (m *Reconfigure) parseBackTemplate(src, usersList string, sr *proxy.Service) string {
-	tmplUsersList, _ := template.New("template").Parse(usersList)
-	tmpl, _ := template.New("").Parse(src)
-	var bufUsersList bytes.Buffer
 	var buf bytes.Buffer
-	tmplUsersList.Execute(&bufUsersList, sr)
-	tmpl.Execute(&buf, sr)
-	return bufUsersList.String() + buf.String()
-}
-
-func (m *Reconfigure) hasTemplate() bool {
-	return len(m.TemplateBePath) != 0 || len(m.TemplateFePath) != 0
+	if err := tmpl.Execute(&buf, sr); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
 }
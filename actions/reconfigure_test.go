@@ -2,6 +2,7 @@ package actions
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"testing"
 
@@ -574,6 +575,64 @@ backend myService-be1234_0
 	s.Equal(expected, backend)
 }
 
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsErrorPages() {
+	s.reconfigure.ServiceDest = []proxy.ServiceDest{{Port: "1234", Index: 0}}
+	s.reconfigure.ErrorPages = []proxy.ErrorPage{
+		{Code: 503, Content: "Be right back"},
+		{Code: 504, Location: "https://status.example.com"},
+	}
+	expected := `
+backend myService-be1234_0
+    mode http
+    http-request add-header X-Forwarded-Proto https if { ssl_fc }
+    server myService myService:1234
+    errorfile 503 /errorfiles/services/myService/503.http
+    errorloc302 504 https://status.example.com`
+
+	_, backend, _ := s.reconfigure.GetTemplates()
+
+	s.Equal(expected, backend)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsMaintenance() {
+	defer proxy.SetMaintenance("myService", nil)
+	proxy.SetMaintenance("myService", &proxy.Maintenance{AllowedIPs: []string{"10.0.0.1", "10.1.0.0/16"}, Body: "Maintenance"})
+	s.reconfigure.ServiceDest = []proxy.ServiceDest{{Port: "1234", Index: 0}}
+	s.reconfigure.ErrorPages = []proxy.ErrorPage{
+		{Code: 503, Content: "Be right back"},
+		{Code: 504, Content: "Timeout"},
+	}
+	expected := `
+backend myService-be1234_0
+    mode http
+    http-request add-header X-Forwarded-Proto https if { ssl_fc }
+    acl maintenance_allowed src 10.0.0.1 10.1.0.0/16
+    http-request deny deny_status 503 unless maintenance_allowed
+    server myService myService:1234
+    errorfile 503 /errorfiles/services/myService/maintenance.http
+    errorfile 504 /errorfiles/services/myService/504.http`
+
+	_, backend, _ := s.reconfigure.GetTemplates()
+
+	s.Equal(expected, backend)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_DeniesAllRequests_WhenMaintenanceDoesNotHaveAllowedIps() {
+	defer proxy.SetMaintenance("myService", nil)
+	proxy.SetMaintenance("myService", &proxy.Maintenance{})
+	s.reconfigure.ServiceDest = []proxy.ServiceDest{{Port: "1234", Index: 0}}
+	expected := `
+backend myService-be1234_0
+    mode http
+    http-request add-header X-Forwarded-Proto https if { ssl_fc }
+    http-request deny deny_status 503
+    server myService myService:1234`
+
+	_, backend, _ := s.reconfigure.GetTemplates()
+
+	s.Equal(expected, backend)
+}
+
 func (s ReconfigureTestSuite) Test_GetTemplates_ProcessesTemplateFromTemplatePath_WhenSpecified() {
 	expectedFeFile := "/path/to/my/fe/template"
 	expectedBeFile := "/path/to/my/be/template"
@@ -635,6 +694,68 @@ func (s ReconfigureTestSuite) Test_GetTemplates_ReturnsError_WhenTemplateBePathI
 	s.Error(err)
 }
 
+func (s ReconfigureTestSuite) Test_GetTemplates_ReturnsErrorWithFileAndLine_WhenTemplateCannotBeParsed() {
+	readTemplateFileOrig := readTemplateFile
+	defer func() { readTemplateFile = readTemplateFileOrig }()
+	readTemplateFile = func(filename string) ([]byte, error) {
+		return []byte("backend {{.ServiceName}}\n    server {{.ServiceName"), nil
+	}
+	s.reconfigure.Service.TemplateBePath = "/tmpl/be.tmpl"
+
+	_, _, err := s.reconfigure.GetTemplates()
+
+	s.Error(err)
+	s.Contains(err.Error(), "/tmpl/be.tmpl:2")
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_ReturnsError_WhenTemplateCannotBeExecuted() {
+	readTemplateFileOrig := readTemplateFile
+	defer func() { readTemplateFile = readTemplateFileOrig }()
+	readTemplateFile = func(filename string) ([]byte, error) {
+		return []byte("frontend {{.DoesNotExist}}"), nil
+	}
+	s.reconfigure.Service.TemplateFePath = "/tmpl/fe.tmpl"
+
+	_, _, err := s.reconfigure.GetTemplates()
+
+	s.Error(err)
+	s.Contains(err.Error(), "/tmpl/fe.tmpl:1")
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_ReadsUploadedTemplates_WhenTemplateNamesAreSet() {
+	readTemplateFileOrig := readTemplateFile
+	defer func() { readTemplateFile = readTemplateFileOrig }()
+	actualFilenames := []string{}
+	readTemplateFile = func(filename string) ([]byte, error) {
+		actualFilenames = append(actualFilenames, filename)
+		return []byte("{{.ServiceName}} " + filename), nil
+	}
+	s.reconfigure.Service.TemplateFePath = "/tmpl/fe.tmpl"
+	s.reconfigure.Service.TemplateFeName = "my-fe"
+	s.reconfigure.Service.TemplateBeName = "my-be"
+
+	actualFe, actualBe, err := s.reconfigure.GetTemplates()
+
+	s.NoError(err)
+	s.Equal([]string{"/templates/services/my-fe-fe.tmpl", "/templates/services/my-be-be.tmpl"}, actualFilenames)
+	s.Equal("myService /templates/services/my-fe-fe.tmpl", actualFe)
+	s.Equal("myService /templates/services/my-be-be.tmpl", actualBe)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_ReturnsError_WhenTemplateOverrideIsInvalid() {
+	dir, _ := ioutil.TempDir("", "dfp-reconfigure-test")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(dir+"/servers.tmpl", []byte(`{{define "backend-servers"}}{{.Service.Unknown}}{{end}}`), 0644)
+	overridesPathOrig := os.Getenv("TEMPLATE_OVERRIDES_PATH")
+	defer func() { os.Setenv("TEMPLATE_OVERRIDES_PATH", overridesPathOrig) }()
+	os.Setenv("TEMPLATE_OVERRIDES_PATH", dir)
+	s.reconfigure.Service.ServiceDest[0].Port = "1234"
+
+	_, _, err := s.reconfigure.GetTemplates()
+
+	s.Error(err)
+}
+
 // Execute
 
 func (s ReconfigureTestSuite) Test_Execute_WritesBeTemplate() {
@@ -1089,7 +1210,7 @@ func (s ReconfigureTestSuite) Test_Execute_AddsService() {
 	mockObj.AssertCalled(s.T(), "AddService", mock.Anything)
 }
 
-func (s ReconfigureTestSuite) Test_Execute_DoesNotInvokeAddService_WhenTemplatesAreSet() {
+func (s ReconfigureTestSuite) Test_Execute_InvokesAddService_WhenTemplatesAreSet() {
 	mockObj := getProxyMock("")
 	proxyOrig := proxy.Instance
 	defer func() { proxy.Instance = proxyOrig }()
@@ -1100,6 +1221,8 @@ func (s ReconfigureTestSuite) Test_Execute_DoesNotInvokeAddService_WhenTemplates
 		return []byte(""), nil
 	}
 	expected := proxy.Service{
+		ServiceName:    "my-service",
+		Replicas:       1,
 		TemplateBePath: "something",
 		TemplateFePath: "something",
 	}
@@ -1110,7 +1233,7 @@ func (s ReconfigureTestSuite) Test_Execute_DoesNotInvokeAddService_WhenTemplates
 
 	r.Execute(true)
 
-	mockObj.AssertNotCalled(s.T(), "AddService", mock.Anything)
+	mockObj.AssertCalled(s.T(), "AddService", mock.Anything)
 }
 
 func (s ReconfigureTestSuite) Test_Execute_InvokesHaProxyReload() {
@@ -16,12 +16,12 @@ type reload struct{}
 func (m *reload) Execute(recreate bool) error {
 	if recreate {
 		if err := proxy.Instance.CreateConfigFromTemplates(); err != nil {
-			logPrintf(err.Error())
+			logPrintf("%s", err.Error())
 			return err
 		}
 	}
 	if err := proxy.Instance.Reload(); err != nil {
-		logPrintf(err.Error())
+		logPrintf("%s", err.Error())
 		return err
 	}
 	return nil
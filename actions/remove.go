@@ -44,7 +44,7 @@ func (m *Remove) Execute(args []string) error {
 	}
 	reload := reload{}
 	if err := reload.Execute(true); err != nil {
-		logPrintf(err.Error())
+		logPrintf("%s", err.Error())
 		return err
 	}
 	return nil
@@ -59,7 +59,7 @@ func (m *Remove) removeConfigsAndService() (bool, error) {
 	}
 
 	if err := m.removeFiles(m.TemplatesPath, m.ServiceName, m.AclName); err != nil {
-		logPrintf(err.Error())
+		logPrintf("%s", err.Error())
 		return false, err
 	}
 	return didRemove, nil
@@ -77,5 +77,8 @@ func (m *Remove) removeFiles(templatesPath, serviceName, aclName string) error {
 	for _, path := range paths {
 		osRemove(path)
 	}
+	if err := proxy.RemoveErrorPages(aclName); err != nil {
+		logPrintf("Could not remove error pages of the service %s: %s", serviceName, err.Error())
+	}
 	return nil
 }
@@ -16,9 +16,11 @@ type executable interface {
 var lookupHost = net.LookupHost
 var logPrintf = log.Printf
 var httpGet = http.Get
+var httpDo = http.DefaultClient.Do
 var writeFeTemplate = ioutil.WriteFile
 var writeBeTemplate = ioutil.WriteFile
 var readTemplateFile = ioutil.ReadFile
 var osRemove = os.Remove
+var readKubernetesFile = ioutil.ReadFile
 
 var configProxyMu = &sync.Mutex{}
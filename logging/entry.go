@@ -0,0 +1,153 @@
+package logging
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const acceptDateLayout = "02/Jan/2006:15:04:05.000"
+
+// Entry is an access log entry produced by HAProxy.
+// Timers are in milliseconds and are set to -1 when HAProxy could not measure them.
+type Entry struct {
+	Type             string    `json:"type"`
+	Timestamp        time.Time `json:"timestamp"`
+	ClientIP         string    `json:"client_ip,omitempty"`
+	ClientPort       int       `json:"client_port,omitempty"`
+	Frontend         string    `json:"frontend,omitempty"`
+	Backend          string    `json:"backend,omitempty"`
+	Server           string    `json:"server,omitempty"`
+	TimeRequest      int       `json:"time_request,omitempty"`
+	TimeQueue        int       `json:"time_queue"`
+	TimeConnect      int       `json:"time_connect"`
+	TimeResponse     int       `json:"time_response,omitempty"`
+	TimeTotal        int       `json:"time_total"`
+	Status           int       `json:"status,omitempty"`
+	BytesRead        int64     `json:"bytes_read"`
+	TerminationState string    `json:"termination_state,omitempty"`
+	ActiveConns      int       `json:"active_conns"`
+	FrontendConns    int       `json:"frontend_conns"`
+	BackendConns     int       `json:"backend_conns"`
+	ServerConns      int       `json:"server_conns"`
+	Retries          int       `json:"retries"`
+	Redispatched     bool      `json:"redispatched,omitempty"`
+	ServerQueue      int       `json:"server_queue"`
+	BackendQueue     int       `json:"backend_queue"`
+	Method           string    `json:"method,omitempty"`
+	URI              string    `json:"uri,omitempty"`
+	Protocol         string    `json:"protocol,omitempty"`
+	RequestID        string    `json:"request_id,omitempty"`
+	TraceID          string    `json:"trace_id,omitempty"`
+	SpanID           string    `json:"span_id,omitempty"`
+	ParentSpanID     string    `json:"parent_span_id,omitempty"`
+	// The original line. It is set only for entries that could not be parsed (e.g. custom log formats).
+	Message string `json:"message,omitempty"`
+}
+
+const entryPrefixPattern = `^(\S+):(\d+) \[([^\]]+)\] (\S+) ([^/\s]+)/(\S+) `
+const entryConnsPattern = `(\d+)/(\d+)/(\d+)/(\d+)/(\+?\d+) (\d+)/(\d+)`
+
+var httpEntryRegexp = regexp.MustCompile(entryPrefixPattern +
+	`([+-]?\d+)/([+-]?\d+)/([+-]?\d+)/([+-]?\d+)/([+-]?\d+) (-?\d+) (\+?\d+) \S+ \S+ (\S{4}) ` +
+	entryConnsPattern +
+	`(?: \{[^}]*\})*(?: "([^"]*)"?)?` +
+	// Tracing IDs are appended when `TRACING` is enabled
+	`(?: "?([^" ]*)"? "?([^" ]*)"? "?([^" ]*)"?)?$`)
+
+var tcpEntryRegexp = regexp.MustCompile(entryPrefixPattern +
+	`([+-]?\d+)/([+-]?\d+)/([+-]?\d+) (\+?\d+) (\S{2}) ` +
+	entryConnsPattern + `$`)
+
+// ParseEntry parses a line produced by HAProxy with the `httplog` or `tcplog` option.
+// Lines in any other format are returned as entries of the type `raw` with the line stored in `Message`.
+func ParseEntry(line string) Entry {
+	line = strings.TrimSpace(line)
+	if m := httpEntryRegexp.FindStringSubmatch(line); m != nil {
+		e := Entry{Type: "http"}
+		e.setPrefix(m[1:7])
+		e.TimeRequest = atoi(m[7])
+		e.TimeQueue = atoi(m[8])
+		e.TimeConnect = atoi(m[9])
+		e.TimeResponse = atoi(m[10])
+		e.TimeTotal = atoi(m[11])
+		e.Status = atoi(m[12])
+		e.BytesRead = int64(atoi(m[13]))
+		e.TerminationState = m[14]
+		e.setConns(m[15:22])
+		e.setRequest(m[22])
+		e.setTracing(m[23], m[24], m[25])
+		return e
+	}
+	if m := tcpEntryRegexp.FindStringSubmatch(line); m != nil {
+		e := Entry{Type: "tcp"}
+		e.setPrefix(m[1:7])
+		e.TimeQueue = atoi(m[7])
+		e.TimeConnect = atoi(m[8])
+		e.TimeTotal = atoi(m[9])
+		e.BytesRead = int64(atoi(m[10]))
+		e.TerminationState = m[11]
+		e.setConns(m[12:19])
+		return e
+	}
+	return Entry{Type: "raw", Timestamp: time.Now().UTC(), Message: line}
+}
+
+func (e *Entry) setPrefix(fields []string) {
+	e.ClientIP = fields[0]
+	e.ClientPort = atoi(fields[1])
+	if t, err := time.ParseInLocation(acceptDateLayout, fields[2], time.Local); err == nil {
+		e.Timestamp = t.UTC()
+	} else {
+		e.Timestamp = time.Now().UTC()
+	}
+	// HAProxy appends `~` to the name of frontends that accepted SSL connections
+	e.Frontend = strings.TrimSuffix(fields[3], "~")
+	e.Backend = fields[4]
+	e.Server = fields[5]
+}
+
+func (e *Entry) setConns(fields []string) {
+	e.ActiveConns = atoi(fields[0])
+	e.FrontendConns = atoi(fields[1])
+	e.BackendConns = atoi(fields[2])
+	e.ServerConns = atoi(fields[3])
+	e.Redispatched = strings.HasPrefix(fields[4], "+")
+	e.Retries = atoi(fields[4])
+	e.ServerQueue = atoi(fields[5])
+	e.BackendQueue = atoi(fields[6])
+}
+
+func (e *Entry) setRequest(request string) {
+	parts := strings.SplitN(request, " ", 3)
+	if len(parts) < 2 {
+		e.URI = request
+		return
+	}
+	e.Method = parts[0]
+	e.URI = parts[1]
+	if len(parts) == 3 {
+		e.Protocol = parts[2]
+	}
+}
+
+func (e *Entry) setTracing(requestID, traceparent, parentID string) {
+	if requestID != "-" {
+		e.RequestID = requestID
+	}
+	// traceparent is in the `<version>-<trace-id>-<span-id>-<flags>` format
+	if fields := strings.Split(traceparent, "-"); len(fields) == 4 {
+		e.TraceID = fields[1]
+		e.SpanID = fields[2]
+	}
+	if parentID != "-" {
+		e.ParentSpanID = parentID
+	}
+}
+
+// atoi converts HAProxy numbers, which might be prefixed with `+`, into integers
+func atoi(value string) int {
+	i, _ := strconv.Atoi(strings.TrimPrefix(value, "+"))
+	return i
+}
@@ -0,0 +1,116 @@
+package logging
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type EntryTestSuite struct {
+	suite.Suite
+}
+
+func TestEntryUnitTestSuite(t *testing.T) {
+	suite.Run(t, new(EntryTestSuite))
+}
+
+// ParseEntry
+
+func (s *EntryTestSuite) Test_ParseEntry_ParsesHttpLog() {
+	line := ` 10.0.0.3:51234 [09/Feb/2017:12:04:35.123] services~ go-demo_8080-be8080_0/go-demo 10/0/30/69/109 200 2750 - - ---- 1/1/0/0/0 0/0 "GET /demo/hello HTTP/1.1"`
+
+	actual := ParseEntry(line)
+
+	expectedTime, _ := time.ParseInLocation(acceptDateLayout, "09/Feb/2017:12:04:35.123", time.Local)
+	s.Equal(Entry{
+		Type:             "http",
+		Timestamp:        expectedTime.UTC(),
+		ClientIP:         "10.0.0.3",
+		ClientPort:       51234,
+		Frontend:         "services",
+		Backend:          "go-demo_8080-be8080_0",
+		Server:           "go-demo",
+		TimeRequest:      10,
+		TimeQueue:        0,
+		TimeConnect:      30,
+		TimeResponse:     69,
+		TimeTotal:        109,
+		Status:           200,
+		BytesRead:        2750,
+		TerminationState: "----",
+		ActiveConns:      1,
+		FrontendConns:    1,
+		Method:           "GET",
+		URI:              "/demo/hello",
+		Protocol:         "HTTP/1.1",
+	}, actual)
+}
+
+func (s *EntryTestSuite) Test_ParseEntry_ParsesHttpLogWithCapturedHeadersAndAbortedTimers() {
+	line := `10.0.0.3:51234 [09/Feb/2017:12:04:35.123] services go-demo_8080-be8080_0/<NOSRV> -1/-1/-1/-1/+5 503 +212 - - SC-- 3/2/1/0/+3 4/5 {example.com} {} "POST /demo HTTP/1.1"`
+
+	actual := ParseEntry(line)
+
+	s.Equal("http", actual.Type)
+	s.Equal("<NOSRV>", actual.Server)
+	s.Equal(-1, actual.TimeRequest)
+	s.Equal(-1, actual.TimeResponse)
+	s.Equal(5, actual.TimeTotal)
+	s.Equal(503, actual.Status)
+	s.Equal(int64(212), actual.BytesRead)
+	s.Equal("SC--", actual.TerminationState)
+	s.Equal(3, actual.Retries)
+	s.True(actual.Redispatched)
+	s.Equal(4, actual.ServerQueue)
+	s.Equal(5, actual.BackendQueue)
+	s.Equal("POST", actual.Method)
+	s.Equal("/demo", actual.URI)
+}
+
+func (s *EntryTestSuite) Test_ParseEntry_ParsesTracingIds() {
+	line := `10.0.0.3:51234 [09/Feb/2017:12:04:35.123] services go-demo_8080-be8080_0/go-demo 10/0/30/69/109 200 2750 - - ---- 1/1/0/0/0 0/0 "GET /demo HTTP/1.1" "req-1" "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" "b7ad6b7169203331"`
+
+	actual := ParseEntry(line)
+
+	s.Equal("/demo", actual.URI)
+	s.Equal("HTTP/1.1", actual.Protocol)
+	s.Equal("req-1", actual.RequestID)
+	s.Equal("4bf92f3577b34da6a3ce929d0e0e4736", actual.TraceID)
+	s.Equal("00f067aa0ba902b7", actual.SpanID)
+	s.Equal("b7ad6b7169203331", actual.ParentSpanID)
+}
+
+func (s *EntryTestSuite) Test_ParseEntry_IgnoresMissingTracingIds() {
+	line := `10.0.0.3:51234 [09/Feb/2017:12:04:35.123] services go-demo_8080-be8080_0/go-demo 10/0/30/69/109 200 2750 - - ---- 1/1/0/0/0 0/0 "GET /demo HTTP/1.1" "req-1" "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" -`
+
+	actual := ParseEntry(line)
+
+	s.Equal("4bf92f3577b34da6a3ce929d0e0e4736", actual.TraceID)
+	s.Empty(actual.ParentSpanID)
+}
+
+func (s *EntryTestSuite) Test_ParseEntry_ParsesTcpLog() {
+	line := `10.0.0.3:51234 [09/Feb/2017:12:04:35.123] tcpFE_6379 redis-be6379/redis 0/1/5001 1024 -- 2/1/1/1/0 0/0`
+
+	actual := ParseEntry(line)
+
+	s.Equal("tcp", actual.Type)
+	s.Equal("tcpFE_6379", actual.Frontend)
+	s.Equal("redis-be6379", actual.Backend)
+	s.Equal("redis", actual.Server)
+	s.Equal(1, actual.TimeConnect)
+	s.Equal(5001, actual.TimeTotal)
+	s.Equal(int64(1024), actual.BytesRead)
+	s.Equal("--", actual.TerminationState)
+	s.Equal(2, actual.ActiveConns)
+	s.Equal(1, actual.ServerConns)
+}
+
+func (s *EntryTestSuite) Test_ParseEntry_ReturnsRawEntry_WhenFormatIsUnknown() {
+	actual := ParseEntry("Proxy services started.")
+
+	s.Equal("raw", actual.Type)
+	s.Equal("Proxy services started.", actual.Message)
+	s.False(actual.Timestamp.IsZero())
+}
@@ -7,12 +7,21 @@ import (
 
 var logPrintf = log.Printf
 
+var extraSinks = []Sink{}
+
+// AddSink adds a sink that receives entries in addition to those defined through `ACCESS_LOG_SINKS`.
+// It should be invoked before StartLogging.
+func AddSink(sink Sink) {
+	extraSinks = append(extraSinks, sink)
+}
+
 type handler struct {
 	*syslog.BaseHandler
+	sinks []Sink
 }
 
-func newHandler() *handler {
-	h := handler{syslog.NewBaseHandler(100, nil, false)}
+func newHandler(sinks []Sink) *handler {
+	h := handler{syslog.NewBaseHandler(100, nil, false), sinks}
 	go h.mainLoop()
 	return &h
 }
@@ -20,13 +29,37 @@ func newHandler() *handler {
 func (h *handler) mainLoop() {
 	for {
 		m := h.Get()
-		logPrintf("HAPRoxy: %s%s\n", m.Tag, m.Content)
+		if m == nil {
+			return
+		}
+		entry := ParseEntry(m.Content)
+		for _, sink := range h.sinks {
+			if err := sink.Write(entry, m.Tag+m.Content); err != nil {
+				logPrintf("Error: Could not write the access log: %s\n", err.Error())
+			}
+		}
 	}
 }
 
-// StartLogging listens to rsyslog and outputs entries to stdout
+// StartLogging listens to rsyslog, parses HAProxy entries, and sends them to the sinks defined through `ACCESS_LOG_SINKS`.
+// The output defaults to stdout.
 var StartLogging = func() {
+	sinks, err := getSinks()
+	if err != nil {
+		logPrintf("Error: %s. Access logs will be sent to stdout.\n", err.Error())
+		sinks = []Sink{&stdoutSink{}}
+	}
+	listen(append(sinks, extraSinks...))
+}
+
+// StartSinkLogging listens to rsyslog and sends HAProxy entries only to the sinks added through AddSink.
+// It is used when access logs are not output but are still consumed by the proxy (e.g. for metrics).
+var StartSinkLogging = func() {
+	listen(extraSinks)
+}
+
+func listen(sinks []Sink) {
 	s := syslog.NewServer()
-	s.AddHandler(newHandler())
+	s.AddHandler(newHandler(sinks))
 	s.Listen("127.0.0.1:1514")
 }
@@ -0,0 +1,426 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink receives access log entries
+type Sink interface {
+	// Write stores or forwards an entry.
+	// The line is the original message sent by HAProxy.
+	Write(entry Entry, line string) error
+}
+
+// getSinks returns sinks configured through environment variables
+func getSinks() ([]Sink, error) {
+	names := os.Getenv("ACCESS_LOG_SINKS")
+	if len(names) == 0 {
+		names = "stdout"
+	}
+	jsonFormat := strings.EqualFold(os.Getenv("ACCESS_LOG_FORMAT"), "json")
+	sinks := []Sink{}
+	for _, name := range strings.Split(names, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "":
+			continue
+		case "stdout":
+			sinks = append(sinks, &stdoutSink{json: jsonFormat})
+		case "file":
+			path := os.Getenv("ACCESS_LOG_FILE")
+			if len(path) == 0 {
+				return nil, fmt.Errorf("ACCESS_LOG_FILE is mandatory for the file sink")
+			}
+			maxSize := getEnvInt("ACCESS_LOG_FILE_MAX_SIZE", 100) * 1024 * 1024
+			maxBackups := getEnvInt("ACCESS_LOG_FILE_MAX_BACKUPS", 5)
+			sinks = append(sinks, newFileSink(path, int64(maxSize), maxBackups, jsonFormat))
+		case "elasticsearch":
+			addr := os.Getenv("ACCESS_LOG_ELASTICSEARCH_URL")
+			if len(addr) == 0 {
+				return nil, fmt.Errorf("ACCESS_LOG_ELASTICSEARCH_URL is mandatory for the elasticsearch sink")
+			}
+			index := os.Getenv("ACCESS_LOG_ELASTICSEARCH_INDEX")
+			if len(index) == 0 {
+				index = "docker-flow-proxy"
+			}
+			sinks = append(sinks, newHTTPSink(&elasticsearchEncoder{url: addr, index: index}))
+		case "loki":
+			addr := os.Getenv("ACCESS_LOG_LOKI_URL")
+			if len(addr) == 0 {
+				return nil, fmt.Errorf("ACCESS_LOG_LOKI_URL is mandatory for the loki sink")
+			}
+			sinks = append(sinks, newHTTPSink(&lokiEncoder{url: addr}))
+		case "otlp":
+			addr := os.Getenv("ACCESS_LOG_OTLP_URL")
+			if len(addr) == 0 {
+				return nil, fmt.Errorf("ACCESS_LOG_OTLP_URL is mandatory for the otlp sink")
+			}
+			serviceName := os.Getenv("SERVICE_NAME")
+			if len(serviceName) == 0 {
+				serviceName = "proxy"
+			}
+			sinks = append(sinks, &traceSink{newHTTPSink(&otlpEncoder{url: addr, serviceName: serviceName})})
+		default:
+			return nil, fmt.Errorf("%s is not a valid access log sink", name)
+		}
+	}
+	return sinks, nil
+}
+
+func getEnvInt(name string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+// stdout
+
+type stdoutSink struct {
+	json bool
+}
+
+func (s *stdoutSink) Write(entry Entry, line string) error {
+	if !s.json {
+		logPrintf("HAPRoxy: %s\n", line)
+		return nil
+	}
+	js, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	logPrintf("%s\n", js)
+	return nil
+}
+
+// file
+
+type fileSink struct {
+	sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	json       bool
+	file       *os.File
+	size       int64
+}
+
+func newFileSink(path string, maxSize int64, maxBackups int, json bool) *fileSink {
+	return &fileSink{path: path, maxSize: maxSize, maxBackups: maxBackups, json: json}
+}
+
+func (s *fileSink) Write(entry Entry, line string) error {
+	content := []byte(line)
+	if s.json {
+		js, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		content = js
+	}
+	content = append(content, '\n')
+	s.Lock()
+	defer s.Unlock()
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	if s.size > 0 && s.size+int64(len(content)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(content)
+	s.size += int64(n)
+	return err
+}
+
+func (s *fileSink) open() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// rotate renames the current file to `<path>.1`, shifts older backups, and removes those over the limit
+func (s *fileSink) rotate() error {
+	s.file.Close()
+	s.file = nil
+	os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxBackups))
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+	}
+	if s.maxBackups > 0 {
+		if err := os.Rename(s.path, s.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(s.path); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+// HTTP
+
+// httpEncoder converts a batch of entries into a request understood by a log store
+type httpEncoder interface {
+	encode(entries []Entry) (*http.Request, error)
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// httpSink sends entries in batches.
+// A batch is sent when it reaches `ACCESS_LOG_BATCH_SIZE` entries or after `ACCESS_LOG_FLUSH_INTERVAL` seconds.
+type httpSink struct {
+	sync.Mutex
+	encoder   httpEncoder
+	batchSize int
+	entries   []Entry
+}
+
+func newHTTPSink(encoder httpEncoder) *httpSink {
+	s := &httpSink{
+		encoder:   encoder,
+		batchSize: getEnvInt("ACCESS_LOG_BATCH_SIZE", 100),
+	}
+	interval := time.Duration(getEnvInt("ACCESS_LOG_FLUSH_INTERVAL", 5)) * time.Second
+	go func() {
+		for range time.Tick(interval) {
+			if err := s.flush(); err != nil {
+				logPrintf("Error: Could not send access logs: %s\n", err.Error())
+			}
+		}
+	}()
+	return s
+}
+
+func (s *httpSink) Write(entry Entry, line string) error {
+	s.Lock()
+	s.entries = append(s.entries, entry)
+	full := len(s.entries) >= s.batchSize
+	s.Unlock()
+	if full {
+		return s.flush()
+	}
+	return nil
+}
+
+func (s *httpSink) flush() error {
+	s.Lock()
+	entries := s.entries
+	s.entries = nil
+	s.Unlock()
+	if len(entries) == 0 {
+		return nil
+	}
+	req, err := s.encoder.encode(entries)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s responded with the status code %d", req.URL.String(), resp.StatusCode)
+	}
+	return nil
+}
+
+// elasticsearchEncoder uses the Elasticsearch bulk API
+type elasticsearchEncoder struct {
+	url   string
+	index string
+}
+
+func (e *elasticsearchEncoder) encode(entries []Entry) (*http.Request, error) {
+	body := bytes.Buffer{}
+	action, _ := json.Marshal(map[string]map[string]string{"index": {"_index": e.index}})
+	for _, entry := range entries {
+		js, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(js)
+		body.WriteByte('\n')
+	}
+	req, err := http.NewRequest("POST", strings.TrimRight(e.url, "/")+"/_bulk", &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	return req, nil
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// lokiEncoder uses the Loki push API.
+// Entries are grouped into streams by their type and frontend.
+type lokiEncoder struct {
+	url string
+}
+
+func (e *lokiEncoder) encode(entries []Entry) (*http.Request, error) {
+	streams := []*lokiStream{}
+	byLabels := map[string]*lokiStream{}
+	for _, entry := range entries {
+		key := entry.Type + "/" + entry.Frontend
+		stream, ok := byLabels[key]
+		if !ok {
+			labels := map[string]string{"job": "docker-flow-proxy", "type": entry.Type}
+			if len(entry.Frontend) > 0 {
+				labels["frontend"] = entry.Frontend
+			}
+			stream = &lokiStream{Stream: labels, Values: [][2]string{}}
+			byLabels[key] = stream
+			streams = append(streams, stream)
+		}
+		js, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		ts := strconv.FormatInt(entry.Timestamp.UnixNano(), 10)
+		stream.Values = append(stream.Values, [2]string{ts, string(js)})
+	}
+	js, err := json.Marshal(map[string][]*lokiStream{"streams": streams})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", strings.TrimRight(e.url, "/")+"/loki/api/v1/push", bytes.NewReader(js))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// traceSink forwards only entries of traced requests
+type traceSink struct {
+	*httpSink
+}
+
+func (s *traceSink) Write(entry Entry, line string) error {
+	if len(entry.TraceID) == 0 || len(entry.SpanID) == 0 {
+		return nil
+	}
+	return s.httpSink.Write(entry, line)
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            struct {
+		Code int `json:"code"`
+	} `json:"status"`
+}
+
+// otlpEncoder exports a span per request through the OTLP/HTTP JSON protocol
+type otlpEncoder struct {
+	url         string
+	serviceName string
+}
+
+func (e *otlpEncoder) encode(entries []Entry) (*http.Request, error) {
+	spans := []otlpSpan{}
+	for _, entry := range entries {
+		span := otlpSpan{
+			TraceID:      entry.TraceID,
+			SpanID:       entry.SpanID,
+			ParentSpanID: entry.ParentSpanID,
+			Name:         strings.TrimSpace(entry.Method + " " + entry.Backend),
+			// SPAN_KIND_SERVER
+			Kind:              2,
+			StartTimeUnixNano: strconv.FormatInt(entry.Timestamp.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(entry.Timestamp.Add(time.Duration(entry.TimeTotal)*time.Millisecond).UnixNano(), 10),
+			Attributes: []otlpAttribute{
+				otlpString("http.method", entry.Method),
+				otlpString("http.target", entry.URI),
+				otlpString("http.flavor", strings.TrimPrefix(entry.Protocol, "HTTP/")),
+				otlpInt("http.status_code", int64(entry.Status)),
+				otlpString("net.peer.ip", entry.ClientIP),
+				otlpString("haproxy.frontend", entry.Frontend),
+				otlpString("haproxy.backend", entry.Backend),
+				otlpString("haproxy.server", entry.Server),
+				otlpString("haproxy.termination_state", entry.TerminationState),
+				otlpString("http.request_id", entry.RequestID),
+			},
+		}
+		// STATUS_CODE_ERROR
+		if entry.Status >= 500 || entry.Status <= 0 {
+			span.Status.Code = 2
+		}
+		spans = append(spans, span)
+	}
+	js, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []otlpAttribute{otlpString("service.name", e.serviceName)},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "docker-flow-proxy"},
+				"spans": spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", strings.TrimRight(e.url, "/")+"/v1/traces", bytes.NewReader(js))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+func otlpString(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+// otlpInt returns an integer attribute. The JSON encoding of OTLP represents 64 bit integers as strings.
+func otlpInt(key string, value int64) otlpAttribute {
+	str := strconv.FormatInt(value, 10)
+	return otlpAttribute{Key: key, Value: otlpValue{IntValue: &str}}
+}
@@ -0,0 +1,265 @@
+package logging
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SinkTestSuite struct {
+	suite.Suite
+	entry Entry
+	line  string
+}
+
+func TestSinkUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	suite.Run(t, new(SinkTestSuite))
+}
+
+func (s *SinkTestSuite) SetupTest() {
+	s.line = `10.0.0.3:51234 [09/Feb/2017:12:04:35.123] services go-demo_8080-be8080_0/go-demo 10/0/30/69/109 200 2750 - - ---- 1/1/0/0/0 0/0 "GET /demo HTTP/1.1"`
+	s.entry = ParseEntry(s.line)
+}
+
+// getSinks
+
+func (s *SinkTestSuite) Test_GetSinks_ReturnsStdout_WhenSinksAreNotSet() {
+	defer s.setEnv("ACCESS_LOG_SINKS", "")()
+
+	actual, err := getSinks()
+
+	s.NoError(err)
+	s.Equal([]Sink{&stdoutSink{}}, actual)
+}
+
+func (s *SinkTestSuite) Test_GetSinks_ReturnsError_WhenSinkIsUnknown() {
+	defer s.setEnv("ACCESS_LOG_SINKS", "stdout,kafka")()
+
+	_, err := getSinks()
+
+	s.Error(err)
+}
+
+func (s *SinkTestSuite) Test_GetSinks_ReturnsError_WhenFileIsNotSet() {
+	defer s.setEnv("ACCESS_LOG_SINKS", "file")()
+	defer s.setEnv("ACCESS_LOG_FILE", "")()
+
+	_, err := getSinks()
+
+	s.Error(err)
+}
+
+// stdoutSink
+
+func (s *SinkTestSuite) Test_StdoutSink_OutputsJson() {
+	logPrintfOrig := logPrintf
+	defer func() { logPrintf = logPrintfOrig }()
+	actual := ""
+	logPrintf = func(format string, v ...interface{}) {
+		actual = fmt.Sprintf(format, v...)
+	}
+	sink := stdoutSink{json: true}
+
+	sink.Write(s.entry, s.line)
+
+	decoded := Entry{}
+	s.NoError(json.Unmarshal([]byte(actual), &decoded))
+	s.Equal(s.entry, decoded)
+}
+
+func (s *SinkTestSuite) Test_StdoutSink_OutputsOriginalLine_WhenFormatIsText() {
+	logPrintfOrig := logPrintf
+	defer func() { logPrintf = logPrintfOrig }()
+	actual := ""
+	logPrintf = func(format string, v ...interface{}) {
+		actual = fmt.Sprintf(format, v...)
+	}
+	sink := stdoutSink{}
+
+	sink.Write(s.entry, s.line)
+
+	s.Equal("HAPRoxy: "+s.line+"\n", actual)
+}
+
+// fileSink
+
+func (s *SinkTestSuite) Test_FileSink_RotatesFiles() {
+	dir, _ := ioutil.TempDir("", "dfp-logging-test")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "logs", "access.log")
+	sink := newFileSink(path, int64(len(s.line)+1)*2, 2, false)
+
+	for i := 0; i < 7; i++ {
+		s.NoError(sink.Write(s.entry, s.line))
+	}
+
+	expected := map[string]int{path: 1, path + ".1": 2, path + ".2": 2}
+	for name, lines := range expected {
+		content, err := ioutil.ReadFile(name)
+		s.NoError(err)
+		s.Equal(strings.Repeat(s.line+"\n", lines), string(content))
+	}
+	_, err := os.Stat(path + ".3")
+	s.True(os.IsNotExist(err))
+}
+
+func (s *SinkTestSuite) Test_FileSink_WritesJsonLines() {
+	dir, _ := ioutil.TempDir("", "dfp-logging-test")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+	sink := newFileSink(path, 1024*1024, 1, true)
+
+	sink.Write(s.entry, s.line)
+	sink.Write(s.entry, s.line)
+
+	file, _ := os.Open(path)
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	count := 0
+	for scanner.Scan() {
+		decoded := Entry{}
+		s.NoError(json.Unmarshal(scanner.Bytes(), &decoded))
+		s.Equal("go-demo", decoded.Server)
+		count++
+	}
+	s.Equal(2, count)
+}
+
+// httpSink
+
+func (s *SinkTestSuite) Test_HttpSink_SendsBulkRequestToElasticsearch() {
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- r
+		bodies <- string(body)
+	}))
+	defer srv.Close()
+	defer s.setEnv("ACCESS_LOG_BATCH_SIZE", "2")()
+	sink := newHTTPSink(&elasticsearchEncoder{url: srv.URL + "/", index: "dfp"})
+
+	s.NoError(sink.Write(s.entry, s.line))
+	s.Len(requests, 0)
+	s.NoError(sink.Write(s.entry, s.line))
+
+	req := <-requests
+	s.Equal("/_bulk", req.URL.Path)
+	s.Equal("application/x-ndjson", req.Header.Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(<-bodies), "\n")
+	s.Len(lines, 4)
+	s.JSONEq(`{"index":{"_index":"dfp"}}`, lines[0])
+	decoded := Entry{}
+	s.NoError(json.Unmarshal([]byte(lines[3]), &decoded))
+	s.Equal(s.entry, decoded)
+}
+
+func (s *SinkTestSuite) Test_HttpSink_PushesStreamsToLoki() {
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	defer s.setEnv("ACCESS_LOG_BATCH_SIZE", "2")()
+	sink := newHTTPSink(&lokiEncoder{url: srv.URL})
+	raw := ParseEntry("Proxy started")
+
+	sink.Write(s.entry, s.line)
+	s.NoError(sink.Write(raw, "Proxy started"))
+
+	req := <-requests
+	s.Equal("/loki/api/v1/push", req.URL.Path)
+	actual := map[string][]lokiStream{}
+	s.NoError(json.Unmarshal(<-bodies, &actual))
+	s.Len(actual["streams"], 2)
+	s.Equal(map[string]string{"job": "docker-flow-proxy", "type": "http", "frontend": "services"}, actual["streams"][0].Stream)
+	s.Equal(fmt.Sprint(s.entry.Timestamp.UnixNano()), actual["streams"][0].Values[0][0])
+	s.Equal(map[string]string{"job": "docker-flow-proxy", "type": "raw"}, actual["streams"][1].Stream)
+}
+
+func (s *SinkTestSuite) Test_TraceSink_ExportsSpansThroughOtlp() {
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+	}))
+	defer srv.Close()
+	defer s.setEnv("ACCESS_LOG_BATCH_SIZE", "1")()
+	sink := &traceSink{newHTTPSink(&otlpEncoder{url: srv.URL, serviceName: "proxy"})}
+	entry := s.entry
+	entry.Status = 503
+	entry.RequestID = "abc"
+	entry.TraceID = "0af7651916cd43dd8448eb211c80319c"
+	entry.SpanID = "b7ad6b7169203331"
+	entry.ParentSpanID = "00f067aa0ba902b7"
+
+	s.NoError(sink.Write(s.entry, s.line))
+	s.NoError(sink.Write(entry, s.line))
+
+	req := <-requests
+	s.Equal("/v1/traces", req.URL.Path)
+	s.Equal("application/json", req.Header.Get("Content-Type"))
+	actual := struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []otlpAttribute
+			}
+			ScopeSpans []struct {
+				Spans []otlpSpan
+			}
+		}
+	}{}
+	s.NoError(json.Unmarshal(<-bodies, &actual))
+	s.Len(actual.ResourceSpans, 1)
+	s.Equal("service.name", actual.ResourceSpans[0].Resource.Attributes[0].Key)
+	s.Equal("proxy", *actual.ResourceSpans[0].Resource.Attributes[0].Value.StringValue)
+	spans := actual.ResourceSpans[0].ScopeSpans[0].Spans
+	s.Len(spans, 1)
+	s.Equal(entry.TraceID, spans[0].TraceID)
+	s.Equal(entry.SpanID, spans[0].SpanID)
+	s.Equal(entry.ParentSpanID, spans[0].ParentSpanID)
+	s.Equal(2, spans[0].Kind)
+	s.Equal(2, spans[0].Status.Code)
+	s.Equal(fmt.Sprint(entry.Timestamp.UnixNano()), spans[0].StartTimeUnixNano)
+	s.Equal(fmt.Sprint(entry.Timestamp.Add(time.Duration(entry.TimeTotal)*time.Millisecond).UnixNano()), spans[0].EndTimeUnixNano)
+	s.Contains(spans[0].Attributes, otlpInt("http.status_code", 503))
+	s.Contains(spans[0].Attributes, otlpString("http.request_id", "abc"))
+}
+
+func (s *SinkTestSuite) Test_HttpSink_ReturnsError_WhenStatusIsNotSuccessful() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	defer s.setEnv("ACCESS_LOG_BATCH_SIZE", "1")()
+	sink := newHTTPSink(&lokiEncoder{url: srv.URL})
+
+	err := sink.Write(s.entry, s.line)
+
+	s.Error(err)
+}
+
+// Util
+
+func (s *SinkTestSuite) setEnv(name, value string) func() {
+	orig := os.Getenv(name)
+	os.Setenv(name, value)
+	return func() { os.Setenv(name, orig) }
+}
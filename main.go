@@ -6,12 +6,19 @@ import (
 	"strings"
 
 	"github.com/docker-flow/docker-flow-proxy/logging"
+	"github.com/docker-flow/docker-flow-proxy/metrics"
 )
 
 func main() {
 	log.SetOutput(os.Stdout)
+	logMetrics := strings.EqualFold(os.Getenv("ACCESS_LOG_METRICS"), "true")
+	if logMetrics {
+		logging.AddSink(metrics.SetupLogMetrics())
+	}
 	if strings.EqualFold(os.Getenv("DEBUG"), "true") {
 		go logging.StartLogging()
+	} else if logMetrics {
+		go logging.StartSinkLogging()
 	}
 
 	// TODO: Change to serverImpl.Execute
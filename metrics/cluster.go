@@ -0,0 +1,242 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/log"
+)
+
+const replicaLabelName = "replica"
+
+var lookupHost = net.LookupHost
+
+// ClusterHandler serves metrics of all the replicas of the proxy when the `distribute` query parameter is set to `true`.
+// Otherwise, it serves metrics of the local replica.
+type ClusterHandler struct {
+	// The name of the proxy service. Replicas are discovered through the `tasks.<ServiceName>` DNS entry.
+	ServiceName string
+	// The port replicas are listening on.
+	Port string
+	// The maximum time a replica is allowed to respond.
+	Timeout time.Duration
+	local   http.Handler
+	client  *http.Client
+}
+
+// NewClusterHandler returns a handler that aggregates metrics of all the replicas.
+// The scrape timeout is defined through `METRICS_SCRAPE_TIMEOUT`.
+var NewClusterHandler = func(serviceName, port string, local http.Handler) http.Handler {
+	timeout, err := strconv.Atoi(os.Getenv("METRICS_SCRAPE_TIMEOUT"))
+	if err != nil || timeout <= 0 {
+		timeout = 5
+	}
+	return &ClusterHandler{
+		ServiceName: serviceName,
+		Port:        port,
+		Timeout:     time.Duration(timeout) * time.Second,
+		local:       local,
+		client:      &http.Client{},
+	}
+}
+
+type replicaMetrics struct {
+	replica  string
+	families []*dto.MetricFamily
+	err      error
+}
+
+// ServeHTTP scrapes all the replicas concurrently and adds the `replica` label to their metrics.
+// Replicas that fail to respond are reported through the `haproxy_replica_up` metric.
+// Counters are summed across replicas if the `sum` query parameter is set to `true` or to a comma separated list of metric names.
+func (m *ClusterHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !strings.EqualFold(req.URL.Query().Get("distribute"), "true") {
+		m.local.ServeHTTP(w, req)
+		return
+	}
+	dns := fmt.Sprintf("tasks.%s", m.ServiceName)
+	ips, err := lookupHost(dns)
+	if err != nil {
+		log.Errorf("Could not resolve %s: %v", dns, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	sort.Strings(ips)
+	results := make([]replicaMetrics, len(ips))
+	wg := sync.WaitGroup{}
+	for i, ip := range ips {
+		wg.Add(1)
+		go func(i int, ip string) {
+			defer wg.Done()
+			families, err := m.scrape(ip)
+			if err != nil {
+				log.Errorf("Could not scrape metrics of the replica %s: %v", ip, err)
+			}
+			results[i] = replicaMetrics{replica: ip, families: families, err: err}
+		}(i, ip)
+	}
+	wg.Wait()
+	families := mergeReplicaMetrics(results, getSummedMetrics(req.URL.Query().Get("sum")))
+	format := expfmt.Negotiate(req.Header)
+	w.Header().Set("Content-Type", string(format))
+	encoder := expfmt.NewEncoder(w, format)
+	for _, family := range families {
+		if err := encoder.Encode(family); err != nil {
+			log.Errorf("Could not encode metrics: %v", err)
+			return
+		}
+	}
+}
+
+func (m *ClusterHandler) scrape(ip string) ([]*dto.MetricFamily, error) {
+	addr := ip
+	if !strings.Contains(ip, ":") {
+		addr = net.JoinHostPort(ip, m.Port)
+	}
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://%s/metrics", addr), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", string(expfmt.FmtText))
+	client := *m.client
+	client.Timeout = m.Timeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got response status %d", resp.StatusCode)
+	}
+	decoder := expfmt.NewDecoder(resp.Body, expfmt.ResponseFormat(resp.Header))
+	families := []*dto.MetricFamily{}
+	for {
+		family := &dto.MetricFamily{}
+		if err := decoder.Decode(family); err != nil {
+			if err == io.EOF {
+				return families, nil
+			}
+			return nil, err
+		}
+		families = append(families, family)
+	}
+}
+
+// getSummedMetrics returns a function that tells whether a counter should be summed across replicas
+func getSummedMetrics(sum string) func(name string) bool {
+	if strings.EqualFold(sum, "true") {
+		return func(name string) bool { return true }
+	}
+	names := map[string]bool{}
+	for _, name := range strings.Split(sum, ",") {
+		if name = strings.TrimSpace(name); len(name) > 0 {
+			names[name] = true
+		}
+	}
+	return func(name string) bool { return names[name] }
+}
+
+// mergeReplicaMetrics combines metric families of all the replicas into one set sorted by name
+func mergeReplicaMetrics(results []replicaMetrics, summed func(name string) bool) []*dto.MetricFamily {
+	up := &dto.MetricFamily{
+		Name: stringPtr(namespace + "_replica_up"),
+		Help: stringPtr("Was the last scrape of the replica successful."),
+		Type: dto.MetricType_GAUGE.Enum(),
+	}
+	byName := map[string]*dto.MetricFamily{up.GetName(): up}
+	for _, result := range results {
+		value := 1.0
+		if result.err != nil {
+			value = 0
+		}
+		up.Metric = append(up.Metric, &dto.Metric{
+			Label: []*dto.LabelPair{{Name: stringPtr(replicaLabelName), Value: stringPtr(result.replica)}},
+			Gauge: &dto.Gauge{Value: &value},
+		})
+		for _, family := range result.families {
+			merged, ok := byName[family.GetName()]
+			if !ok {
+				merged = &dto.MetricFamily{Name: family.Name, Help: family.Help, Type: family.Type}
+				byName[family.GetName()] = merged
+			}
+			if merged.GetType() != family.GetType() {
+				log.Errorf("Metric %s of the replica %s has an inconsistent type", family.GetName(), result.replica)
+				continue
+			}
+			if family.GetType() == dto.MetricType_COUNTER && summed(family.GetName()) {
+				merged.Metric = sumCounters(merged.Metric, family.Metric)
+				continue
+			}
+			for _, metric := range family.Metric {
+				metric.Label = addReplicaLabel(metric.Label, result.replica)
+				merged.Metric = append(merged.Metric, metric)
+			}
+		}
+	}
+	names := []string{}
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	families := []*dto.MetricFamily{}
+	for _, name := range names {
+		families = append(families, byName[name])
+	}
+	return families
+}
+
+// sumCounters adds the values of counters to those with the same labels
+func sumCounters(sums, counters []*dto.Metric) []*dto.Metric {
+	for _, counter := range counters {
+		found := false
+		for _, sum := range sums {
+			if labelsEqual(sum.Label, counter.Label) {
+				value := sum.GetCounter().GetValue() + counter.GetCounter().GetValue()
+				sum.Counter.Value = &value
+				found = true
+				break
+			}
+		}
+		if !found {
+			value := counter.GetCounter().GetValue()
+			sums = append(sums, &dto.Metric{Label: counter.Label, Counter: &dto.Counter{Value: &value}})
+		}
+	}
+	return sums
+}
+
+func labelsEqual(a, b []*dto.LabelPair) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	values := map[string]string{}
+	for _, label := range a {
+		values[label.GetName()] = label.GetValue()
+	}
+	for _, label := range b {
+		if value, ok := values[label.GetName()]; !ok || value != label.GetValue() {
+			return false
+		}
+	}
+	return true
+}
+
+func addReplicaLabel(labels []*dto.LabelPair, replica string) []*dto.LabelPair {
+	labels = append(labels, &dto.LabelPair{Name: stringPtr(replicaLabelName), Value: stringPtr(replica)})
+	sort.Slice(labels, func(i, j int) bool { return labels[i].GetName() < labels[j].GetName() })
+	return labels
+}
+
+func stringPtr(value string) *string {
+	return &value
+}
@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ClusterTestSuite struct {
+	suite.Suite
+	replicas []*httptest.Server
+}
+
+func TestClusterUnitTestSuite(t *testing.T) {
+	suite.Run(t, new(ClusterTestSuite))
+}
+
+func (s *ClusterTestSuite) SetupTest() {
+	s.replicas = []*httptest.Server{
+		s.getReplica(`# HELP haproxy_backend_connections_total Total number of connections.
+# TYPE haproxy_backend_connections_total counter
+haproxy_backend_connections_total{backend="go-demo-be8080_0"} 10
+# HELP haproxy_up Was the last scrape of haproxy successful.
+# TYPE haproxy_up gauge
+haproxy_up 1
+`, 0),
+		s.getReplica(`# HELP haproxy_backend_connections_total Total number of connections.
+# TYPE haproxy_backend_connections_total counter
+haproxy_backend_connections_total{backend="go-demo-be8080_0"} 5
+haproxy_backend_connections_total{backend="redis-be6379_0"} 1
+# HELP haproxy_up Was the last scrape of haproxy successful.
+# TYPE haproxy_up gauge
+haproxy_up 1
+`, 0),
+	}
+}
+
+func (s *ClusterTestSuite) TearDownTest() {
+	for _, replica := range s.replicas {
+		replica.Close()
+	}
+}
+
+// ServeHTTP
+
+func (s *ClusterTestSuite) Test_ServeHTTP_InvokesLocalHandler_WhenDistributeIsNotSet() {
+	invoked := false
+	local := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { invoked = true })
+	handler := NewClusterHandler("proxy", "8080", local)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics", nil))
+
+	s.True(invoked)
+}
+
+func (s *ClusterTestSuite) Test_ServeHTTP_AddsReplicaLabel() {
+	defer s.mockLookupHost()()
+
+	actual := s.serve("/metrics?distribute=true")
+
+	r1, r2 := s.getAddr(0), s.getAddr(1)
+	s.Contains(actual, fmt.Sprintf(`haproxy_backend_connections_total{backend="go-demo-be8080_0",replica="%s"} 10`, r1))
+	s.Contains(actual, fmt.Sprintf(`haproxy_backend_connections_total{backend="go-demo-be8080_0",replica="%s"} 5`, r2))
+	s.Contains(actual, fmt.Sprintf(`haproxy_up{replica="%s"} 1`, r1))
+	s.Contains(actual, fmt.Sprintf(`haproxy_replica_up{replica="%s"} 1`, r2))
+	s.Equal(1, strings.Count(actual, "# TYPE haproxy_backend_connections_total counter"))
+}
+
+func (s *ClusterTestSuite) Test_ServeHTTP_SumsCounters_WhenRequested() {
+	defer s.mockLookupHost()()
+
+	for _, sum := range []string{"true", "haproxy_backend_connections_total"} {
+		actual := s.serve("/metrics?distribute=true&sum=" + sum)
+
+		s.Contains(actual, `haproxy_backend_connections_total{backend="go-demo-be8080_0"} 15`)
+		s.Contains(actual, `haproxy_backend_connections_total{backend="redis-be6379_0"} 1`)
+		s.Contains(actual, fmt.Sprintf(`haproxy_up{replica="%s"} 1`, s.getAddr(0)))
+	}
+}
+
+func (s *ClusterTestSuite) Test_ServeHTTP_ReportsReplicasThatFailed() {
+	s.replicas = append(s.replicas, s.getReplica("", http.StatusInternalServerError))
+	s.replicas = append(s.replicas, httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	})))
+	defer s.mockLookupHost()()
+	handler := NewClusterHandler("proxy", "8080", nil).(*ClusterHandler)
+	handler.Timeout = 100 * time.Millisecond
+
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest("GET", "/metrics?distribute=true", nil))
+
+	body, _ := ioutil.ReadAll(rw.Body)
+	actual := string(body)
+	s.Equal(http.StatusOK, rw.Code)
+	s.Contains(actual, fmt.Sprintf(`haproxy_replica_up{replica="%s"} 1`, s.getAddr(0)))
+	s.Contains(actual, fmt.Sprintf(`haproxy_replica_up{replica="%s"} 0`, s.getAddr(2)))
+	s.Contains(actual, fmt.Sprintf(`haproxy_replica_up{replica="%s"} 0`, s.getAddr(3)))
+	s.Contains(actual, fmt.Sprintf(`haproxy_backend_connections_total{backend="go-demo-be8080_0",replica="%s"} 10`, s.getAddr(0)))
+}
+
+func (s *ClusterTestSuite) Test_ServeHTTP_ReturnsStatus500_WhenLookupFails() {
+	lookupHostOrig := lookupHost
+	defer func() { lookupHost = lookupHostOrig }()
+	lookupHost = func(host string) ([]string, error) {
+		return nil, fmt.Errorf("This is an lookup error")
+	}
+	rw := httptest.NewRecorder()
+
+	NewClusterHandler("proxy", "8080", nil).ServeHTTP(rw, httptest.NewRequest("GET", "/metrics?distribute=true", nil))
+
+	s.Equal(http.StatusInternalServerError, rw.Code)
+}
+
+// Util
+
+func (s *ClusterTestSuite) getReplica(body string, status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("/metrics", r.URL.Path)
+		s.Empty(r.URL.Query().Get("distribute"))
+		if status > 0 {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprint(w, body)
+	}))
+}
+
+func (s *ClusterTestSuite) getAddr(index int) string {
+	return strings.TrimPrefix(s.replicas[index].URL, "http://")
+}
+
+func (s *ClusterTestSuite) mockLookupHost() func() {
+	lookupHostOrig := lookupHost
+	lookupHost = func(host string) ([]string, error) {
+		s.Equal("tasks.proxy", host)
+		addrs := []string{}
+		for i := range s.replicas {
+			addrs = append(addrs, s.getAddr(i))
+		}
+		return addrs, nil
+	}
+	return func() { lookupHost = lookupHostOrig }
+}
+
+func (s *ClusterTestSuite) serve(url string) string {
+	rw := httptest.NewRecorder()
+	NewClusterHandler("proxy", "8080", nil).ServeHTTP(rw, httptest.NewRequest("GET", url, nil))
+	s.Equal(http.StatusOK, rw.Code)
+	body, _ := ioutil.ReadAll(rw.Body)
+	return string(body)
+}
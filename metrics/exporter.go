@@ -23,12 +23,11 @@ import (
 const (
 	namespace = "haproxy" // For Prometheus metrics.
 
-	// HAProxy 1.4
-	// # pxname,svname,qcur,qmax,scur,smax,slim,stot,bin,bout,dreq,dresp,ereq,econ,eresp,wretr,wredis,status,weight,act,bck,chkfail,chkdown,lastchg,downtime,qlimit,pid,iid,sid,throttle,lbtot,tracked,type,rate,rate_lim,rate_max,check_status,check_code,check_duration,hrsp_1xx,hrsp_2xx,hrsp_3xx,hrsp_4xx,hrsp_5xx,hrsp_other,hanafail,req_rate,req_rate_max,req_tot,cli_abrt,srv_abrt,
-	// HAProxy 1.5
-	// pxname,svname,qcur,qmax,scur,smax,slim,stot,bin,bout,dreq,dresp,ereq,econ,eresp,wretr,wredis,status,weight,act,bck,chkfail,chkdown,lastchg,downtime,qlimit,pid,iid,sid,throttle,lbtot,tracked,type,rate,rate_lim,rate_max,check_status,check_code,check_duration,hrsp_1xx,hrsp_2xx,hrsp_3xx,hrsp_4xx,hrsp_5xx,hrsp_other,hanafail,req_rate,req_rate_max,req_tot,cli_abrt,srv_abrt,comp_in,comp_out,comp_byp,comp_rsp,lastsess,
-	expectedCsvFieldCount = 52
-	statusField           = 17
+	// The CSV output of `show stat` starts with a header line (e.g. `# pxname,svname,qcur,...`).
+	// Columns are mapped by their names since each HAProxy version adds new fields.
+	pxnameField = "pxname"
+	svnameField = "svname"
+	typeField   = "type"
 )
 
 var (
@@ -58,90 +57,92 @@ func SetupHandler(creds string) {
 			log.Fatal(err)
 		}
 		prometheus.MustRegister(exporter)
+		prometheus.MustRegister(ServiceInfoCollector{})
+		prometheus.MustRegister(UdpCollector{})
 		prometheus.MustRegister(version.NewCollector("haproxy_exporter"))
 		isInitialized = true
 	}
 	//	log.Fatal(http.ListenAndServe(*listenAddress, nil))
 }
 
-func newFrontendMetric(metricName string, docString string, constLabels prometheus.Labels) *prometheus.GaugeVec {
-	return prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace:   namespace,
-			Name:        "frontend_" + metricName,
-			Help:        docString,
-			ConstLabels: constLabels,
-		},
-		frontendLabelNames,
-	)
+// metricInfo describes a metric exported from a CSV column
+type metricInfo struct {
+	Desc *prometheus.Desc
+	Type prometheus.ValueType
 }
 
-func newBackendMetric(metricName string, docString string, constLabels prometheus.Labels) *prometheus.GaugeVec {
-	return prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace:   namespace,
-			Name:        "backend_" + metricName,
-			Help:        docString,
-			ConstLabels: constLabels,
-		},
-		backendLabelNames,
-	)
+func newMetric(subsystem, metricName, docString string, t prometheus.ValueType, labelNames []string, constLabels prometheus.Labels) metricInfo {
+	return metricInfo{
+		Desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, metricName),
+			docString,
+			labelNames,
+			constLabels,
+		),
+		Type: t,
+	}
 }
 
-func newServerMetric(metricName string, docString string, constLabels prometheus.Labels) *prometheus.GaugeVec {
-	return prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace:   namespace,
-			Name:        "server_" + metricName,
-			Help:        docString,
-			ConstLabels: constLabels,
-		},
-		serverLabelNames,
-	)
+func newFrontendMetric(metricName string, docString string, t prometheus.ValueType, constLabels prometheus.Labels) metricInfo {
+	return newMetric("frontend", metricName, docString, t, frontendLabelNames, constLabels)
+}
+
+func newBackendMetric(metricName string, docString string, t prometheus.ValueType, constLabels prometheus.Labels) metricInfo {
+	return newMetric("backend", metricName, docString, t, backendLabelNames, constLabels)
+}
+
+func newServerMetric(metricName string, docString string, t prometheus.ValueType, constLabels prometheus.Labels) metricInfo {
+	return newMetric("server", metricName, docString, t, serverLabelNames, constLabels)
 }
 
-type metrics map[int]*prometheus.GaugeVec
+// metrics maps CSV column names to metrics
+type metrics map[string]metricInfo
 
 func (m metrics) String() string {
-	keys := make([]int, 0, len(m))
+	keys := make([]string, 0, len(m))
 	for k := range m {
 		keys = append(keys, k)
 	}
-	sort.Ints(keys)
-	s := make([]string, len(keys))
-	for i, k := range keys {
-		s[i] = strconv.Itoa(k)
-	}
-	return strings.Join(s, ",")
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
 }
 
 var (
 	serverMetrics = metrics{
-		2:  newServerMetric("current_queue", "Current number of queued requests assigned to this server.", nil),
-		3:  newServerMetric("max_queue", "Maximum observed number of queued requests assigned to this server.", nil),
-		4:  newServerMetric("current_sessions", "Current number of active sessions.", nil),
-		5:  newServerMetric("max_sessions", "Maximum observed number of active sessions.", nil),
-		6:  newServerMetric("limit_sessions", "Configured session limit.", nil),
-		7:  newServerMetric("connections_total", "Total number of connections.", nil),
-		8:  newServerMetric("bytes_in_total", "Current total of incoming bytes.", nil),
-		9:  newServerMetric("bytes_out_total", "Current total of outgoing bytes.", nil),
-		13: newServerMetric("connection_errors_total", "Total of connection errors.", nil),
-		14: newServerMetric("response_errors_total", "Total of response errors.", nil),
-		15: newServerMetric("retry_warnings_total", "Total of retry warnings.", nil),
-		16: newServerMetric("redispatch_warnings_total", "Total of redispatch warnings.", nil),
-		17: newServerMetric("up", "Current health status of the server (1 = UP, 0 = DOWN).", nil),
-		18: newServerMetric("weight", "Current weight of the server.", nil),
-		21: newServerMetric("check_failures_total", "Total number of failed health checks.", nil),
-		24: newServerMetric("downtime_seconds_total", "Total downtime in seconds.", nil),
-		33: newServerMetric("current_session_rate", "Current number of sessions per second over last elapsed second.", nil),
-		35: newServerMetric("max_session_rate", "Maximum observed number of sessions per second.", nil),
-		38: newServerMetric("check_duration_milliseconds", "Previously run health check duration, in milliseconds", nil),
-		39: newServerMetric("http_responses_total", "Total of HTTP responses.", prometheus.Labels{"code": "1xx"}),
-		40: newServerMetric("http_responses_total", "Total of HTTP responses.", prometheus.Labels{"code": "2xx"}),
-		41: newServerMetric("http_responses_total", "Total of HTTP responses.", prometheus.Labels{"code": "3xx"}),
-		42: newServerMetric("http_responses_total", "Total of HTTP responses.", prometheus.Labels{"code": "4xx"}),
-		43: newServerMetric("http_responses_total", "Total of HTTP responses.", prometheus.Labels{"code": "5xx"}),
-		44: newServerMetric("http_responses_total", "Total of HTTP responses.", prometheus.Labels{"code": "other"}),
+		"qcur":           newServerMetric("current_queue", "Current number of queued requests assigned to this server.", prometheus.GaugeValue, nil),
+		"qmax":           newServerMetric("max_queue", "Maximum observed number of queued requests assigned to this server.", prometheus.GaugeValue, nil),
+		"scur":           newServerMetric("current_sessions", "Current number of active sessions.", prometheus.GaugeValue, nil),
+		"smax":           newServerMetric("max_sessions", "Maximum observed number of active sessions.", prometheus.GaugeValue, nil),
+		"slim":           newServerMetric("limit_sessions", "Configured session limit.", prometheus.GaugeValue, nil),
+		"stot":           newServerMetric("connections_total", "Total number of connections.", prometheus.CounterValue, nil),
+		"bin":            newServerMetric("bytes_in_total", "Current total of incoming bytes.", prometheus.CounterValue, nil),
+		"bout":           newServerMetric("bytes_out_total", "Current total of outgoing bytes.", prometheus.CounterValue, nil),
+		"econ":           newServerMetric("connection_errors_total", "Total of connection errors.", prometheus.CounterValue, nil),
+		"eresp":          newServerMetric("response_errors_total", "Total of response errors.", prometheus.CounterValue, nil),
+		"wretr":          newServerMetric("retry_warnings_total", "Total of retry warnings.", prometheus.CounterValue, nil),
+		"wredis":         newServerMetric("redispatch_warnings_total", "Total of redispatch warnings.", prometheus.CounterValue, nil),
+		"status":         newServerMetric("up", "Current health status of the server (1 = UP, 0 = DOWN).", prometheus.GaugeValue, nil),
+		"weight":         newServerMetric("weight", "Current weight of the server.", prometheus.GaugeValue, nil),
+		"chkfail":        newServerMetric("check_failures_total", "Total number of failed health checks.", prometheus.CounterValue, nil),
+		"downtime":       newServerMetric("downtime_seconds_total", "Total downtime in seconds.", prometheus.CounterValue, nil),
+		"rate":           newServerMetric("current_session_rate", "Current number of sessions per second over last elapsed second.", prometheus.GaugeValue, nil),
+		"rate_max":       newServerMetric("max_session_rate", "Maximum observed number of sessions per second.", prometheus.GaugeValue, nil),
+		"check_status":   newServerMetric("check_up", "Result of the last health check (1 = passed, 0 = failed).", prometheus.GaugeValue, nil),
+		"check_duration": newServerMetric("check_duration_milliseconds", "Previously run health check duration, in milliseconds", prometheus.GaugeValue, nil),
+		"agent_status":   newServerMetric("agent_up", "Result of the last agent check (1 = passed, 0 = failed).", prometheus.GaugeValue, nil),
+		"hrsp_1xx":       newServerMetric("http_responses_total", "Total of HTTP responses.", prometheus.CounterValue, prometheus.Labels{"code": "1xx"}),
+		"hrsp_2xx":       newServerMetric("http_responses_total", "Total of HTTP responses.", prometheus.CounterValue, prometheus.Labels{"code": "2xx"}),
+		"hrsp_3xx":       newServerMetric("http_responses_total", "Total of HTTP responses.", prometheus.CounterValue, prometheus.Labels{"code": "3xx"}),
+		"hrsp_4xx":       newServerMetric("http_responses_total", "Total of HTTP responses.", prometheus.CounterValue, prometheus.Labels{"code": "4xx"}),
+		"hrsp_5xx":       newServerMetric("http_responses_total", "Total of HTTP responses.", prometheus.CounterValue, prometheus.Labels{"code": "5xx"}),
+		"hrsp_other":     newServerMetric("http_responses_total", "Total of HTTP responses.", prometheus.CounterValue, prometheus.Labels{"code": "other"}),
+		"cli_abrt":       newServerMetric("client_aborts_total", "Total number of data transfers aborted by the client.", prometheus.CounterValue, nil),
+		"srv_abrt":       newServerMetric("server_aborts_total", "Total number of data transfers aborted by the server.", prometheus.CounterValue, nil),
+		"qtime":          newServerMetric("queue_time_average_milliseconds", "Average queue time over the last 1024 successful connections.", prometheus.GaugeValue, nil),
+		"ctime":          newServerMetric("connect_time_average_milliseconds", "Average connect time over the last 1024 successful connections.", prometheus.GaugeValue, nil),
+		"rtime":          newServerMetric("response_time_average_milliseconds", "Average response time over the last 1024 successful connections.", prometheus.GaugeValue, nil),
+		"ttime":          newServerMetric("total_time_average_milliseconds", "Average total session time over the last 1024 successful connections.", prometheus.GaugeValue, nil),
+		"eint":           newServerMetric("internal_errors_total", "Total number of internal errors.", prometheus.CounterValue, nil),
 	}
 )
 
@@ -154,11 +155,11 @@ type Exporter struct {
 
 	up                                             prometheus.Gauge
 	totalScrapes, csvParseFailures                 prometheus.Counter
-	frontendMetrics, backendMetrics, serverMetrics map[int]*prometheus.GaugeVec
+	frontendMetrics, backendMetrics, serverMetrics metrics
 }
 
 // NewExporter returns an initialized Exporter.
-func NewExporter(uri string, selectedServerMetrics map[int]*prometheus.GaugeVec, timeout time.Duration) (*Exporter, error) {
+func NewExporter(uri string, selectedServerMetrics metrics, timeout time.Duration) (*Exporter, error) {
 	u, err := url.Parse(uri)
 	if err != nil {
 		return nil, err
@@ -192,49 +193,57 @@ func NewExporter(uri string, selectedServerMetrics map[int]*prometheus.GaugeVec,
 			Name:      "exporter_csv_parse_failures",
 			Help:      "Number of errors while parsing CSV.",
 		}),
-		frontendMetrics: map[int]*prometheus.GaugeVec{
-			4:  newFrontendMetric("current_sessions", "Current number of active sessions.", nil),
-			5:  newFrontendMetric("max_sessions", "Maximum observed number of active sessions.", nil),
-			6:  newFrontendMetric("limit_sessions", "Configured session limit.", nil),
-			7:  newFrontendMetric("connections_total", "Total number of connections.", nil),
-			8:  newFrontendMetric("bytes_in_total", "Current total of incoming bytes.", nil),
-			9:  newFrontendMetric("bytes_out_total", "Current total of outgoing bytes.", nil),
-			10: newFrontendMetric("requests_denied_total", "Total of requests denied for security.", nil),
-			12: newFrontendMetric("request_errors_total", "Total of request errors.", nil),
-			33: newFrontendMetric("current_session_rate", "Current number of sessions per second over last elapsed second.", nil),
-			34: newFrontendMetric("limit_session_rate", "Configured limit on new sessions per second.", nil),
-			35: newFrontendMetric("max_session_rate", "Maximum observed number of sessions per second.", nil),
-			39: newFrontendMetric("http_responses_total", "Total of HTTP responses.", prometheus.Labels{"code": "1xx"}),
-			40: newFrontendMetric("http_responses_total", "Total of HTTP responses.", prometheus.Labels{"code": "2xx"}),
-			41: newFrontendMetric("http_responses_total", "Total of HTTP responses.", prometheus.Labels{"code": "3xx"}),
-			42: newFrontendMetric("http_responses_total", "Total of HTTP responses.", prometheus.Labels{"code": "4xx"}),
-			43: newFrontendMetric("http_responses_total", "Total of HTTP responses.", prometheus.Labels{"code": "5xx"}),
-			44: newFrontendMetric("http_responses_total", "Total of HTTP responses.", prometheus.Labels{"code": "other"}),
-			48: newFrontendMetric("http_requests_total", "Total HTTP requests.", nil),
+		frontendMetrics: metrics{
+			"scur":       newFrontendMetric("current_sessions", "Current number of active sessions.", prometheus.GaugeValue, nil),
+			"smax":       newFrontendMetric("max_sessions", "Maximum observed number of active sessions.", prometheus.GaugeValue, nil),
+			"slim":       newFrontendMetric("limit_sessions", "Configured session limit.", prometheus.GaugeValue, nil),
+			"stot":       newFrontendMetric("connections_total", "Total number of connections.", prometheus.CounterValue, nil),
+			"bin":        newFrontendMetric("bytes_in_total", "Current total of incoming bytes.", prometheus.CounterValue, nil),
+			"bout":       newFrontendMetric("bytes_out_total", "Current total of outgoing bytes.", prometheus.CounterValue, nil),
+			"dreq":       newFrontendMetric("requests_denied_total", "Total of requests denied for security.", prometheus.CounterValue, nil),
+			"ereq":       newFrontendMetric("request_errors_total", "Total of request errors.", prometheus.CounterValue, nil),
+			"rate":       newFrontendMetric("current_session_rate", "Current number of sessions per second over last elapsed second.", prometheus.GaugeValue, nil),
+			"rate_lim":   newFrontendMetric("limit_session_rate", "Configured limit on new sessions per second.", prometheus.GaugeValue, nil),
+			"rate_max":   newFrontendMetric("max_session_rate", "Maximum observed number of sessions per second.", prometheus.GaugeValue, nil),
+			"hrsp_1xx":   newFrontendMetric("http_responses_total", "Total of HTTP responses.", prometheus.CounterValue, prometheus.Labels{"code": "1xx"}),
+			"hrsp_2xx":   newFrontendMetric("http_responses_total", "Total of HTTP responses.", prometheus.CounterValue, prometheus.Labels{"code": "2xx"}),
+			"hrsp_3xx":   newFrontendMetric("http_responses_total", "Total of HTTP responses.", prometheus.CounterValue, prometheus.Labels{"code": "3xx"}),
+			"hrsp_4xx":   newFrontendMetric("http_responses_total", "Total of HTTP responses.", prometheus.CounterValue, prometheus.Labels{"code": "4xx"}),
+			"hrsp_5xx":   newFrontendMetric("http_responses_total", "Total of HTTP responses.", prometheus.CounterValue, prometheus.Labels{"code": "5xx"}),
+			"hrsp_other": newFrontendMetric("http_responses_total", "Total of HTTP responses.", prometheus.CounterValue, prometheus.Labels{"code": "other"}),
+			"req_tot":    newFrontendMetric("http_requests_total", "Total HTTP requests.", prometheus.CounterValue, nil),
+			"eint":       newFrontendMetric("internal_errors_total", "Total number of internal errors.", prometheus.CounterValue, nil),
 		},
-		backendMetrics: map[int]*prometheus.GaugeVec{
-			2:  newBackendMetric("current_queue", "Current number of queued requests not assigned to any server.", nil),
-			3:  newBackendMetric("max_queue", "Maximum observed number of queued requests not assigned to any server.", nil),
-			4:  newBackendMetric("current_sessions", "Current number of active sessions.", nil),
-			5:  newBackendMetric("max_sessions", "Maximum observed number of active sessions.", nil),
-			6:  newBackendMetric("limit_sessions", "Configured session limit.", nil),
-			7:  newBackendMetric("connections_total", "Total number of connections.", nil),
-			8:  newBackendMetric("bytes_in_total", "Current total of incoming bytes.", nil),
-			9:  newBackendMetric("bytes_out_total", "Current total of outgoing bytes.", nil),
-			13: newBackendMetric("connection_errors_total", "Total of connection errors.", nil),
-			14: newBackendMetric("response_errors_total", "Total of response errors.", nil),
-			15: newBackendMetric("retry_warnings_total", "Total of retry warnings.", nil),
-			16: newBackendMetric("redispatch_warnings_total", "Total of redispatch warnings.", nil),
-			17: newBackendMetric("up", "Current health status of the backend (1 = UP, 0 = DOWN).", nil),
-			18: newBackendMetric("weight", "Total weight of the servers in the backend.", nil),
-			33: newBackendMetric("current_session_rate", "Current number of sessions per second over last elapsed second.", nil),
-			35: newBackendMetric("max_session_rate", "Maximum number of sessions per second.", nil),
-			39: newBackendMetric("http_responses_total", "Total of HTTP responses.", prometheus.Labels{"code": "1xx"}),
-			40: newBackendMetric("http_responses_total", "Total of HTTP responses.", prometheus.Labels{"code": "2xx"}),
-			41: newBackendMetric("http_responses_total", "Total of HTTP responses.", prometheus.Labels{"code": "3xx"}),
-			42: newBackendMetric("http_responses_total", "Total of HTTP responses.", prometheus.Labels{"code": "4xx"}),
-			43: newBackendMetric("http_responses_total", "Total of HTTP responses.", prometheus.Labels{"code": "5xx"}),
-			44: newBackendMetric("http_responses_total", "Total of HTTP responses.", prometheus.Labels{"code": "other"}),
+		backendMetrics: metrics{
+			"qcur":       newBackendMetric("current_queue", "Current number of queued requests not assigned to any server.", prometheus.GaugeValue, nil),
+			"qmax":       newBackendMetric("max_queue", "Maximum observed number of queued requests not assigned to any server.", prometheus.GaugeValue, nil),
+			"scur":       newBackendMetric("current_sessions", "Current number of active sessions.", prometheus.GaugeValue, nil),
+			"smax":       newBackendMetric("max_sessions", "Maximum observed number of active sessions.", prometheus.GaugeValue, nil),
+			"slim":       newBackendMetric("limit_sessions", "Configured session limit.", prometheus.GaugeValue, nil),
+			"stot":       newBackendMetric("connections_total", "Total number of connections.", prometheus.CounterValue, nil),
+			"bin":        newBackendMetric("bytes_in_total", "Current total of incoming bytes.", prometheus.CounterValue, nil),
+			"bout":       newBackendMetric("bytes_out_total", "Current total of outgoing bytes.", prometheus.CounterValue, nil),
+			"econ":       newBackendMetric("connection_errors_total", "Total of connection errors.", prometheus.CounterValue, nil),
+			"eresp":      newBackendMetric("response_errors_total", "Total of response errors.", prometheus.CounterValue, nil),
+			"wretr":      newBackendMetric("retry_warnings_total", "Total of retry warnings.", prometheus.CounterValue, nil),
+			"wredis":     newBackendMetric("redispatch_warnings_total", "Total of redispatch warnings.", prometheus.CounterValue, nil),
+			"status":     newBackendMetric("up", "Current health status of the backend (1 = UP, 0 = DOWN).", prometheus.GaugeValue, nil),
+			"weight":     newBackendMetric("weight", "Total weight of the servers in the backend.", prometheus.GaugeValue, nil),
+			"rate":       newBackendMetric("current_session_rate", "Current number of sessions per second over last elapsed second.", prometheus.GaugeValue, nil),
+			"rate_max":   newBackendMetric("max_session_rate", "Maximum number of sessions per second.", prometheus.GaugeValue, nil),
+			"hrsp_1xx":   newBackendMetric("http_responses_total", "Total of HTTP responses.", prometheus.CounterValue, prometheus.Labels{"code": "1xx"}),
+			"hrsp_2xx":   newBackendMetric("http_responses_total", "Total of HTTP responses.", prometheus.CounterValue, prometheus.Labels{"code": "2xx"}),
+			"hrsp_3xx":   newBackendMetric("http_responses_total", "Total of HTTP responses.", prometheus.CounterValue, prometheus.Labels{"code": "3xx"}),
+			"hrsp_4xx":   newBackendMetric("http_responses_total", "Total of HTTP responses.", prometheus.CounterValue, prometheus.Labels{"code": "4xx"}),
+			"hrsp_5xx":   newBackendMetric("http_responses_total", "Total of HTTP responses.", prometheus.CounterValue, prometheus.Labels{"code": "5xx"}),
+			"hrsp_other": newBackendMetric("http_responses_total", "Total of HTTP responses.", prometheus.CounterValue, prometheus.Labels{"code": "other"}),
+			"cli_abrt":   newBackendMetric("client_aborts_total", "Total number of data transfers aborted by the client.", prometheus.CounterValue, nil),
+			"srv_abrt":   newBackendMetric("server_aborts_total", "Total number of data transfers aborted by the server.", prometheus.CounterValue, nil),
+			"qtime":      newBackendMetric("queue_time_average_milliseconds", "Average queue time over the last 1024 successful connections.", prometheus.GaugeValue, nil),
+			"ctime":      newBackendMetric("connect_time_average_milliseconds", "Average connect time over the last 1024 successful connections.", prometheus.GaugeValue, nil),
+			"rtime":      newBackendMetric("response_time_average_milliseconds", "Average response time over the last 1024 successful connections.", prometheus.GaugeValue, nil),
+			"ttime":      newBackendMetric("total_time_average_milliseconds", "Average total session time over the last 1024 successful connections.", prometheus.GaugeValue, nil),
+			"eint":       newBackendMetric("internal_errors_total", "Total number of internal errors.", prometheus.CounterValue, nil),
 		},
 		serverMetrics: selectedServerMetrics,
 	}, nil
@@ -244,13 +253,13 @@ func NewExporter(uri string, selectedServerMetrics map[int]*prometheus.GaugeVec,
 // implements prometheus.Collector.
 func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	for _, m := range e.frontendMetrics {
-		m.Describe(ch)
+		ch <- m.Desc
 	}
 	for _, m := range e.backendMetrics {
-		m.Describe(ch)
+		ch <- m.Desc
 	}
 	for _, m := range e.serverMetrics {
-		m.Describe(ch)
+		ch <- m.Desc
 	}
 	ch <- e.up.Desc()
 	ch <- e.totalScrapes.Desc()
@@ -263,13 +272,11 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 	e.mutex.Lock() // To protect metrics from concurrent collects.
 	defer e.mutex.Unlock()
 
-	e.resetMetrics()
-	e.scrape()
+	e.scrape(ch)
 
 	ch <- e.up
 	ch <- e.totalScrapes
 	ch <- e.csvParseFailures
-	e.collectMetrics(ch)
 }
 
 func fetchHTTP(uri string, timeout time.Duration) func() (io.ReadCloser, error) {
@@ -314,7 +321,7 @@ func fetchUnix(u *url.URL, timeout time.Duration) func() (io.ReadCloser, error)
 	}
 }
 
-func (e *Exporter) scrape() {
+func (e *Exporter) scrape(ch chan<- prometheus.Metric) {
 	e.totalScrapes.Inc()
 
 	body, err := e.fetch()
@@ -327,9 +334,10 @@ func (e *Exporter) scrape() {
 	e.up.Set(1)
 
 	reader := csv.NewReader(body)
-	reader.TrailingComma = true
-	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
 
+	var columns map[string]int
 loop:
 	for {
 		row, err := reader.Read()
@@ -347,42 +355,50 @@ loop:
 			e.up.Set(0)
 			break loop
 		}
-		e.parseRow(row)
-	}
-}
-
-func (e *Exporter) resetMetrics() {
-	for _, m := range e.frontendMetrics {
-		m.Reset()
-	}
-	for _, m := range e.backendMetrics {
-		m.Reset()
-	}
-	for _, m := range e.serverMetrics {
-		m.Reset()
+		if columns == nil {
+			columns, err = parseHeader(row)
+			if err != nil {
+				log.Errorf("Can't read CSV header: %v", err)
+				e.csvParseFailures.Inc()
+				e.up.Set(0)
+				break loop
+			}
+			continue
+		}
+		e.parseRow(ch, columns, row)
 	}
 }
 
-func (e *Exporter) collectMetrics(metrics chan<- prometheus.Metric) {
-	for _, m := range e.frontendMetrics {
-		m.Collect(metrics)
+// parseHeader returns indexes of columns mapped by their names
+func parseHeader(row []string) (map[string]int, error) {
+	if len(row) == 0 || !strings.HasPrefix(row[0], "#") {
+		return nil, errors.New("the first line is not a header")
 	}
-	for _, m := range e.backendMetrics {
-		m.Collect(metrics)
+	columns := map[string]int{}
+	for i, name := range row {
+		if i == 0 {
+			name = strings.TrimSpace(strings.TrimPrefix(name, "#"))
+		}
+		if len(name) > 0 {
+			columns[name] = i
+		}
 	}
-	for _, m := range e.serverMetrics {
-		m.Collect(metrics)
+	for _, name := range []string{pxnameField, svnameField, typeField} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("the column %s is missing", name)
+		}
 	}
+	return columns, nil
 }
 
-func (e *Exporter) parseRow(csvRow []string) {
-	if len(csvRow) < expectedCsvFieldCount {
-		log.Errorf("Wrong CSV field count: %d vs. %d", len(csvRow), expectedCsvFieldCount)
+func (e *Exporter) parseRow(ch chan<- prometheus.Metric, columns map[string]int, csvRow []string) {
+	if len(csvRow) <= columns[typeField] {
+		log.Errorf("Wrong CSV field count: %d", len(csvRow))
 		e.csvParseFailures.Inc()
 		return
 	}
 
-	pxname, svname, typ := csvRow[0], csvRow[1], csvRow[32]
+	pxname, svname, typ := csvRow[columns[pxnameField]], csvRow[columns[svnameField]], csvRow[columns[typeField]]
 
 	const (
 		frontend = "0"
@@ -393,11 +409,11 @@ func (e *Exporter) parseRow(csvRow []string) {
 
 	switch typ {
 	case frontend:
-		e.exportCsvFields(e.frontendMetrics, csvRow, pxname)
+		e.exportCsvFields(ch, e.frontendMetrics, columns, csvRow, pxname)
 	case backend:
-		e.exportCsvFields(e.backendMetrics, csvRow, pxname)
+		e.exportCsvFields(ch, e.backendMetrics, columns, csvRow, pxname)
 	case server:
-		e.exportCsvFields(e.serverMetrics, csvRow, pxname, svname)
+		e.exportCsvFields(ch, e.serverMetrics, columns, csvRow, pxname, svname)
 	}
 }
 
@@ -411,17 +427,34 @@ func parseStatusField(value string) int64 {
 	return 0
 }
 
-func (e *Exporter) exportCsvFields(metrics map[int]*prometheus.GaugeVec, csvRow []string, labels ...string) {
-	for fieldIdx, metric := range metrics {
+// parseCheckStatusField converts the result of a health or an agent check (e.g. `L7OK` or `* L4CON`).
+// An asterisk indicates that the check is in progress.
+func parseCheckStatusField(value string) int64 {
+	value = strings.TrimSpace(strings.TrimPrefix(value, "*"))
+	switch value {
+	case "L4OK", "L6OK", "L7OK", "L7OKC":
+		return 1
+	}
+	return 0
+}
+
+func (e *Exporter) exportCsvFields(ch chan<- prometheus.Metric, metrics metrics, columns map[string]int, csvRow []string, labels ...string) {
+	for field, metric := range metrics {
+		fieldIdx, ok := columns[field]
+		if !ok || fieldIdx >= len(csvRow) {
+			continue
+		}
 		valueStr := csvRow[fieldIdx]
 		if valueStr == "" {
 			continue
 		}
 
 		var value int64
-		switch fieldIdx {
-		case statusField:
+		switch field {
+		case "status":
 			value = parseStatusField(valueStr)
+		case "check_status", "agent_status":
+			value = parseCheckStatusField(valueStr)
 		default:
 			var err error
 			value, err = strconv.ParseInt(valueStr, 10, 64)
@@ -431,31 +464,24 @@ func (e *Exporter) exportCsvFields(metrics map[int]*prometheus.GaugeVec, csvRow
 				continue
 			}
 		}
-		metric.WithLabelValues(labels...).Set(float64(value))
+		ch <- prometheus.MustNewConstMetric(metric.Desc, metric.Type, float64(value), labels...)
 	}
 }
 
 // filterServerMetrics returns the set of server metrics specified by the comma
-// separated filter.
-func filterServerMetrics(filter string) (map[int]*prometheus.GaugeVec, error) {
-	metrics := map[int]*prometheus.GaugeVec{}
+// separated list of CSV column names.
+func filterServerMetrics(filter string) (metrics, error) {
+	selectedMetrics := metrics{}
 	if len(filter) == 0 {
-		return metrics, nil
+		return selectedMetrics, nil
 	}
 
-	selected := map[int]struct{}{}
 	for _, f := range strings.Split(filter, ",") {
-		field, err := strconv.Atoi(f)
-		if err != nil {
-			return nil, fmt.Errorf("invalid server metric field number: %v", f)
-		}
-		selected[field] = struct{}{}
-	}
-
-	for field, metric := range serverMetrics {
-		if _, ok := selected[field]; ok {
-			metrics[field] = metric
+		metric, ok := serverMetrics[strings.TrimSpace(f)]
+		if !ok {
+			return nil, fmt.Errorf("invalid server metric field: %v", f)
 		}
+		selectedMetrics[strings.TrimSpace(f)] = metric
 	}
-	return metrics, nil
+	return selectedMetrics, nil
 }
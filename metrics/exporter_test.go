@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	csvHeader15 = "# pxname,svname,qcur,qmax,scur,smax,slim,stot,bin,bout,dreq,dresp,ereq,econ,eresp,wretr,wredis,status,weight,act,bck,chkfail,chkdown,lastchg,downtime,qlimit,pid,iid,sid,throttle,lbtot,tracked,type,rate,rate_lim,rate_max,check_status,check_code,check_duration,hrsp_1xx,hrsp_2xx,hrsp_3xx,hrsp_4xx,hrsp_5xx,hrsp_other,hanafail,req_rate,req_rate_max,req_tot,cli_abrt,srv_abrt,comp_in,comp_out,comp_byp,comp_rsp,lastsess,"
+	csvHeader18 = "# pxname,svname,qcur,qmax,scur,smax,slim,stot,bin,bout,dreq,dresp,ereq,econ,eresp,wretr,wredis,status,weight,act,bck,chkfail,chkdown,lastchg,downtime,qlimit,pid,iid,sid,throttle,lbtot,tracked,type,rate,rate_lim,rate_max,check_status,check_code,check_duration,hrsp_1xx,hrsp_2xx,hrsp_3xx,hrsp_4xx,hrsp_5xx,hrsp_other,hanafail,req_rate,req_rate_max,req_tot,cli_abrt,srv_abrt,comp_in,comp_out,comp_byp,comp_rsp,lastsess,last_chk,last_agt,qtime,ctime,rtime,ttime,agent_status,agent_code,agent_duration,check_desc,agent_desc,check_rise,check_fall,check_health,agent_rise,agent_fall,agent_health,addr,cookie,mode,algo,conn_rate,conn_rate_max,conn_tot,intercepted,dcon,dses,wrew,connect,reuse,cache_lookups,cache_hits,srv_icur,src_ilim,qtime_max,ctime_max,rtime_max,ttime_max,eint,"
+)
+
+var fqNameRegexp = regexp.MustCompile(`fqName: "([^"]+)"`)
+
+type ExporterTestSuite struct {
+	suite.Suite
+}
+
+func TestExporterUnitTestSuite(t *testing.T) {
+	suite.Run(t, new(ExporterTestSuite))
+}
+
+// Collect
+
+func (s *ExporterTestSuite) Test_Collect_MapsColumnsByHeader() {
+	csv := s.getCsv(csvHeader15, map[string]string{
+		"pxname": "go-demo-be8080", "svname": "BACKEND", "type": "1",
+		"stot": "42", "scur": "3", "status": "UP", "hrsp_5xx": "7",
+	})
+
+	actual := s.collect(csv, serverMetrics)
+
+	s.Equal(metricValue{dto.MetricType_COUNTER, 42}, actual[`haproxy_backend_connections_total{backend="go-demo-be8080"}`])
+	s.Equal(metricValue{dto.MetricType_GAUGE, 3}, actual[`haproxy_backend_current_sessions{backend="go-demo-be8080"}`])
+	s.Equal(metricValue{dto.MetricType_GAUGE, 1}, actual[`haproxy_backend_up{backend="go-demo-be8080"}`])
+	s.Equal(metricValue{dto.MetricType_COUNTER, 7}, actual[`haproxy_backend_http_responses_total{backend="go-demo-be8080",code="5xx"}`])
+	s.Equal(metricValue{dto.MetricType_GAUGE, 1}, actual[`haproxy_up`])
+	s.NotContains(actual, `haproxy_backend_total_time_average_milliseconds{backend="go-demo-be8080"}`)
+}
+
+func (s *ExporterTestSuite) Test_Collect_ExportsNewerFields() {
+	csv := s.getCsv(csvHeader18, map[string]string{
+		"pxname": "go-demo-be8080", "svname": "go-demo", "type": "2",
+		"qtime": "1", "ctime": "2", "rtime": "30", "ttime": "45", "eint": "4",
+		"check_status": "L7OK", "agent_status": "* L4CON",
+	})
+
+	actual := s.collect(csv, serverMetrics)
+
+	labels := `{backend="go-demo-be8080",server="go-demo"}`
+	s.Equal(metricValue{dto.MetricType_GAUGE, 1}, actual["haproxy_server_queue_time_average_milliseconds"+labels])
+	s.Equal(metricValue{dto.MetricType_GAUGE, 2}, actual["haproxy_server_connect_time_average_milliseconds"+labels])
+	s.Equal(metricValue{dto.MetricType_GAUGE, 30}, actual["haproxy_server_response_time_average_milliseconds"+labels])
+	s.Equal(metricValue{dto.MetricType_GAUGE, 45}, actual["haproxy_server_total_time_average_milliseconds"+labels])
+	s.Equal(metricValue{dto.MetricType_COUNTER, 4}, actual["haproxy_server_internal_errors_total"+labels])
+	s.Equal(metricValue{dto.MetricType_GAUGE, 1}, actual["haproxy_server_check_up"+labels])
+	s.Equal(metricValue{dto.MetricType_GAUGE, 0}, actual["haproxy_server_agent_up"+labels])
+}
+
+func (s *ExporterTestSuite) Test_Collect_SetsUpToZero_WhenHeaderIsMissing() {
+	csv := "go-demo-be8080,BACKEND,0,0\n"
+
+	actual := s.collect(csv, serverMetrics)
+
+	s.Equal(metricValue{dto.MetricType_GAUGE, 0}, actual[`haproxy_up`])
+	s.Equal(metricValue{dto.MetricType_COUNTER, 1}, actual[`haproxy_exporter_csv_parse_failures`])
+}
+
+func (s *ExporterTestSuite) Test_Collect_CanBeRegistered() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	e, _ := NewExporter(srv.URL, serverMetrics, time.Second)
+
+	s.NoError(prometheus.NewRegistry().Register(e))
+}
+
+// filterServerMetrics
+
+func (s *ExporterTestSuite) Test_FilterServerMetrics_ReturnsSelectedMetrics() {
+	actual, err := filterServerMetrics("stot, ttime")
+
+	s.NoError(err)
+	s.Equal("stot,ttime", actual.String())
+}
+
+func (s *ExporterTestSuite) Test_FilterServerMetrics_ReturnsError_WhenFieldIsUnknown() {
+	_, err := filterServerMetrics("stot,unknown")
+
+	s.Error(err)
+}
+
+// Util
+
+type metricValue struct {
+	Type  dto.MetricType
+	Value float64
+}
+
+func (s *ExporterTestSuite) getCsv(header string, values map[string]string) string {
+	columns := strings.Split(strings.TrimPrefix(header, "# "), ",")
+	row := make([]string, len(columns))
+	for i, column := range columns {
+		row[i] = values[column]
+	}
+	return header + "\n" + strings.Join(row, ",") + "\n"
+}
+
+func (s *ExporterTestSuite) collect(csv string, serverMetrics metrics) map[string]metricValue {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, csv)
+	}))
+	defer srv.Close()
+	e, err := NewExporter(srv.URL, serverMetrics, time.Second)
+	s.Require().NoError(err)
+	ch := make(chan prometheus.Metric, 1000)
+	e.Collect(ch)
+	close(ch)
+	values := map[string]metricValue{}
+	for metric := range ch {
+		m := dto.Metric{}
+		metric.Write(&m)
+		name := fqNameRegexp.FindStringSubmatch(metric.Desc().String())[1]
+		labels := []string{}
+		for _, label := range m.Label {
+			labels = append(labels, fmt.Sprintf(`%s="%s"`, label.GetName(), label.GetValue()))
+		}
+		sort.Strings(labels)
+		if len(labels) > 0 {
+			name += "{" + strings.Join(labels, ",") + "}"
+		}
+		switch {
+		case m.Counter != nil:
+			values[name] = metricValue{dto.MetricType_COUNTER, m.Counter.GetValue()}
+		case m.Gauge != nil:
+			values[name] = metricValue{dto.MetricType_GAUGE, m.Gauge.GetValue()}
+		}
+	}
+	return values
+}
@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/docker-flow/docker-flow-proxy/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// otherLabelValue replaces label values once the cardinality limit is reached
+const otherLabelValue = "other"
+
+var logCollectorOnce sync.Once
+var logCollectorInstance *LogCollector
+
+// LogCollector derives request latencies and response codes from HAProxy access logs.
+// It is a logging sink that feeds Prometheus histograms and counters.
+type LogCollector struct {
+	mutex       sync.Mutex
+	maxBackends int
+	backends    map[string]bool
+	timers      map[string]*prometheus.HistogramVec
+	responses   *prometheus.CounterVec
+}
+
+// SetupLogMetrics registers access log metrics with Prometheus and returns the sink that feeds them.
+// Buckets are defined through `ACCESS_LOG_METRICS_BUCKETS` and the number of distinct backends through `ACCESS_LOG_METRICS_MAX_BACKENDS`.
+var SetupLogMetrics = func() logging.Sink {
+	logCollectorOnce.Do(func() {
+		buckets := getLogMetricsBuckets(os.Getenv("ACCESS_LOG_METRICS_BUCKETS"))
+		maxBackends, err := strconv.Atoi(os.Getenv("ACCESS_LOG_METRICS_MAX_BACKENDS"))
+		if err != nil || maxBackends <= 0 {
+			maxBackends = 100
+		}
+		logCollectorInstance = NewLogCollector(buckets, maxBackends)
+		prometheus.MustRegister(logCollectorInstance)
+	})
+	return logCollectorInstance
+}
+
+// NewLogCollector returns a collector with histograms that use the buckets (in seconds).
+// Backends above maxBackends are reported with the label `other`.
+func NewLogCollector(buckets []float64, maxBackends int) *LogCollector {
+	newTimer := func(name, help string) *prometheus.HistogramVec {
+		return prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "backend_" + name + "_time_seconds",
+				Help:      help,
+				Buckets:   buckets,
+			},
+			backendLabelNames,
+		)
+	}
+	return &LogCollector{
+		maxBackends: maxBackends,
+		backends:    map[string]bool{},
+		timers: map[string]*prometheus.HistogramVec{
+			"request":  newTimer("request", "Time spent waiting for a full HTTP request from the client (Tq)."),
+			"queue":    newTimer("queue", "Time spent waiting in queues (Tw)."),
+			"connect":  newTimer("connect", "Time spent establishing the connection to the server (Tc)."),
+			"response": newTimer("response", "Time spent waiting for the server to send a full HTTP response (Tr)."),
+			"total":    newTimer("total", "Time the request or the connection remained active in the proxy (Ta or Tt)."),
+		},
+		responses: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "backend_log_http_responses_total",
+				Help:      "Total of HTTP responses by status code, derived from access logs.",
+			},
+			[]string{"backend", "code"},
+		),
+	}
+}
+
+// Write observes the timers and the status of the entry
+func (c *LogCollector) Write(entry logging.Entry, line string) error {
+	if entry.Type != "http" && entry.Type != "tcp" {
+		return nil
+	}
+	backend := c.getBackendLabel(entry.Backend)
+	observe := func(timer string, value int) {
+		// HAProxy logs -1 when a timer could not be measured
+		if value >= 0 {
+			c.timers[timer].WithLabelValues(backend).Observe(float64(value) / 1000)
+		}
+	}
+	observe("queue", entry.TimeQueue)
+	observe("connect", entry.TimeConnect)
+	observe("total", entry.TimeTotal)
+	if entry.Type == "http" {
+		observe("request", entry.TimeRequest)
+		observe("response", entry.TimeResponse)
+		code := otherLabelValue
+		if entry.Status >= 100 && entry.Status < 600 {
+			code = strconv.Itoa(entry.Status)
+		}
+		c.responses.WithLabelValues(backend, code).Inc()
+	}
+	return nil
+}
+
+// Describe implements prometheus.Collector
+func (c *LogCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, timer := range c.timers {
+		timer.Describe(ch)
+	}
+	c.responses.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *LogCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, timer := range c.timers {
+		timer.Collect(ch)
+	}
+	c.responses.Collect(ch)
+}
+
+func (c *LogCollector) getBackendLabel(backend string) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.backends[backend] {
+		return backend
+	}
+	if len(c.backends) >= c.maxBackends {
+		return otherLabelValue
+	}
+	c.backends[backend] = true
+	return backend
+}
+
+func getLogMetricsBuckets(value string) []float64 {
+	if len(value) == 0 {
+		return prometheus.DefBuckets
+	}
+	buckets := []float64{}
+	for _, bucket := range strings.Split(value, ",") {
+		b, err := strconv.ParseFloat(strings.TrimSpace(bucket), 64)
+		if err != nil || (len(buckets) > 0 && b <= buckets[len(buckets)-1]) {
+			log.Errorf("%s are not valid access log metrics buckets. Default buckets will be used.", value)
+			return prometheus.DefBuckets
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/docker-flow/docker-flow-proxy/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/suite"
+)
+
+type LogTestSuite struct {
+	suite.Suite
+}
+
+func TestLogUnitTestSuite(t *testing.T) {
+	suite.Run(t, new(LogTestSuite))
+}
+
+// Write
+
+func (s *LogTestSuite) Test_Write_ObservesHttpTimers() {
+	c := NewLogCollector([]float64{0.05, 0.1}, 10)
+
+	c.Write(logging.ParseEntry(`10.0.0.3:51234 [09/Feb/2017:12:04:35.123] services go-demo-be8080/go-demo 10/0/30/69/109 200 2750 - - ---- 1/1/0/0/0 0/0 "GET /demo HTTP/1.1"`), "")
+	c.Write(logging.ParseEntry(`10.0.0.3:51234 [09/Feb/2017:12:04:35.123] services go-demo-be8080/go-demo 10/0/-1/-1/40 503 212 - - SC-- 1/1/0/0/0 0/0 "GET /demo HTTP/1.1"`), "")
+
+	total := s.getHistogram(c.timers["total"], "go-demo-be8080")
+	s.Equal(uint64(2), total.GetSampleCount())
+	s.InDelta(0.149, total.GetSampleSum(), 0.0001)
+	s.Equal(uint64(1), total.Bucket[0].GetCumulativeCount())
+	s.Equal(uint64(1), total.Bucket[1].GetCumulativeCount())
+	s.Equal(uint64(1), s.getHistogram(c.timers["response"], "go-demo-be8080").GetSampleCount())
+	s.Equal(uint64(2), s.getHistogram(c.timers["request"], "go-demo-be8080").GetSampleCount())
+	s.Equal(1.0, s.getCounter(c.responses, "go-demo-be8080", "200"))
+	s.Equal(1.0, s.getCounter(c.responses, "go-demo-be8080", "503"))
+}
+
+func (s *LogTestSuite) Test_Write_ObservesTcpTimers() {
+	c := NewLogCollector(prometheus.DefBuckets, 10)
+
+	c.Write(logging.ParseEntry(`10.0.0.3:51234 [09/Feb/2017:12:04:35.123] tcpFE_6379 redis-be6379/redis 0/1/5001 1024 -- 2/1/1/1/0 0/0`), "")
+
+	s.Equal(5.001, s.getHistogram(c.timers["total"], "redis-be6379").GetSampleSum())
+	s.Equal(uint64(0), s.getHistogram(c.timers["response"], "redis-be6379").GetSampleCount())
+}
+
+func (s *LogTestSuite) Test_Write_UsesOtherLabel_WhenMaxBackendsIsReached() {
+	c := NewLogCollector(prometheus.DefBuckets, 1)
+	entry := logging.Entry{Type: "http", Status: 200}
+
+	for _, backend := range []string{"be-1", "be-2", "be-3", "be-1"} {
+		entry.Backend = backend
+		c.Write(entry, "")
+	}
+
+	s.Equal(2.0, s.getCounter(c.responses, "be-1", "200"))
+	s.Equal(2.0, s.getCounter(c.responses, otherLabelValue, "200"))
+}
+
+func (s *LogTestSuite) Test_Write_IgnoresRawEntries() {
+	c := NewLogCollector(prometheus.DefBuckets, 10)
+
+	c.Write(logging.ParseEntry("Proxy started"), "")
+
+	ch := make(chan prometheus.Metric, 10)
+	c.Collect(ch)
+	s.Len(ch, 0)
+}
+
+// getLogMetricsBuckets
+
+func (s *LogTestSuite) Test_GetLogMetricsBuckets_ParsesValue() {
+	s.Equal([]float64{0.01, 0.5, 2}, getLogMetricsBuckets("0.01, 0.5,2"))
+}
+
+func (s *LogTestSuite) Test_GetLogMetricsBuckets_ReturnsDefaultBuckets_WhenValueIsInvalid() {
+	s.Equal(prometheus.DefBuckets, getLogMetricsBuckets(""))
+	s.Equal(prometheus.DefBuckets, getLogMetricsBuckets("0.5,abc"))
+	s.Equal(prometheus.DefBuckets, getLogMetricsBuckets("0.5,0.1"))
+}
+
+// Util
+
+func (s *LogTestSuite) getHistogram(vec *prometheus.HistogramVec, backend string) *dto.Histogram {
+	metric := dto.Metric{}
+	vec.WithLabelValues(backend).(prometheus.Histogram).Write(&metric)
+	return metric.Histogram
+}
+
+func (s *LogTestSuite) getCounter(vec *prometheus.CounterVec, labels ...string) float64 {
+	metric := dto.Metric{}
+	vec.WithLabelValues(labels...).Write(&metric)
+	return metric.Counter.GetValue()
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/docker-flow/docker-flow-proxy/proxy"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var serviceInfoDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "backend", "info"),
+	"Service destination behind a backend. The value is always 1. It can be joined with other backend and server metrics through the backend label.",
+	[]string{"backend", "service", "port", "dest_index", "domain", "path"},
+	nil,
+)
+
+// ServiceInfoCollector exports metadata of the services configured in the proxy
+type ServiceInfoCollector struct{}
+
+// Describe implements prometheus.Collector
+func (c ServiceInfoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- serviceInfoDesc
+}
+
+// Collect implements prometheus.Collector
+func (c ServiceInfoCollector) Collect(ch chan<- prometheus.Metric) {
+	if proxy.Instance == nil {
+		return
+	}
+	backends := map[string]bool{}
+	for _, s := range proxy.Instance.GetServices() {
+		for _, sd := range s.ServiceDest {
+			// UDP destinations are not served by HAProxy backends
+			if len(sd.Port) == 0 || sd.ReqMode == "udp" {
+				continue
+			}
+			for _, name := range proxy.GetBackendNames(s, sd) {
+				// Services with the same ACL name share backends
+				if backends[name] {
+					continue
+				}
+				backends[name] = true
+				ch <- prometheus.MustNewConstMetric(
+					serviceInfoDesc,
+					prometheus.GaugeValue,
+					1,
+					name,
+					s.ServiceName,
+					sd.Port,
+					strconv.Itoa(sd.Index),
+					strings.Join(sd.ServiceDomain, ","),
+					strings.Join(sd.ServicePath, ","),
+				)
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/docker-flow/docker-flow-proxy/proxy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/suite"
+)
+
+type ServiceInfoTestSuite struct {
+	suite.Suite
+}
+
+func TestServiceInfoUnitTestSuite(t *testing.T) {
+	suite.Run(t, new(ServiceInfoTestSuite))
+}
+
+// Collect
+
+func (s *ServiceInfoTestSuite) Test_Collect_ExportsServiceDestinations() {
+	instanceOrig := proxy.Instance
+	defer func() { proxy.Instance = instanceOrig }()
+	proxy.Instance = proxy.NewHaProxy("", "")
+	proxy.Instance.AddService(proxy.Service{
+		ServiceName: "go-demo",
+		ServiceDest: []proxy.ServiceDest{
+			{Port: "8080", Index: 0, ServicePath: []string{"/demo", "/api"}, ServiceDomain: []string{"example.com"}, HttpsPort: 8443},
+			{Port: "8081", Index: 1, ServicePath: []string{"/admin"}},
+			{Index: 2, ServicePath: []string{"/ignored"}},
+			{Port: "53", Index: 3, ReqMode: "udp", SrcPort: 53},
+		},
+	})
+	proxy.Instance.AddService(proxy.Service{
+		ServiceName: "redis",
+		AclName:     "db",
+		ServiceDest: []proxy.ServiceDest{{Port: "6379", Index: 0}},
+	})
+
+	actual := s.collect()
+
+	s.Equal([]map[string]string{
+		{"backend": "go-demo-be8080_0", "service": "go-demo", "port": "8080", "dest_index": "0", "domain": "example.com", "path": "/demo,/api"},
+		{"backend": "https-go-demo-be8443_0", "service": "go-demo", "port": "8080", "dest_index": "0", "domain": "example.com", "path": "/demo,/api"},
+		{"backend": "go-demo-be8081_1", "service": "go-demo", "port": "8081", "dest_index": "1", "domain": "", "path": "/admin"},
+	}, actual["go-demo"])
+	s.Equal([]map[string]string{
+		{"backend": "db-be6379_0", "service": "redis", "port": "6379", "dest_index": "0", "domain": "", "path": ""},
+	}, actual["redis"])
+}
+
+func (s *ServiceInfoTestSuite) Test_Collect_CanBeRegistered() {
+	s.NoError(prometheus.NewRegistry().Register(ServiceInfoCollector{}))
+}
+
+// Util
+
+func (s *ServiceInfoTestSuite) collect() map[string][]map[string]string {
+	ch := make(chan prometheus.Metric, 100)
+	ServiceInfoCollector{}.Collect(ch)
+	close(ch)
+	services := map[string][]map[string]string{}
+	for metric := range ch {
+		m := dto.Metric{}
+		metric.Write(&m)
+		s.Equal(1.0, m.Gauge.GetValue())
+		labels := map[string]string{}
+		for _, label := range m.Label {
+			labels[label.GetName()] = label.GetValue()
+		}
+		services[labels["service"]] = append(services[labels["service"]], labels)
+	}
+	return services
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"strconv"
+
+	"github.com/docker-flow/docker-flow-proxy/proxy"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var getUdpStats = proxy.GetUdpStats
+
+var udpLabelNames = []string{"service", "src_port", "port"}
+
+var (
+	udpTargetsDesc         = newUdpDesc("targets", "Number of replicas UDP packets are balanced across.")
+	udpCurrentSessionsDesc = newUdpDesc("current_sessions", "Current number of UDP sessions.")
+	udpSessionsDesc        = newUdpDesc("sessions_total", "Total number of UDP sessions.")
+	udpPacketsInDesc       = newUdpDesc("packets_in_total", "Total number of UDP packets received from clients.")
+	udpPacketsOutDesc      = newUdpDesc("packets_out_total", "Total number of UDP packets sent back to clients.")
+	udpBytesInDesc         = newUdpDesc("bytes_in_total", "Total of bytes received from clients.")
+	udpBytesOutDesc        = newUdpDesc("bytes_out_total", "Total of bytes sent back to clients.")
+	udpPacketsDroppedDesc  = newUdpDesc("packets_dropped_total", "Total number of UDP packets that could not be forwarded.")
+)
+
+func newUdpDesc(metricName, docString string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "udp", metricName), docString, udpLabelNames, nil)
+}
+
+// UdpCollector exports statistics of the UDP listeners served by the proxy process
+type UdpCollector struct{}
+
+// Describe implements prometheus.Collector
+func (c UdpCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- udpTargetsDesc
+	ch <- udpCurrentSessionsDesc
+	ch <- udpSessionsDesc
+	ch <- udpPacketsInDesc
+	ch <- udpPacketsOutDesc
+	ch <- udpBytesInDesc
+	ch <- udpBytesOutDesc
+	ch <- udpPacketsDroppedDesc
+}
+
+// Collect implements prometheus.Collector
+func (c UdpCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, stats := range getUdpStats() {
+		labels := []string{stats.ServiceName, strconv.Itoa(stats.SrcPort), stats.Port}
+		ch <- prometheus.MustNewConstMetric(udpTargetsDesc, prometheus.GaugeValue, float64(stats.Targets), labels...)
+		ch <- prometheus.MustNewConstMetric(udpCurrentSessionsDesc, prometheus.GaugeValue, float64(stats.CurrentSessions), labels...)
+		ch <- prometheus.MustNewConstMetric(udpSessionsDesc, prometheus.CounterValue, float64(stats.SessionsTotal), labels...)
+		ch <- prometheus.MustNewConstMetric(udpPacketsInDesc, prometheus.CounterValue, float64(stats.PacketsIn), labels...)
+		ch <- prometheus.MustNewConstMetric(udpPacketsOutDesc, prometheus.CounterValue, float64(stats.PacketsOut), labels...)
+		ch <- prometheus.MustNewConstMetric(udpBytesInDesc, prometheus.CounterValue, float64(stats.BytesIn), labels...)
+		ch <- prometheus.MustNewConstMetric(udpBytesOutDesc, prometheus.CounterValue, float64(stats.BytesOut), labels...)
+		ch <- prometheus.MustNewConstMetric(udpPacketsDroppedDesc, prometheus.CounterValue, float64(stats.PacketsDropped), labels...)
+	}
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/docker-flow/docker-flow-proxy/proxy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/suite"
+)
+
+type UdpTestSuite struct {
+	suite.Suite
+}
+
+func TestUdpUnitTestSuite(t *testing.T) {
+	suite.Run(t, new(UdpTestSuite))
+}
+
+// Collect
+
+func (s *UdpTestSuite) Test_Collect_ExportsUdpStats() {
+	getUdpStatsOrig := getUdpStats
+	defer func() { getUdpStats = getUdpStatsOrig }()
+	getUdpStats = func() []proxy.UdpStats {
+		return []proxy.UdpStats{{
+			ServiceName:     "dns",
+			SrcPort:         53,
+			Port:            "5353",
+			Targets:         3,
+			CurrentSessions: 2,
+			SessionsTotal:   10,
+			PacketsIn:       100,
+			PacketsOut:      90,
+			BytesIn:         1000,
+			BytesOut:        900,
+			PacketsDropped:  1,
+		}}
+	}
+	ch := make(chan prometheus.Metric, 100)
+
+	UdpCollector{}.Collect(ch)
+	close(ch)
+
+	actual := map[string]float64{}
+	for metric := range ch {
+		m := dto.Metric{}
+		metric.Write(&m)
+		for _, label := range m.Label {
+			s.Equal(map[string]string{"service": "dns", "src_port": "53", "port": "5353"}[label.GetName()], label.GetValue())
+		}
+		value := m.GetGauge().GetValue()
+		if m.Counter != nil {
+			value = m.GetCounter().GetValue()
+		}
+		actual[metric.Desc().String()] = value
+	}
+	s.Equal(3.0, actual[udpTargetsDesc.String()])
+	s.Equal(2.0, actual[udpCurrentSessionsDesc.String()])
+	s.Equal(10.0, actual[udpSessionsDesc.String()])
+	s.Equal(100.0, actual[udpPacketsInDesc.String()])
+	s.Equal(90.0, actual[udpPacketsOutDesc.String()])
+	s.Equal(1000.0, actual[udpBytesInDesc.String()])
+	s.Equal(900.0, actual[udpBytesOutDesc.String()])
+	s.Equal(1.0, actual[udpPacketsDroppedDesc.String()])
+}
+
+func (s *UdpTestSuite) Test_Collect_CanBeRegistered() {
+	s.NoError(prometheus.NewRegistry().Register(UdpCollector{}))
+}
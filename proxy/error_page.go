@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrorPageCodes contains the status codes supported by the HAProxy `errorfile` directive
+var ErrorPageCodes = []int{400, 403, 405, 408, 429, 500, 502, 503, 504}
+
+// ErrorPagesDir is the directory with the global error pages.
+// Error pages of services are stored in its `services` subdirectory.
+var ErrorPagesDir = "/errorfiles"
+
+var mkdirAll = os.MkdirAll
+var removeAll = os.RemoveAll
+
+// ErrorPage defines a page returned instead of the default one when HAProxy generates an error with the specified status code.
+// Only one of `Content`, `Secret`, or `Location` should be set.
+type ErrorPage struct {
+	// The status code. It must be one of `ErrorPageCodes`.
+	Code int
+	// The content of the page.
+	// If it does not start with a status line (e.g. `HTTP/1.0 503 Service Unavailable`), the status line and headers are added.
+	Content string
+	// The name of the Docker secret that contains the page.
+	Secret string
+	// The URL clients are redirected to.
+	Location string
+}
+
+// grpcStatuses maps status codes of errors generated by HAProxy to gRPC status codes.
+// The mapping follows https://github.com/grpc/grpc/blob/master/doc/http-grpc-status-mapping.md
+// and codes that are not part of it are mapped to UNKNOWN (2).
+var grpcStatuses = map[int]int{400: 13, 403: 7, 429: 14, 502: 14, 503: 14, 504: 14}
+
+// GetGrpcErrorPagePath returns the path of the file with the gRPC response returned instead of the error page with the status code
+func GetGrpcErrorPagePath(code int) string {
+	return fmt.Sprintf("%s/grpc/%d.http", ErrorPagesDir, code)
+}
+
+// FormatGrpcErrorPage returns a gRPC response with the gRPC status that corresponds to the status code
+func FormatGrpcErrorPage(code int) string {
+	status, ok := grpcStatuses[code]
+	if !ok {
+		status = 2
+	}
+	return fmt.Sprintf(
+		"HTTP/1.0 200 OK\nCache-Control: no-cache\nConnection: close\nContent-Type: application/grpc\nContent-Length: 0\ngrpc-status: %d\ngrpc-message: %s\n\n",
+		status,
+		strings.Replace(http.StatusText(code), " ", "%20", -1),
+	)
+}
+
+// GetGrpcErrorCodes returns the status codes of the errors that are returned to gRPC clients as gRPC responses.
+// Codes of the pages defined by the service are excluded.
+func GetGrpcErrorCodes(sr Service) []int {
+	codes := []int{}
+	for _, code := range ErrorPageCodes {
+		if code == 503 {
+			if m, ok := GetMaintenance(sr.ServiceName); ok && len(m.Body) > 0 {
+				continue
+			}
+		}
+		defined := false
+		for _, page := range sr.ErrorPages {
+			defined = defined || page.Code == code
+		}
+		if !defined {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+// GetErrorPagePath returns the path of the file with the error page of a service
+func GetErrorPagePath(aclName string, code int) string {
+	return fmt.Sprintf("%s/services/%s/%d.http", ErrorPagesDir, aclName, code)
+}
+
+// IsValidPathName returns false if the name (e.g. `aclName`) cannot be used as a directory or file name
+// because it would point outside of the directory it is joined with.
+func IsValidPathName(name string) bool {
+	return !strings.Contains(name, "/") && !strings.Contains(name, "\\") && !strings.Contains(name, "..")
+}
+
+// getServiceErrorPagesDir returns the directory with the error pages of a service.
+// An error is returned if the directory is not inside the `services` subdirectory of `ErrorPagesDir`.
+func getServiceErrorPagesDir(aclName string) (string, error) {
+	servicesDir := filepath.Clean(ErrorPagesDir + "/services")
+	dir := filepath.Clean(servicesDir + "/" + aclName)
+	if !IsValidPathName(aclName) || !strings.HasPrefix(dir, servicesDir+"/") {
+		return "", fmt.Errorf("%s cannot be used as the name of the directory with error pages", aclName)
+	}
+	return dir, nil
+}
+
+// FormatErrorPage prepends the status line and headers to the content unless it starts with a status line
+func FormatErrorPage(code int, content string) string {
+	// New lines are not supported in labels
+	content = strings.Replace(content, "\\n", "\n", -1)
+	if strings.HasPrefix(content, "HTTP/") {
+		return content
+	}
+	return fmt.Sprintf(
+		"HTTP/1.0 %d %s\nCache-Control: no-cache\nConnection: close\nContent-Type: text/html\n\n%s",
+		code,
+		http.StatusText(code),
+		content,
+	)
+}
+
+// WriteErrorPages stores pages of the service, including the maintenance page, in files referenced by its backends
+func WriteErrorPages(sr *Service) error {
+	aclName := sr.AclName
+	if len(aclName) == 0 {
+		aclName = sr.ServiceName
+	}
+	// All the pages are written to the directory of the service
+	if _, err := getServiceErrorPagesDir(aclName); err != nil {
+		return err
+	}
+	if m, ok := GetMaintenance(sr.ServiceName); ok && len(m.Body) > 0 {
+		path := GetMaintenancePagePath(aclName)
+		if err := mkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := writeFile(path, []byte(FormatErrorPage(503, m.Body)), 0664); err != nil {
+			return err
+		}
+	}
+	for _, sd := range sr.ServiceDest {
+		if sd.ReqMode != "grpc" {
+			continue
+		}
+		if err := writeGrpcErrorPages(); err != nil {
+			return err
+		}
+		break
+	}
+	for _, page := range sr.ErrorPages {
+		content := page.Content
+		if len(page.Secret) > 0 {
+			secret, err := readSecretsFile("/run/secrets/" + page.Secret)
+			if err != nil {
+				return fmt.Errorf("Could not read the error page secret %s: %s", page.Secret, err.Error())
+			}
+			// The backend references the file of the page so it cannot be skipped
+			if len(secret) == 0 {
+				return fmt.Errorf("The error page secret %s is empty", page.Secret)
+			}
+			content = string(secret)
+		}
+		if len(page.Location) > 0 {
+			continue
+		}
+		path := GetErrorPagePath(aclName, page.Code)
+		if err := mkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := writeFile(path, []byte(FormatErrorPage(page.Code, content)), 0664); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeGrpcErrorPages() error {
+	if err := mkdirAll(fmt.Sprintf("%s/grpc", ErrorPagesDir), 0755); err != nil {
+		return err
+	}
+	for _, code := range ErrorPageCodes {
+		if err := writeFile(GetGrpcErrorPagePath(code), []byte(FormatGrpcErrorPage(code)), 0664); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveErrorPages removes files with the error pages of a service
+func RemoveErrorPages(aclName string) error {
+	dir, err := getServiceErrorPagesDir(aclName)
+	if err != nil {
+		return err
+	}
+	return removeAll(dir)
+}
+
+// IsValidErrorPageCode returns true if HAProxy can replace the page of the code
+func IsValidErrorPageCode(code int) bool {
+	for _, c := range ErrorPageCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func getErrorPages(provider ServiceParameterProvider) []ErrorPage {
+	var pages []ErrorPage
+	for _, code := range ErrorPageCodes {
+		page := ErrorPage{
+			Code:     code,
+			Content:  provider.GetString(fmt.Sprintf("errorPage.%d", code)),
+			Secret:   provider.GetString(fmt.Sprintf("errorPageSecret.%d", code)),
+			Location: provider.GetString(fmt.Sprintf("errorPageUrl.%d", code)),
+		}
+		if len(page.Content) > 0 || len(page.Secret) > 0 || len(page.Location) > 0 {
+			pages = append(pages, page)
+		}
+	}
+	return pages
+}
@@ -0,0 +1,242 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ErrorPageTestSuite struct {
+	suite.Suite
+}
+
+func TestErrorPageUnitTestSuite(t *testing.T) {
+	suite.Run(t, new(ErrorPageTestSuite))
+}
+
+// GetServiceFromMap
+
+func (s *ErrorPageTestSuite) Test_GetServiceFromMap_AddsErrorPages() {
+	serviceMap := map[string]string{
+		"serviceName":            "my-service",
+		"errorPage.503":          "<h1>Be right back</h1>",
+		"errorPageSecret.502":    "my-502-page",
+		"errorPageUrl.504":       "https://status.example.com",
+		"errorPage.404":          "not supported",
+		"errorPageSecret.abcdef": "ignored",
+	}
+
+	actual := GetServiceFromMap(&serviceMap)
+
+	s.Equal([]ErrorPage{
+		{Code: 502, Secret: "my-502-page"},
+		{Code: 503, Content: "<h1>Be right back</h1>"},
+		{Code: 504, Location: "https://status.example.com"},
+	}, actual.ErrorPages)
+}
+
+// FormatErrorPage
+
+func (s *ErrorPageTestSuite) Test_FormatErrorPage_AddsStatusLineAndHeaders() {
+	actual := FormatErrorPage(503, `<h1>Be\nright back</h1>`)
+
+	s.Equal("HTTP/1.0 503 Service Unavailable\nCache-Control: no-cache\nConnection: close\nContent-Type: text/html\n\n<h1>Be\nright back</h1>", actual)
+}
+
+func (s *ErrorPageTestSuite) Test_FormatErrorPage_ReturnsContent_WhenItStartsWithStatusLine() {
+	content := "HTTP/1.0 503 Service Unavailable\nContent-Type: application/json\n\n{}"
+
+	actual := FormatErrorPage(503, content)
+
+	s.Equal(content, actual)
+}
+
+// WriteErrorPages
+
+func (s *ErrorPageTestSuite) Test_WriteErrorPages_WritesFiles() {
+	writeFileOrig := writeFile
+	readSecretsFileOrig := readSecretsFile
+	mkdirAllOrig := mkdirAll
+	defer func() {
+		writeFile = writeFileOrig
+		readSecretsFile = readSecretsFileOrig
+		mkdirAll = mkdirAllOrig
+	}()
+	dirs := []string{}
+	mkdirAll = func(path string, perm os.FileMode) error {
+		dirs = append(dirs, path)
+		return nil
+	}
+	readSecretsFile = func(path string) ([]byte, error) {
+		if path == "/run/secrets/my-502-page" {
+			return []byte("HTTP/1.0 502 Bad Gateway\n\nsecret"), nil
+		}
+		return nil, fmt.Errorf("%s does not exist", path)
+	}
+	files := map[string]string{}
+	writeFile = func(path string, data []byte, perm os.FileMode) error {
+		files[path] = string(data)
+		return nil
+	}
+	sr := Service{ServiceName: "my-service", AclName: "my-acl", ErrorPages: []ErrorPage{
+		{Code: 502, Secret: "my-502-page"},
+		{Code: 503, Content: "unavailable"},
+		{Code: 504, Location: "https://status.example.com"},
+	}}
+
+	err := WriteErrorPages(&sr)
+
+	s.NoError(err)
+	s.Equal(map[string]string{
+		"/errorfiles/services/my-acl/502.http": "HTTP/1.0 502 Bad Gateway\n\nsecret",
+		"/errorfiles/services/my-acl/503.http": FormatErrorPage(503, "unavailable"),
+	}, files)
+	s.Contains(dirs, "/errorfiles/services/my-acl")
+}
+
+func (s *ErrorPageTestSuite) Test_WriteErrorPages_WritesMaintenancePage() {
+	writeFileOrig := writeFile
+	mkdirAllOrig := mkdirAll
+	defer func() {
+		writeFile = writeFileOrig
+		mkdirAll = mkdirAllOrig
+		SetMaintenance("my-service", nil)
+	}()
+	mkdirAll = func(path string, perm os.FileMode) error {
+		return nil
+	}
+	files := map[string]string{}
+	writeFile = func(path string, data []byte, perm os.FileMode) error {
+		files[path] = string(data)
+		return nil
+	}
+	SetMaintenance("my-service", &Maintenance{Body: "maintenance"})
+	sr := Service{ServiceName: "my-service"}
+
+	err := WriteErrorPages(&sr)
+
+	s.NoError(err)
+	s.Equal(map[string]string{
+		"/errorfiles/services/my-service/maintenance.http": FormatErrorPage(503, "maintenance"),
+	}, files)
+}
+
+func (s *ErrorPageTestSuite) Test_WriteErrorPages_WritesGrpcPages_WhenServiceUsesGrpcMode() {
+	writeFileOrig := writeFile
+	mkdirAllOrig := mkdirAll
+	defer func() {
+		writeFile = writeFileOrig
+		mkdirAll = mkdirAllOrig
+	}()
+	mkdirAll = func(path string, perm os.FileMode) error {
+		return nil
+	}
+	files := map[string]string{}
+	writeFile = func(path string, data []byte, perm os.FileMode) error {
+		files[path] = string(data)
+		return nil
+	}
+	sr := Service{ServiceName: "my-service", ServiceDest: []ServiceDest{{ReqMode: "grpc"}}}
+
+	err := WriteErrorPages(&sr)
+
+	s.NoError(err)
+	s.Len(files, len(ErrorPageCodes))
+	s.Equal(
+		"HTTP/1.0 200 OK\nCache-Control: no-cache\nConnection: close\nContent-Type: application/grpc\nContent-Length: 0\ngrpc-status: 14\ngrpc-message: Service%20Unavailable\n\n",
+		files["/errorfiles/grpc/503.http"],
+	)
+	s.Contains(files["/errorfiles/grpc/500.http"], "grpc-status: 2\n")
+}
+
+// GetGrpcErrorCodes
+
+func (s *ErrorPageTestSuite) Test_GetGrpcErrorCodes_ExcludesCodesOfServicePages() {
+	defer SetMaintenance("my-service", nil)
+	SetMaintenance("my-service", &Maintenance{Body: "maintenance"})
+	sr := Service{ServiceName: "my-service", ErrorPages: []ErrorPage{{Code: 502, Content: "bad gateway"}}}
+
+	actual := GetGrpcErrorCodes(sr)
+
+	s.Equal([]int{400, 403, 405, 408, 429, 500, 504}, actual)
+}
+
+func (s *ErrorPageTestSuite) Test_WriteErrorPages_ReturnsError_WhenSecretDoesNotExist() {
+	readSecretsFileOrig := readSecretsFile
+	defer func() { readSecretsFile = readSecretsFileOrig }()
+	readSecretsFile = func(path string) ([]byte, error) {
+		return nil, fmt.Errorf("%s does not exist", path)
+	}
+	sr := Service{ServiceName: "my-service", ErrorPages: []ErrorPage{{Code: 502, Secret: "my-502-page"}}}
+
+	err := WriteErrorPages(&sr)
+
+	s.Error(err)
+}
+
+func (s *ErrorPageTestSuite) Test_WriteErrorPages_ReturnsError_WhenSecretIsEmpty() {
+	readSecretsFileOrig := readSecretsFile
+	defer func() { readSecretsFile = readSecretsFileOrig }()
+	readSecretsFile = func(path string) ([]byte, error) {
+		return []byte{}, nil
+	}
+	writeFileOrig := writeFile
+	defer func() { writeFile = writeFileOrig }()
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		s.Fail("No error page should be written")
+		return nil
+	}
+	sr := Service{ServiceName: "my-service", ErrorPages: []ErrorPage{{Code: 502, Secret: "my-502-page"}}}
+
+	err := WriteErrorPages(&sr)
+
+	s.Error(err)
+}
+
+func (s *ErrorPageTestSuite) Test_WriteErrorPages_ReturnsError_WhenAclNameLeavesErrorPagesDir() {
+	writeFileOrig := writeFile
+	defer func() { writeFile = writeFileOrig }()
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		s.Fail("No error page should be written")
+		return nil
+	}
+	sr := Service{ServiceName: "my-service", AclName: "../../etc", ErrorPages: []ErrorPage{{Code: 502, Content: "my-page"}}}
+
+	err := WriteErrorPages(&sr)
+
+	s.Error(err)
+}
+
+// RemoveErrorPages
+
+func (s *ErrorPageTestSuite) Test_RemoveErrorPages_RemovesDirectoryOfService() {
+	removeAllOrig := removeAll
+	defer func() { removeAll = removeAllOrig }()
+	actual := ""
+	removeAll = func(path string) error {
+		actual = path
+		return nil
+	}
+
+	err := RemoveErrorPages("my-service")
+
+	s.NoError(err)
+	s.Equal("/errorfiles/services/my-service", actual)
+}
+
+func (s *ErrorPageTestSuite) Test_RemoveErrorPages_ReturnsError_WhenAclNameLeavesErrorPagesDir() {
+	removeAllOrig := removeAll
+	defer func() { removeAll = removeAllOrig }()
+	removeAll = func(path string) error {
+		s.Fail("Nothing should be removed")
+		return nil
+	}
+
+	for _, aclName := range []string{"", "..", "../../..", "my-service/..", "."} {
+		err := RemoveErrorPages(aclName)
+
+		s.Error(err, aclName)
+	}
+}
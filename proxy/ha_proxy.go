@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -26,6 +28,8 @@ var reloadPause time.Duration = 1000
 
 var certMu = &sync.Mutex{}
 var reloadMu = &sync.Mutex{}
+var alpnRegexp = regexp.MustCompile(`alpn \S+`)
+var h3UnsupportedOnce = &sync.Once{}
 
 // TODO: Move to data from proxy.go when static (e.g. env. vars.)
 type configData struct {
@@ -164,10 +168,17 @@ func (m HaProxy) RunCmd(extraArgs []string) error {
 
 // CreateConfigFromTemplates creates haproxy.cfg configuration file based on templates
 func (m HaProxy) CreateConfigFromTemplates() error {
+	if err := refreshTemplates(); err != nil {
+		return err
+	}
 	configsContent, err := m.getConfigs()
 	if err != nil {
 		return err
 	}
+	// UDP listeners that could not be started do not prevent HAProxy from being reconfigured
+	if err := reconcileUdp(dataInstance.Services); err != nil {
+		logPrintf("%s", err.Error())
+	}
 	configPath := fmt.Sprintf("%s/haproxy.cfg", m.configsPath)
 	return writeFile(configPath, []byte(configsContent), 0664)
 }
@@ -293,19 +304,43 @@ func (m HaProxy) getConfigs() (string, error) {
 backend dummy-be
     server dummy 1.1.1.1:1111 check`)
 	}
-	tmpl, _ := template.New("contentTemplate").Parse(
+	tmpl, err := template.New(tmplPath).Parse(
 		strings.Join(contentArr, "\n\n"),
 	)
+	if err != nil {
+		return "", getConfigsParseError(configsFiles, contentArr, err)
+	}
+	data, err := m.getConfigData()
+	if err != nil {
+		return "", err
+	}
 	var content bytes.Buffer
-	tmpl.Execute(&content, m.getConfigData())
+	if err := tmpl.Execute(&content, data); err != nil {
+		return "", err
+	}
 	return content.String(), nil
 }
 
-func (m HaProxy) getConfigData() configData {
+// getConfigsParseError finds the file that cannot be parsed so that the error contains its name and the line within it.
+// The original error is returned if each of the files can be parsed on its own.
+func getConfigsParseError(files, contents []string, err error) error {
+	for i, file := range files {
+		if _, fileErr := template.New(file).Parse(contents[i]); fileErr != nil {
+			return fileErr
+		}
+	}
+	return err
+}
+
+func (m HaProxy) getConfigData() (configData, error) {
 
 	services := Services{}
 	hasHTTP := false
 	for _, s := range dataInstance.Services {
+		// Frontends of services with custom templates are part of the templates
+		if s.HasTemplate() {
+			continue
+		}
 		if len(s.AclName) == 0 {
 			s.AclName = s.ServiceName
 		}
@@ -314,7 +349,7 @@ func (m HaProxy) getConfigData() configData {
 			if len(s.ServiceDest[i].ReqMode) == 0 {
 				s.ServiceDest[i].ReqMode = "http"
 			}
-			if s.ServiceDest[i].ReqMode == "http" {
+			if s.ServiceDest[i].IsHttp() {
 				hasHTTP = true
 			}
 		}
@@ -346,13 +381,19 @@ func (m HaProxy) getConfigData() configData {
 	m.addDefaultServer(&d)
 	m.addCompression(&d)
 	m.addDebug(&d)
+	m.addTracing(&d)
 
+	quicPorts := []string{}
 	if includeDefaultPorts {
 		defaultPortsString := getSecretOrEnvVar("DEFAULT_PORTS", "")
 		defaultPorts := strings.Split(defaultPortsString, ",")
 		for _, bindPort := range defaultPorts {
 			formattedPort := strings.Replace(bindPort, ":ssl", d.CertsString, -1)
-			d.DefaultBinds += fmt.Sprintf("\n    bind *:%s", formattedPort)
+			d.DefaultBinds += fmt.Sprintf("\n    bind *:%s%s", formattedPort, getAcceptProxy(bindPort))
+			if port := m.getQuicPort(bindPort, &d); len(port) > 0 {
+				d.DefaultBinds += m.getQuicBind(port, &d)
+				quicPorts = append(quicPorts, port)
+			}
 		}
 	}
 	extraGlobal := getSecretOrEnvVarSplit("EXTRA_GLOBAL", "")
@@ -364,9 +405,19 @@ func (m HaProxy) getConfigData() configData {
 		bindPorts := strings.Split(bindPortsString, ",")
 		for _, bindPort := range bindPorts {
 			formatedBindPort := strings.Replace(bindPort, ":ssl", d.CertsString, -1)
-			d.ExtraFrontend += fmt.Sprintf("\n    bind *:%s", formatedBindPort)
+			d.ExtraFrontend += fmt.Sprintf("\n    bind *:%s%s", formatedBindPort, getAcceptProxy(bindPort))
+			if port := m.getQuicPort(bindPort, &d); len(port) > 0 {
+				d.ExtraFrontend += m.getQuicBind(port, &d)
+				quicPorts = append(quicPorts, port)
+			}
 		}
 	}
+	m.addAltSvc(&d, quicPorts)
+	if rule := getExpectProxy(); len(rule) > 0 {
+		d.ExtraFrontend += fmt.Sprintf("\n    %s", rule)
+	}
+	m.addGrpcBinds(&d, services)
+	m.addWebsocketTimeouts(&d, services)
 	if len(os.Getenv("CAPTURE_REQUEST_HEADER")) > 0 {
 		headers := strings.Split(os.Getenv("CAPTURE_REQUEST_HEADER"), ",")
 		for _, header := range headers {
@@ -377,8 +428,10 @@ func (m HaProxy) getConfigData() configData {
 				values[1])
 		}
 	}
-	m.getSni(&services, &d)
-	return d
+	if err := m.getSni(&services, &d); err != nil {
+		return d, err
+	}
+	return d, nil
 }
 
 func (m *HaProxy) getCertsConfigSnippet() string {
@@ -411,6 +464,164 @@ func (m *HaProxy) getCertsConfigSnippet() string {
 	return certs
 }
 
+// getAcceptProxy returns the bind option that accepts the PROXY protocol (v1 and v2) when ACCEPT_PROXY is enabled.
+// The option is not returned if the bind already has it or if the protocol is expected only from trusted networks.
+func getAcceptProxy(bindPort string) string {
+	if strings.Contains(bindPort, "accept-proxy") ||
+		!strings.EqualFold(getSecretOrEnvVar("ACCEPT_PROXY", ""), "true") ||
+		len(getSecretOrEnvVar("ACCEPT_PROXY_TRUSTED_NETWORKS", "")) > 0 {
+		return ""
+	}
+	return " accept-proxy"
+}
+
+// getExpectProxy returns the rule that expects the PROXY protocol only from ACCEPT_PROXY_TRUSTED_NETWORKS.
+// Connections from other networks are accepted without the protocol.
+func getExpectProxy() string {
+	networks := getSecretOrEnvVar("ACCEPT_PROXY_TRUSTED_NETWORKS", "")
+	if !strings.EqualFold(getSecretOrEnvVar("ACCEPT_PROXY", ""), "true") || len(networks) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(
+		"tcp-request connection expect-proxy layer4 if { src %s }",
+		strings.Join(strings.Split(networks, ","), " "),
+	)
+}
+
+// getQuicPort returns the port of an SSL bind that should also accept HTTP/3 requests.
+// Additional binding options of the port are ignored since most of them are not supported by QUIC listeners.
+// QUIC binds are not added if HAProxy is older than 2.6 since it would reject the configuration.
+func (m *HaProxy) getQuicPort(bindPort string, data *configData) string {
+	if !strings.HasSuffix(bindPort, ":ssl") ||
+		!strings.Contains(data.CertsString, "crt-list") ||
+		data.DefaultReqMode != "http" ||
+		!strings.EqualFold(getSecretOrEnvVar("ENABLE_H3", ""), "true") {
+		return ""
+	}
+	if !isHaProxyVersionAtLeast(2, 6) {
+		h3UnsupportedOnce.Do(func() {
+			logPrintf("Warning: HTTP/3 requires HAProxy 2.6 or newer. ENABLE_H3 is ignored.")
+		})
+		return ""
+	}
+	return strings.Fields(strings.TrimSuffix(bindPort, ":ssl"))[0]
+}
+
+func (m *HaProxy) getQuicBind(port string, data *configData) string {
+	certs := alpnRegexp.ReplaceAllString(data.CertsString, "alpn h3")
+	return fmt.Sprintf("\n    bind quic4@*:%s%s", port, certs)
+}
+
+// addAltSvc advertises QUIC ports to clients so that they can switch to HTTP/3
+func (m *HaProxy) addAltSvc(data *configData, quicPorts []string) {
+	if len(quicPorts) == 0 {
+		return
+	}
+	maxAge := getSecretOrEnvVar("H3_ALT_SVC_MAX_AGE", "86400")
+	altSvc := []string{}
+	for _, port := range quicPorts {
+		altSvc = append(altSvc, fmt.Sprintf(`h3=\":%s\"; ma=%s`, port, maxAge))
+	}
+	data.ExtraFrontend += fmt.Sprintf(`
+    http-response set-header alt-svc "%s"`,
+		strings.Join(altSvc, ", "),
+	)
+}
+
+// addGrpcBinds binds source ports of gRPC services that are not bound already.
+// The binds accept cleartext HTTP/2 (h2c) connections required by gRPC clients that do not use TLS.
+func (m *HaProxy) addGrpcBinds(data *configData, services Services) {
+	bound := map[string]bool{}
+	for _, ports := range []string{getSecretOrEnvVar("DEFAULT_PORTS", ""), getSecretOrEnvVar("BIND_PORTS", "")} {
+		for _, port := range strings.Split(ports, ",") {
+			if fields := strings.Fields(strings.Split(port, ":")[0]); len(fields) > 0 {
+				bound[fields[0]] = true
+			}
+		}
+	}
+	srcPorts := []int{}
+	for _, s := range services {
+		for _, sd := range s.ServiceDest {
+			port := strconv.Itoa(sd.SrcPort)
+			if sd.ReqMode == "grpc" && sd.SrcPort > 0 && !bound[port] {
+				bound[port] = true
+				srcPorts = append(srcPorts, sd.SrcPort)
+			}
+		}
+	}
+	sort.Ints(srcPorts)
+	for _, port := range srcPorts {
+		data.ExtraFrontend += fmt.Sprintf("\n    bind *:%d proto h2", port)
+	}
+}
+
+// addWebsocketTimeouts limits the time half-closed client connections of WebSocket services are kept open.
+// The timeout can be set only in frontends so it applies to all the services.
+func (m *HaProxy) addWebsocketTimeouts(data *configData, services Services) {
+	for _, s := range services {
+		for _, sd := range s.ServiceDest {
+			if sd.Websocket && sd.IsHttp() {
+				data.ExtraFrontend += fmt.Sprintf(`
+    timeout client-fin %ss`,
+					getSecretOrEnvVar("WEBSOCKET_TIMEOUT_FIN", "30"),
+				)
+				return
+			}
+		}
+	}
+}
+
+// getTcpSslBind returns the options of the bind of a tcp destination that terminates SSL.
+// Certificates are selected by their names through `sslCert` and all the certificates are used if it is not specified.
+// The destination is expected to be validated by `validateTcpSsl` when the service is reconfigured.
+func getTcpSslBind(sd ServiceDest) string {
+	certPaths := HaProxy{}.GetCertPaths()
+	bind := " ssl"
+	if len(sd.SslCert) == 0 {
+		crtListPath := os.Getenv("CRT_LIST_PATH")
+		if len(crtListPath) == 0 {
+			crtListPath = "/cfg/crt-list.txt"
+		}
+		bind += fmt.Sprintf(" crt-list %s", crtListPath)
+	}
+	for _, name := range sd.SslCert {
+		if path := findCertPath(certPaths, name); len(path) > 0 {
+			bind += fmt.Sprintf(" crt %s", path)
+		}
+	}
+	if caFile := os.Getenv("CA_FILE"); sd.VerifyClientSsl && len(caFile) > 0 {
+		bind += fmt.Sprintf(" ca-file %s verify required", caFile)
+	}
+	return bind
+}
+
+// validateTcpSsl returns an error if a tcp destination that terminates SSL uses certificates that do not exist
+// or verifies client certificates without CA_FILE.
+func validateTcpSsl(sd ServiceDest) error {
+	certPaths := HaProxy{}.GetCertPaths()
+	if len(sd.SslCert) == 0 && len(certPaths) == 0 {
+		return fmt.Errorf("Port %d terminates SSL but there are no certificates", sd.SrcPort)
+	}
+	for _, name := range sd.SslCert {
+		if len(findCertPath(certPaths, name)) == 0 {
+			return fmt.Errorf("Certificate %s used by port %d does not exist", name, sd.SrcPort)
+		}
+	}
+	if sd.VerifyClientSsl && len(os.Getenv("CA_FILE")) == 0 {
+		return fmt.Errorf("Port %d verifies client certificates but CA_FILE is not set", sd.SrcPort)
+	}
+	return nil
+}
+
+func findCertPath(certPaths []string, name string) string {
+	for _, certPath := range certPaths {
+		if filepath.Base(certPath) == name {
+			return certPath
+		}
+	}
+	return ""
+}
+
 func (m *HaProxy) addCompression(data *configData) {
 	if len(os.Getenv("COMPRESSION_ALGO")) > 0 {
 		data.ExtraDefaults += fmt.Sprintf(`
@@ -426,6 +637,38 @@ func (m *HaProxy) addCompression(data *configData) {
 	}
 }
 
+// randomHex returns eight random hexadecimal characters.
+// `rand` returns a 32 bit integer that `hex` converts into 16 characters with leading zeros.
+const randomHex = "%[rand,hex,regsub(^00000000,)]"
+
+// tracingLogFormat is the `httplog` format extended with the request ID, the traceparent sent to the backend, and the parent span ID
+const tracingLogFormat = `%ci:%cp\ [%tr]\ %ft\ %b/%s\ %TR/%Tw/%Tc/%Tr/%Ta\ %ST\ %B\ %CC\ %CS\ %tsc\ %ac/%fc/%bc/%sc/%rc\ %sq/%bq\ %hr\ %hs\ %{+Q}r\ %{+Q}[var(txn.request_id)]\ %{+Q}[var(txn.traceparent)]\ %{+Q}[var(txn.parent_id)]`
+
+func (m *HaProxy) addTracing(data *configData) {
+	if !strings.EqualFold(getSecretOrEnvVar("TRACING", ""), "true") || data.DefaultReqMode != "http" {
+		return
+	}
+	// The unique ID is used as the trace ID of requests without a valid traceparent and as the X-Request-ID of requests without one
+	data.ExtraFrontend += fmt.Sprintf(`
+    unique-id-format %s%s%s%s
+    http-request set-var(txn.trace_id) req.hdr(traceparent),field(2,-) if { req.hdr(traceparent) -m reg ^00-[0-9a-f]{32}-[0-9a-f]{16}-[0-9a-f]{2}$ }
+    http-request set-var(txn.parent_id) req.hdr(traceparent),field(3,-) if { var(txn.trace_id) -m found }
+    http-request set-var(txn.trace_id) unique-id unless { var(txn.trace_id) -m found }
+    http-request set-header traceparent 00-%%[var(txn.trace_id)]-%s%s-01
+    http-request set-header X-Request-ID %%[unique-id] unless { req.hdr(X-Request-ID) -m found }
+    http-request set-var(txn.traceparent) req.hdr(traceparent)
+    http-request set-var(txn.request_id) req.hdr(X-Request-ID)
+    http-response set-header X-Request-ID %%[var(txn.request_id)]`,
+		randomHex, randomHex, randomHex, randomHex, randomHex, randomHex,
+	)
+	if strings.EqualFold(getSecretOrEnvVar("DEBUG", ""), "true") && len(getSecretOrEnvVar("DEBUG_HTTP_FORMAT", "")) == 0 {
+		data.ExtraFrontend += fmt.Sprintf(`
+    log-format %s`,
+			tracingLogFormat,
+		)
+	}
+}
+
 func (m *HaProxy) addDefaultServer(data *configData) {
 	checkResolvers, _ := strconv.ParseBool(os.Getenv("CHECK_RESOLVERS"))
 	doNotResolveAddr, _ := strconv.ParseBool(os.Getenv("DO_NOT_RESOLVE_ADDR"))
@@ -453,6 +696,15 @@ func (m *HaProxy) addDebug(data *configData) {
 			data.ExtraDefaults += `
     option  dontlog-normal`
 		}
+	} else if isAccessLogMetricsEnabled() {
+		// Requests are sent to the syslog receiver only to feed access log metrics
+		data.ExtraGlobal += `
+    log 127.0.0.1:1514 local0`
+		data.ExtraFrontend += `
+    option httplog
+    log global`
+		data.ExtraDefaults += `
+    option  dontlognull`
 	} else {
 		data.ExtraDefaults += `
     option  dontlognull
@@ -460,6 +712,11 @@ func (m *HaProxy) addDebug(data *configData) {
 	}
 }
 
+// isAccessLogMetricsEnabled returns true if access log metrics are enabled through `ACCESS_LOG_METRICS`
+func isAccessLogMetricsEnabled() bool {
+	return strings.EqualFold(os.Getenv("ACCESS_LOG_METRICS"), "true")
+}
+
 func (m *HaProxy) putStats(data *configData) {
 	statsUser := getSecretOrEnvVar(os.Getenv("STATS_USER_ENV"), "")
 	statsPass := getSecretOrEnvVar(os.Getenv("STATS_PASS_ENV"), "")
@@ -526,9 +783,11 @@ type tcpGroupInfo struct {
 	TCPInfo       []tcpInfo
 }
 
-func (m *HaProxy) getSni(services *Services, config *configData) {
+func (m *HaProxy) getSni(services *Services, config *configData) error {
 	sort.Sort(services)
 	snimap := make(map[int]string)
+	sniDefaults := make(map[int]string)
+	sniInspectDelays := getSniInspectDelays(*services)
 	tcpFEs := make(map[int]Services)
 	tcpGroups := make(map[string]*tcpGroupInfo)
 	for _, s := range *services {
@@ -538,14 +797,32 @@ func (m *HaProxy) getSni(services *Services, config *configData) {
 		httpDone := false
 		putDomainAlgo(&s)
 		for i, sd := range s.ServiceDest {
-			if strings.EqualFold(sd.ReqMode, "http") {
+			if strings.EqualFold(sd.ReqMode, "http") || sd.ReqMode == "grpc" {
 				if !httpDone {
-					config.ContentFrontend += getFrontTemplate(s)
+					content, err := getFrontTemplate(s)
+					if err != nil {
+						return err
+					}
+					config.ContentFrontend += content
 				}
 				httpDone = true
+			} else if sd.ReqMode == "udp" {
+				// UDP destinations are served by the proxy process itself and not by HAProxy
+				continue
 			} else if strings.EqualFold(sd.ReqMode, "sni") {
 				_, headerExists := snimap[sd.SrcPort]
-				snimap[sd.SrcPort] += getFrontTemplateSNI(s, i, !headerExists)
+				content, err := getFrontTemplateSNI(s, i, !headerExists, sniInspectDelays[sd.SrcPort])
+				if err != nil {
+					return err
+				}
+				snimap[sd.SrcPort] += content
+				if _, defaultExists := sniDefaults[sd.SrcPort]; s.IsDefaultBackend && !defaultExists {
+					content, err := getFrontTemplateSNIDefault(s, i)
+					if err != nil {
+						return err
+					}
+					sniDefaults[sd.SrcPort] = content
+				}
 			} else if len(sd.ServiceGroup) > 0 {
 				tcpGroup, ok := tcpGroups[sd.ServiceGroup]
 				newIPs := []string{s.ServiceName}
@@ -581,8 +858,16 @@ func (m *HaProxy) getSni(services *Services, config *configData) {
 			}
 		}
 	}
-	config.ContentFrontendTcp += getFrontTemplateTcp(tcpFEs)
-	config.ContentListen += getListenTCPGroup(tcpGroups)
+	contentTcp, err := getFrontTemplateTcp(tcpFEs)
+	if err != nil {
+		return err
+	}
+	config.ContentFrontendTcp += contentTcp
+	contentListen, err := getListenTCPGroup(tcpGroups)
+	if err != nil {
+		return err
+	}
+	config.ContentListen += contentListen
 
 	// Merge the SNI entries into one single string. Sorted by port.
 	var sniports []int
@@ -591,8 +876,29 @@ func (m *HaProxy) getSni(services *Services, config *configData) {
 	}
 	sort.Ints(sniports)
 	for _, k := range sniports {
-		config.ContentFrontendSNI += snimap[k]
+		config.ContentFrontendSNI += snimap[k] + sniDefaults[k]
+	}
+	return nil
+}
+
+// getSniInspectDelays returns the longest inspect delay of the sni destinations of each source port
+func getSniInspectDelays(services Services) map[int]string {
+	delays := map[int]string{}
+	for _, s := range services {
+		for _, sd := range s.ServiceDest {
+			if !strings.EqualFold(sd.ReqMode, "sni") {
+				continue
+			}
+			delay, err := strconv.Atoi(sd.InspectDelay)
+			if err != nil {
+				continue
+			}
+			if current, err := strconv.Atoi(delays[sd.SrcPort]); err != nil || delay > current {
+				delays[sd.SrcPort] = sd.InspectDelay
+			}
+		}
 	}
+	return delays
 }
 
 func (m *HaProxy) getReloadStrategy() string {
@@ -417,6 +417,65 @@ func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_AddsLogging_WhenDebug()
 	s.Equal(expectedData, actualData)
 }
 
+func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_AddsLogging_WhenAccessLogMetricsAreEnabled() {
+	accessLogMetricsOrig := os.Getenv("ACCESS_LOG_METRICS")
+	defer func() { os.Setenv("ACCESS_LOG_METRICS", accessLogMetricsOrig) }()
+	os.Setenv("ACCESS_LOG_METRICS", "true")
+	var actualData string
+	expectedData := fmt.Sprintf(
+		"%s%s",
+		strings.Replace(s.getTemplateWithLogs(), "    option  http-server-close\n", "    option  dontlognull\n    option  http-server-close\n", 1),
+		s.ServicesContent,
+	)
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		actualData = string(data)
+		return nil
+	}
+
+	NewHaProxy(s.TemplatesPath, s.ConfigsPath).CreateConfigFromTemplates()
+
+	s.Equal(expectedData, actualData)
+}
+
+func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_AddsTraceContext_WhenTracing() {
+	tracingOrig := os.Getenv("TRACING")
+	defer func() { os.Setenv("TRACING", tracingOrig) }()
+	os.Setenv("TRACING", "true")
+	var actualData string
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		actualData = string(data)
+		return nil
+	}
+
+	NewHaProxy(s.TemplatesPath, s.ConfigsPath).CreateConfigFromTemplates()
+
+	s.Contains(actualData, "unique-id-format "+randomHex+randomHex+randomHex+randomHex)
+	s.Contains(actualData, "http-request set-header traceparent 00-%[var(txn.trace_id)]-"+randomHex+randomHex+"-01")
+	s.Contains(actualData, "http-request set-header X-Request-ID %[unique-id] unless { req.hdr(X-Request-ID) -m found }")
+	s.Contains(actualData, "http-response set-header X-Request-ID %[var(txn.request_id)]")
+	s.NotContains(actualData, "log-format")
+}
+
+func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_AddsTracingLogFormat_WhenTracingAndDebug() {
+	tracingOrig := os.Getenv("TRACING")
+	debugOrig := os.Getenv("DEBUG")
+	defer func() {
+		os.Setenv("TRACING", tracingOrig)
+		os.Setenv("DEBUG", debugOrig)
+	}()
+	os.Setenv("TRACING", "true")
+	os.Setenv("DEBUG", "true")
+	var actualData string
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		actualData = string(data)
+		return nil
+	}
+
+	NewHaProxy(s.TemplatesPath, s.ConfigsPath).CreateConfigFromTemplates()
+
+	s.Contains(actualData, "log-format "+tracingLogFormat)
+}
+
 func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_CaptureRequestHeader() {
 	captureOrig := os.Getenv("CAPTURE_REQUEST_HEADER")
 	defer func() { os.Setenv("CAPTURE_REQUEST_HEADER", captureOrig) }()
@@ -841,6 +900,78 @@ func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_AddsContentFrontEnd() {
 	s.Equal(expectedData, actualData)
 }
 
+func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_AddsContentFrontEndAndH2Binds_WhenReqModeIsGrpc() {
+	var actualData string
+	tmpl := s.TemplateContent
+	expectedData := fmt.Sprintf(
+		`%s
+    bind *:50051 proto h2
+    acl url_my-service-150051_0 path_beg /helloworld.Greeter/
+    acl srcPort_my-service-150051_0 dst_port 50051
+    use_backend my-service-1-be50051_0 if url_my-service-150051_0 srcPort_my-service-150051_0
+    acl url_my-service-250052_0 path_beg /routeguide.RouteGuide/
+    acl srcPort_my-service-280_0 dst_port 80
+    use_backend my-service-2-be50052_0 if url_my-service-250052_0 srcPort_my-service-280_0%s`,
+		tmpl,
+		s.ServicesContent,
+	)
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		actualData = string(data)
+		return nil
+	}
+	p := NewHaProxy(s.TemplatesPath, s.ConfigsPath)
+	service1 := Service{
+		ServiceName: "my-service-1",
+		ServiceDest: []ServiceDest{
+			{Port: "50051", SrcPort: 50051, ReqMode: "grpc", ServicePath: []string{"/helloworld.Greeter/"}},
+		},
+	}
+	service2 := Service{
+		ServiceName: "my-service-2",
+		ServiceDest: []ServiceDest{
+			{Port: "50052", SrcPort: 80, ReqMode: "grpc", ServicePath: []string{"/routeguide.RouteGuide/"}},
+		},
+	}
+	FormatServiceForTemplates(&service1)
+	FormatServiceForTemplates(&service2)
+	p.AddService(service1)
+	p.AddService(service2)
+
+	p.CreateConfigFromTemplates()
+
+	s.Equal(expectedData, actualData)
+}
+
+func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_RoutesUpgradeRequestsToWebsocketBackend_WhenWebsocketIsTrue() {
+	var actualData string
+	tmpl := s.TemplateContent
+	expectedData := fmt.Sprintf(
+		`%s
+    timeout client-fin 30s
+    acl url_my-service1111_0 path_beg /ws
+    acl websocket_my-service_0 hdr(Upgrade) -i websocket
+    use_backend my-service-ws-be1111_0 if url_my-service1111_0 websocket_my-service_0
+    use_backend my-service-be1111_0 if url_my-service1111_0%s`,
+		tmpl,
+		s.ServicesContent,
+	)
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		actualData = string(data)
+		return nil
+	}
+	p := NewHaProxy(s.TemplatesPath, s.ConfigsPath)
+	p.AddService(Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{
+			{Port: "1111", ServicePath: []string{"/ws"}, PathType: "path_beg", Websocket: true},
+		},
+	})
+
+	p.CreateConfigFromTemplates()
+
+	s.Equal(expectedData, actualData)
+}
+
 func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_AddsServicePathExclude() {
 	var actualData string
 	tmpl := s.TemplateContent
@@ -1158,6 +1289,246 @@ frontend tcpFE_1234
 	s.Equal(expectedData, actualData)
 }
 
+func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_AddsAcceptProxy_WhenAcceptProxyIsTrue() {
+	acceptProxyOrig := os.Getenv("ACCEPT_PROXY")
+	bindPortsOrig := os.Getenv("BIND_PORTS")
+	lookupHostOrig := LookupHost
+	defer func() {
+		os.Setenv("ACCEPT_PROXY", acceptProxyOrig)
+		os.Setenv("BIND_PORTS", bindPortsOrig)
+		LookupHost = lookupHostOrig
+	}()
+	os.Setenv("ACCEPT_PROXY", "true")
+	os.Setenv("BIND_PORTS", "8080,8443 accept-proxy")
+	LookupHost = func(host string) (addrs []string, err error) {
+		return []string{"10.0.0.1"}, nil
+	}
+	var actualData string
+	tmpl := strings.Replace(
+		s.TemplateContent,
+		"\n    bind *:80\n    bind *:443",
+		"",
+		-1)
+	expectedData := fmt.Sprintf(
+		`%s
+    bind *:8080 accept-proxy
+    bind *:8443 accept-proxy
+
+frontend tcpFE_1234
+    bind *:1234 accept-proxy
+    mode tcp
+    default_backend my-service-1-be4321_0
+
+listen tcpListen_MyGroup_5432
+    bind *:5432 accept-proxy
+    mode tcp
+    server MyGroup-my-service-25432_0 10.0.0.1:5432 send-proxy-v2%s`,
+		tmpl,
+		s.ServicesContent,
+	)
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		actualData = string(data)
+		return nil
+	}
+	p := NewHaProxy(s.TemplatesPath, s.ConfigsPath)
+	p.AddService(Service{
+		ServiceName: "my-service-1",
+		ServiceDest: []ServiceDest{{SrcPort: 1234, Port: "4321", ReqMode: "tcp"}},
+	})
+	p.AddService(Service{
+		ServiceName: "my-service-2",
+		ServiceDest: []ServiceDest{{SrcPort: 5432, Port: "5432", ReqMode: "tcp", ServiceGroup: "MyGroup", SendProxy: "v2"}},
+	})
+
+	p.CreateConfigFromTemplates()
+
+	s.Equal(expectedData, actualData)
+}
+
+func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_ExpectsProxyFromTrustedNetworks_WhenTrustedNetworksAreSet() {
+	acceptProxyOrig := os.Getenv("ACCEPT_PROXY")
+	trustedOrig := os.Getenv("ACCEPT_PROXY_TRUSTED_NETWORKS")
+	defer func() {
+		os.Setenv("ACCEPT_PROXY", acceptProxyOrig)
+		os.Setenv("ACCEPT_PROXY_TRUSTED_NETWORKS", trustedOrig)
+	}()
+	os.Setenv("ACCEPT_PROXY", "true")
+	os.Setenv("ACCEPT_PROXY_TRUSTED_NETWORKS", "10.0.0.0/8,192.168.0.0/16")
+	var actualData string
+	expectedData := fmt.Sprintf(
+		`%s
+    tcp-request connection expect-proxy layer4 if { src 10.0.0.0/8 192.168.0.0/16 }
+    acl url_my-service-11111_0 path_beg /path
+    use_backend my-service-1-be1111_0 if url_my-service-11111_0
+
+frontend service_443
+    bind *:443
+    mode tcp
+    tcp-request connection expect-proxy layer4 if { src 10.0.0.0/8 192.168.0.0/16 }
+    tcp-request inspect-delay 5s
+    tcp-request content accept if { req_ssl_hello_type 1 }
+    acl sni_my-service-22222-1 req_ssl_sni -i my-domain.com
+    use_backend my-service-2-be2222_0 if sni_my-service-22222-1%s`,
+		s.TemplateContent,
+		s.ServicesContent,
+	)
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		actualData = string(data)
+		return nil
+	}
+	p := NewHaProxy(s.TemplatesPath, s.ConfigsPath)
+	p.AddService(Service{
+		ServiceName: "my-service-1",
+		ServiceDest: []ServiceDest{{Port: "1111", ServicePath: []string{"/path"}, PathType: "path_beg"}},
+	})
+	p.AddService(Service{
+		ServiceName: "my-service-2",
+		ServiceDest: []ServiceDest{{SrcPort: 443, Port: "2222", ReqMode: "sni", ServicePath: []string{"my-domain.com"}, PathType: "req_ssl_sni -i"}},
+	})
+
+	p.CreateConfigFromTemplates()
+
+	s.Equal(expectedData, actualData)
+}
+
+func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_TerminatesSsl_WhenTcpServiceTerminatesSsl() {
+	readDirOrig := readDir
+	caFileOrig := os.Getenv("CA_FILE")
+	lookupHostOrig := LookupHost
+	defer func() {
+		readDir = readDirOrig
+		os.Setenv("CA_FILE", caFileOrig)
+		LookupHost = lookupHostOrig
+	}()
+	os.Setenv("CA_FILE", "/certs/ca.pem")
+	readDir = func(dir string) ([]os.FileInfo, error) {
+		if dir == "/certs" {
+			return []os.FileInfo{
+				FileInfoMock{
+					NameMock:  func() string { return "my-cert" },
+					IsDirMock: func() bool { return false },
+				},
+				FileInfoMock{
+					NameMock:  func() string { return "other-cert" },
+					IsDirMock: func() bool { return false },
+				},
+			}, nil
+		}
+		return []os.FileInfo{}, nil
+	}
+	LookupHost = func(host string) (addrs []string, err error) {
+		return []string{"10.0.0.1"}, nil
+	}
+	var actualData string
+	tmpl := strings.Replace(
+		s.TemplateContent,
+		"\n    bind *:80\n    bind *:443",
+		"",
+		-1)
+	expectedData := fmt.Sprintf(
+		`%s
+
+frontend tcpFE_1234
+    bind *:1234 ssl crt-list /cfg/crt-list.txt ca-file /certs/ca.pem verify required
+    mode tcp
+    default_backend my-service-1-be4321_0
+
+listen tcpListen_MyGroup_5432
+    bind *:5432 ssl crt /certs/other-cert
+    mode tcp
+    server MyGroup-my-service-25432_0 10.0.0.1:5432 ssl verify none%s`,
+		tmpl,
+		s.ServicesContent,
+	)
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		if !strings.EqualFold(filename, "/cfg/crt-list.txt") {
+			actualData = string(data)
+		}
+		return nil
+	}
+	p := NewHaProxy(s.TemplatesPath, s.ConfigsPath)
+	p.AddService(Service{
+		ServiceName: "my-service-1",
+		ServiceDest: []ServiceDest{{SrcPort: 1234, Port: "4321", ReqMode: "tcp", TerminateSsl: true, VerifyClientSsl: true}},
+	})
+	p.AddService(Service{
+		ServiceName: "my-service-2",
+		ServiceDest: []ServiceDest{{SrcPort: 5432, Port: "5432", ReqMode: "tcp", ServiceGroup: "MyGroup", TerminateSsl: true, SslCert: []string{"other-cert"}, SslVerifyNone: true}},
+	})
+
+	p.CreateConfigFromTemplates()
+
+	s.Equal(expectedData, actualData)
+}
+
+func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_DoesNotReturnError_WhenTcpCertificateDoesNotExist() {
+	writeFileOrig := writeFile
+	defer func() { writeFile = writeFileOrig }()
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		return nil
+	}
+	p := NewHaProxy(s.TemplatesPath, s.ConfigsPath)
+	p.AddService(Service{
+		ServiceName: "my-service-1",
+		ServiceDest: []ServiceDest{{SrcPort: 1234, Port: "4321", ReqMode: "tcp", TerminateSsl: true, SslCert: []string{"my-cert"}}},
+	})
+
+	err := p.CreateConfigFromTemplates()
+
+	s.NoError(err)
+}
+
+func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_ReconcilesUdpListeners() {
+	reconcileUdpOrig := reconcileUdp
+	defer func() { reconcileUdp = reconcileUdpOrig }()
+	var actualServices map[string]Service
+	reconcileUdp = func(services map[string]Service) error {
+		actualServices = services
+		return nil
+	}
+	var actualData string
+	tmpl := strings.Replace(
+		s.TemplateContent,
+		"\n    bind *:80\n    bind *:443",
+		"",
+		-1)
+	expectedData := fmt.Sprintf("%s%s", tmpl, s.ServicesContent)
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		actualData = string(data)
+		return nil
+	}
+	service := Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{{SrcPort: 53, Port: "53", ReqMode: "udp"}},
+	}
+	p := NewHaProxy(s.TemplatesPath, s.ConfigsPath)
+	p.AddService(service)
+
+	err := p.CreateConfigFromTemplates()
+
+	s.NoError(err)
+	s.Equal(expectedData, actualData)
+	s.Equal(map[string]Service{"my-service": service}, actualServices)
+}
+
+func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_WritesConfig_WhenUdpListenersCannotBeReconciled() {
+	reconcileUdpOrig := reconcileUdp
+	defer func() { reconcileUdp = reconcileUdpOrig }()
+	reconcileUdp = func(services map[string]Service) error {
+		return fmt.Errorf("This is an error")
+	}
+	writeFileCnt := 0
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		writeFileCnt++
+		return nil
+	}
+
+	err := NewHaProxy(s.TemplatesPath, s.ConfigsPath).CreateConfigFromTemplates()
+
+	s.NoError(err)
+	s.Equal(1, writeFileCnt)
+}
+
 func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_AddsListen_TcpGroup() {
 	lookupHostOrig := LookupHost
 	defer func() {
@@ -1731,6 +2102,68 @@ frontend service_443
 	s.Equal(expectedData, actualData)
 }
 
+func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_AddsContentFrontEndSNI_WithServiceDomains() {
+	defaultPortsOrig := os.Getenv("DEFAULT_PORTS")
+	defer func() { os.Setenv("DEFAULT_PORTS", defaultPortsOrig) }()
+	os.Setenv("DEFAULT_PORTS", "80")
+	var actualData string
+	tmpl := strings.Replace(
+		s.TemplateContent,
+		"\n    bind *:443",
+		"",
+		-1)
+	expectedData := fmt.Sprintf(
+		`%s
+    acl url_acl31111_0 path_beg /path
+    use_backend acl3-be1111_0 if url_acl31111_0
+
+frontend service_443
+    bind *:443
+    mode tcp
+    tcp-request inspect-delay 10s
+    tcp-request content accept if { req_ssl_hello_type 1 }
+    acl sni_my-service-24321-1 req_ssl_sni -i other.com
+    use_backend my-service-2-be4321_0 if sni_my-service-24321-1
+    acl sni_my-service-11111-1 req_ssl_sni -i example.com
+    acl sni_my-service-11111-1 req_ssl_sni -m end -i .example.com .example.org
+    acl sni_my-service-11111-1 req_ssl_sni -m reg -i ^api[0-9]+\.example\.net$
+    use_backend my-service-1-be1111_0 if sni_my-service-11111-1
+    default_backend my-service-2-be4321_0%s`,
+		tmpl,
+		s.ServicesContent,
+	)
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		actualData = string(data)
+		return nil
+	}
+	p := NewHaProxy(s.TemplatesPath, s.ConfigsPath)
+	p.AddService(Service{
+		ServiceName: "my-service-1",
+		ServiceDest: []ServiceDest{{
+			SrcPort:       443,
+			Port:          "1111",
+			ReqMode:       "sni",
+			InspectDelay:  "3",
+			ServicePath:   []string{"/"},
+			ServiceDomain: []string{"example.com", "*.example.com", "~^api[0-9]+\\.example\\.net$", "*.example.org"},
+		}},
+	})
+	p.AddService(Service{
+		ServiceName:      "my-service-2",
+		IsDefaultBackend: true,
+		ServiceDest:      []ServiceDest{{SrcPort: 443, Port: "4321", ReqMode: "sni", InspectDelay: "10", ServiceDomain: []string{"other.com"}}},
+	})
+	p.AddService(Service{
+		ServiceName: "my-service-3",
+		AclName:     "acl3",
+		ServiceDest: []ServiceDest{{Port: "1111", ServicePath: []string{"/path"}}},
+	})
+
+	p.CreateConfigFromTemplates()
+
+	s.Equal(expectedData, actualData)
+}
+
 func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_AddsContentFrontEndWithDomain() {
 	var actualData string
 	tmpl := s.TemplateContent
@@ -2394,6 +2827,103 @@ func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_AddsCerts_BindPorts() {
 	s.Equal(strings.Join(expectedCertList, "\n"), actualCertList)
 }
 
+func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_AddsQuicBindsAndAltSvc_WhenH3IsEnabled() {
+	readDirOrig := readDir
+	enableH2Orig := os.Getenv("ENABLE_H2")
+	enableH3Orig := os.Getenv("ENABLE_H3")
+	bindPortsOrig := os.Getenv("BIND_PORTS")
+	defer func() {
+		readDir = readDirOrig
+		os.Setenv("ENABLE_H2", enableH2Orig)
+		os.Setenv("ENABLE_H3", enableH3Orig)
+		os.Setenv("BIND_PORTS", bindPortsOrig)
+	}()
+	os.Setenv("ENABLE_H2", "true")
+	os.Setenv("ENABLE_H3", "true")
+	os.Setenv("BIND_PORTS", "1234,4321 accept-proxy:ssl")
+	readDir = func(dir string) ([]os.FileInfo, error) {
+		if dir == "/certs" {
+			return []os.FileInfo{FileInfoMock{
+				NameMock:  func() string { return "my-cert" },
+				IsDirMock: func() bool { return false },
+			}}, nil
+		}
+		return []os.FileInfo{}, nil
+	}
+	var actualData string
+	tmpl := strings.Replace(
+		s.TemplateContent,
+		"\n    bind *:80\n    bind *:443",
+		"\n    bind *:80\n    bind *:443 ssl crt-list /cfg/crt-list.txt alpn h2,http/1.1\n    bind quic4@*:443 ssl crt-list /cfg/crt-list.txt alpn h3",
+		-1)
+	expectedData := fmt.Sprintf(
+		`%s
+    bind *:1234
+    bind *:4321 accept-proxy ssl crt-list /cfg/crt-list.txt alpn h2,http/1.1
+    bind quic4@*:4321 ssl crt-list /cfg/crt-list.txt alpn h3
+    http-response set-header alt-svc "h3=\":443\"; ma=86400, h3=\":4321\"; ma=86400"%s`,
+		tmpl,
+		s.ServicesContent,
+	)
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		actualData = string(data)
+		return nil
+	}
+
+	NewHaProxy(s.TemplatesPath, s.ConfigsPath).CreateConfigFromTemplates()
+
+	s.Equal(expectedData, actualData)
+}
+
+func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_DoesNotAddQuicBinds_WhenHaProxyIsOlderThan26() {
+	readDirOrig := readDir
+	enableH3Orig := os.Getenv("ENABLE_H3")
+	haProxyVersionOrig := os.Getenv("HAPROXY_VERSION")
+	defer func() {
+		readDir = readDirOrig
+		os.Setenv("ENABLE_H3", enableH3Orig)
+		os.Setenv("HAPROXY_VERSION", haProxyVersionOrig)
+	}()
+	os.Setenv("ENABLE_H3", "true")
+	os.Setenv("HAPROXY_VERSION", "1.8.13")
+	readDir = func(dir string) ([]os.FileInfo, error) {
+		if dir == "/certs" {
+			return []os.FileInfo{FileInfoMock{
+				NameMock:  func() string { return "my-cert" },
+				IsDirMock: func() bool { return false },
+			}}, nil
+		}
+		return []os.FileInfo{}, nil
+	}
+	var actualData string
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		actualData = string(data)
+		return nil
+	}
+
+	NewHaProxy(s.TemplatesPath, s.ConfigsPath).CreateConfigFromTemplates()
+
+	s.Contains(actualData, "bind *:443 ssl crt-list /cfg/crt-list.txt")
+	s.NotContains(actualData, "quic4@")
+	s.NotContains(actualData, "alt-svc")
+}
+
+func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_DoesNotAddQuicBinds_WhenThereAreNoCerts() {
+	enableH3Orig := os.Getenv("ENABLE_H3")
+	defer func() { os.Setenv("ENABLE_H3", enableH3Orig) }()
+	os.Setenv("ENABLE_H3", "true")
+	var actualData string
+	expectedData := fmt.Sprintf("%s%s", s.TemplateContent, s.ServicesContent)
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		actualData = string(data)
+		return nil
+	}
+
+	NewHaProxy(s.TemplatesPath, s.ConfigsPath).CreateConfigFromTemplates()
+
+	s.Equal(expectedData, actualData)
+}
+
 func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_AddsDefaultPorts() {
 	defaultPortsOrig := os.Getenv("DEFAULT_PORTS")
 	defer func() { os.Setenv("DEFAULT_PORTS", defaultPortsOrig) }()
@@ -2921,6 +3451,59 @@ func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_ReturnsError_WhenReadCo
 	s.Error(err)
 }
 
+func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_ReturnsErrorWithFileAndLine_WhenTemplateCannotBeParsed() {
+	readConfigsDirOrig := readConfigsDir
+	readConfigsFileOrig := readConfigsFile
+	defer func() {
+		readConfigsDir = readConfigsDirOrig
+		readConfigsFile = readConfigsFileOrig
+	}()
+	readConfigsDir = func(dirname string) ([]os.FileInfo, error) {
+		return []os.FileInfo{FileInfoMock{
+			NameMock: func() string {
+				return "my-service-be.cfg"
+			},
+		}}, nil
+	}
+	readConfigsFile = func(filename string) ([]byte, error) {
+		if strings.HasSuffix(filename, "my-service-be.cfg") {
+			return []byte("backend my-service-be\n    server {{.Missing"), nil
+		}
+		return []byte("global\n    pidfile /var/run/haproxy.pid"), nil
+	}
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		return nil
+	}
+
+	err := NewHaProxy(s.TemplatesPath, s.ConfigsPath).CreateConfigFromTemplates()
+
+	s.Error(err)
+	s.Contains(err.Error(), "my-service-be.cfg:2")
+}
+
+func (s HaProxyTestSuite) Test_CreateConfigFromTemplates_ReturnsError_WhenTemplateCannotBeExecuted() {
+	readConfigsDirOrig := readConfigsDir
+	readConfigsFileOrig := readConfigsFile
+	defer func() {
+		readConfigsDir = readConfigsDirOrig
+		readConfigsFile = readConfigsFileOrig
+	}()
+	readConfigsDir = func(dirname string) ([]os.FileInfo, error) {
+		return []os.FileInfo{}, nil
+	}
+	readConfigsFile = func(filename string) ([]byte, error) {
+		return []byte("global\n    pidfile {{.DoesNotExist}}"), nil
+	}
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		return nil
+	}
+
+	err := NewHaProxy(s.TemplatesPath, s.ConfigsPath).CreateConfigFromTemplates()
+
+	s.Error(err)
+	s.Contains(err.Error(), "DoesNotExist")
+}
+
 // ReadConfig
 
 func (s *HaProxyTestSuite) Test_ReadConfig_ReturnsConfig() {
@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Maintenance describes a service that responds with 503 to all requests except those sent from allowed sources
+type Maintenance struct {
+	// IPs or CIDR blocks of clients that can access the service.
+	AllowedIPs []string
+	// The content of the page returned to clients.
+	// If empty, the 503 error page of the service or the global one is used.
+	Body string
+}
+
+var maintenanceMu = &sync.RWMutex{}
+
+// Maintenance state is stored independently of services so that it survives reconfigures and reloads
+var maintenances = map[string]Maintenance{}
+
+// SetMaintenance puts the service into maintenance.
+// The maintenance is disabled if `m` is nil.
+func SetMaintenance(serviceName string, m *Maintenance) {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	if m == nil {
+		delete(maintenances, serviceName)
+	} else {
+		maintenances[serviceName] = *m
+	}
+}
+
+// GetMaintenance returns the maintenance of the service and whether the service is in maintenance
+func GetMaintenance(serviceName string) (Maintenance, bool) {
+	maintenanceMu.RLock()
+	defer maintenanceMu.RUnlock()
+	m, ok := maintenances[serviceName]
+	return m, ok
+}
+
+// GetMaintenances returns the maintenance of all the services that are in maintenance
+func GetMaintenances() map[string]Maintenance {
+	maintenanceMu.RLock()
+	defer maintenanceMu.RUnlock()
+	all := map[string]Maintenance{}
+	for name, m := range maintenances {
+		all[name] = m
+	}
+	return all
+}
+
+// GetMaintenancePagePath returns the path of the file with the maintenance page of a service
+func GetMaintenancePagePath(aclName string) string {
+	return fmt.Sprintf("%s/services/%s/maintenance.http", ErrorPagesDir, aclName)
+}
@@ -10,6 +10,12 @@ type mapParameterProvider struct {
 	theMap *map[string]string
 }
 
+// NewMapParameterProvider returns ServiceParameterProvider that extracts parameters from a map.
+// It can be embedded by providers that need to extend the way parameters are filled.
+func NewMapParameterProvider(params *map[string]string) ServiceParameterProvider {
+	return &mapParameterProvider{theMap: params}
+}
+
 func (p *mapParameterProvider) Fill(service *Service) {
 	mapstructure.Decode(p.theMap, service)
 	//above library does not handle bools as strings
@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+// RuntimeSocket is the path of the socket that exposes the HAProxy runtime API
+var RuntimeSocket = "/var/run/haproxy.sock"
+
+// RunRuntimeCommand sends the command (e.g. `show stat`) to the HAProxy runtime API and returns the output
+var RunRuntimeCommand = func(cmd string) (string, error) {
+	conn, err := net.DialTimeout("unix", RuntimeSocket, 5*time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := fmt.Fprintf(conn, "%s\n", cmd); err != nil {
+		return "", err
+	}
+	out, err := ioutil.ReadAll(conn)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// GetBackendNames returns names of the backends generated for the destination of the service.
+// HTTPS backends follow the HTTP ones and WebSocket backends follow their non-WebSocket counterparts.
+func GetBackendNames(s Service, sd ServiceDest) []string {
+	aclName := s.AclName
+	if len(aclName) == 0 {
+		aclName = s.ServiceName
+	}
+	websocket := sd.Websocket && (sd.ReqMode == "http" || sd.ReqMode == "grpc")
+	names := []string{fmt.Sprintf("%s-be%s_%d", aclName, sd.Port, sd.Index)}
+	if websocket {
+		names = append(names, fmt.Sprintf("%s-ws-be%s_%d", aclName, sd.Port, sd.Index))
+	}
+	if sd.HttpsPort > 0 {
+		names = append(names, fmt.Sprintf("https-%s-be%d_%d", aclName, sd.HttpsPort, sd.Index))
+		if websocket {
+			names = append(names, fmt.Sprintf("https-%s-ws-be%d_%d", aclName, sd.HttpsPort, sd.Index))
+		}
+	}
+	return names
+}
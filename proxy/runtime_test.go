@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type RuntimeTestSuite struct {
+	suite.Suite
+}
+
+func TestRuntimeUnitTestSuite(t *testing.T) {
+	suite.Run(t, new(RuntimeTestSuite))
+}
+
+// GetBackendNames
+
+func (s *RuntimeTestSuite) Test_GetBackendNames_ReturnsHttpAndHttpsBackends() {
+	service := Service{ServiceName: "my-service"}
+	sd := ServiceDest{Port: "1234", HttpsPort: 4321, Index: 1, ReqMode: "http"}
+
+	actual := GetBackendNames(service, sd)
+
+	s.Equal([]string{"my-service-be1234_1", "https-my-service-be4321_1"}, actual)
+}
+
+func (s *RuntimeTestSuite) Test_GetBackendNames_UsesAclName() {
+	service := Service{ServiceName: "my-service", AclName: "my-acl"}
+	sd := ServiceDest{Port: "1234", ReqMode: "http"}
+
+	actual := GetBackendNames(service, sd)
+
+	s.Equal([]string{"my-acl-be1234_0"}, actual)
+}
+
+func (s *RuntimeTestSuite) Test_GetBackendNames_AddsWebsocketBackends_WhenWebsocketIsTrue() {
+	service := Service{ServiceName: "my-service"}
+	sd := ServiceDest{Port: "1234", HttpsPort: 4321, Index: 1, ReqMode: "http", Websocket: true}
+
+	actual := GetBackendNames(service, sd)
+
+	expected := []string{
+		"my-service-be1234_1",
+		"my-service-ws-be1234_1",
+		"https-my-service-be4321_1",
+		"https-my-service-ws-be4321_1",
+	}
+	s.Equal(expected, actual)
+}
+
+func (s *RuntimeTestSuite) Test_GetBackendNames_DoesNotAddWebsocketBackends_WhenReqModeIsTcp() {
+	service := Service{ServiceName: "my-service"}
+	sd := ServiceDest{Port: "1234", ReqMode: "tcp", Websocket: true}
+
+	actual := GetBackendNames(service, sd)
+
+	s.Equal([]string{"my-service-be1234_0"}, actual)
+}
@@ -2,220 +2,161 @@ package proxy
 
 import (
 	"bytes"
+	"embed"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 )
 
-func getFrontTemplate(s Service) string {
-	tmplString := `
-{{- range $sd := .ServiceDest}}
-    {{- if eq .ReqMode "http"}}
-        {{- if ne $.CompressionAlgo ""}}
-    compression algo {{$.CompressionAlgo}}
-            {{- if ne $.CompressionType ""}}
-    compression type {{$.CompressionType}}
-            {{- end}}
-        {{- end}}
-        {{- if ne $sd.Port ""}}
-    acl url_{{$.AclName}}{{$sd.Port}}_{{.Index}}{{range .ServicePath}} {{if eq $sd.PathType ""}}path_beg{{else}}{{$sd.PathType}}{{end}} {{.}}{{end}}
-            {{- if .ServicePathExclude}}
-    acl url_exclude_{{$.AclName}}{{$sd.Port}}_{{.Index}}{{range .ServicePathExclude}} {{if eq $sd.PathType ""}}path_beg{{else}}{{$sd.PathType}}{{end}} {{.}}{{end}}
-            {{- end}}
-            {{- if $sd.ServiceDomain}}
-    acl domain_{{$.AclName}}{{$sd.Port}}_{{$sd.Index}} {{$.ServiceDomainAlgo}} -i{{range $sd.ServiceDomain}} {{.}}{{end}}
-            {{- end}}
-            {{- if $sd.ServiceHeader}}{{$skIndex := 0}}
-                {{- range $key, $value := $sd.ServiceHeader}}
-    acl hdr_{{$.AclName}}{{$sd.Port}}_{{incIndex}} hdr({{$key}}) {{$value}}
-                {{- end}}
-            {{- end}}
-        {{- end}}
-        {{- if gt $sd.HttpsPort 0}}
-    acl url_https_{{$.AclName}}{{$sd.HttpsPort}}_{{.Index}}{{range .ServicePath}} {{if eq $sd.PathType ""}}path_beg{{else}}{{$sd.PathType}}{{end}} {{.}}{{end}}
-            {{- if .ServicePathExclude}}
-    acl url_exclude_https_{{$.AclName}}{{$sd.HttpsPort}}_{{.Index}}{{range .ServicePathExclude}} {{if eq $sd.PathType ""}}path_beg{{else}}{{$sd.PathType}}{{end}} {{.}}{{end}}
-            {{- end}}
-            {{- if $sd.ServiceDomain}}
-    acl domain_https_{{$.AclName}}{{$sd.HttpsPort}}_{{$sd.Index}} {{$.ServiceDomainAlgo}} -i{{range $sd.ServiceDomain}} {{.}}{{end}}
-            {{- end}}
-        {{- end}}
-        {{- if $sd.IncludeSrcPortACL }}
-    {{$sd.SrcPortAcl}}
-        {{- end }}
-        {{- if $sd.IncludeSrcHttpsPortACL }}
-    {{$sd.SrcHttpsPortAcl}}
-        {{- end }}
-        {{- $length := len .UserAgent.Value}}{{if gt $length 0}}
-    acl user_agent_{{$.AclName}}_{{.UserAgent.AclName}}_{{.Index}} hdr_sub(User-Agent) -i{{range .UserAgent.Value}} {{.}}{{end}}
-        {{- end}}
-    {{- end}}
-    {{- range $rd := $sd.RedirectFromDomain}}
-    http-request redirect code 301 prefix http://{{index $sd.ServiceDomain 0}} if { hdr_beg(host) -i {{$rd}} }
-    {{- end}}
-{{- end}}
-{{- if $.RedirectWhenHttpProto}}
-    {{- range .ServiceDest}}
-        {{- if eq .ReqMode "http"}}
-           {{- if ne .Port ""}}
-    acl is_{{$.AclName}}_http hdr(X-Forwarded-Proto) http
-    http-request redirect scheme https{{if .HttpsRedirectCode}} code {{.HttpsRedirectCode}}{{end}} if is_{{$.AclName}}_http url_{{$.AclName}}{{.Port}}_{{.Index}}{{if .ServiceDomain}} domain_{{$.AclName}}{{.Port}}_{{.Index}}{{end}}{{.SrcPortAclName}}
-            {{- end}}
-        {{- end}}
-    {{- end}}
-{{- end}}
-{{- if $.RedirectUnlessHttpsProto}}
-    {{- range .ServiceDest}}
-        {{- if eq .ReqMode "http"}}
-           {{- if ne .Port ""}}
-    acl is_{{$.AclName}}_https hdr(X-Forwarded-Proto) https
-    http-request redirect scheme https{{if .HttpsRedirectCode}} code {{.HttpsRedirectCode}}{{end}} if !is_{{$.AclName}}_https url_{{$.AclName}}{{.Port}}_{{.Index}}{{if .ServiceDomain}} domain_{{$.AclName}}{{.Port}}_{{.Index}}{{end}}{{.SrcPortAclName}}
-            {{- end}}
-        {{- end}}
-    {{- end}}
-{{- end}}
-{{- range $sd := .ServiceDest}}
-    {{- if eq .ReqMode "http" }}
-        {{- if ne .Port ""}}
-    use_backend {{$.AclName}}-be{{.Port}}_{{.Index}} if url_{{$.AclName}}{{.Port}}_{{.Index}}{{if .ServicePathExclude}} !url_exclude_{{$.AclName}}{{.Port}}_{{.Index}}{{end}}{{if .ServiceDomain}} domain_{{$.AclName}}{{.Port}}_{{.Index}}{{end}}{{if .ServiceHeader}}{{resetIndex}}{{range $key, $value := .ServiceHeader}} hdr_{{$.AclName}}{{$sd.Port}}_{{incIndex}}{{end}}{{end}}{{.SrcPortAclName}}{{ $length := len .UserAgent.Value}}{{if gt $length 0}} user_agent_{{$.AclName}}_{{.UserAgent.AclName}}_{{.Index}}{{end}}
-            {{- if $.IsDefaultBackend}}
-    default_backend {{$.AclName}}-be{{.Port}}_{{$sd.Index}}
-            {{- end}}
-        {{- end }}
-        {{- if gt $sd.HttpsPort 0 }}
-    use_backend https-{{$.AclName}}-be{{.HttpsPort}}_{{.Index}} if url_https_{{$.AclName}}{{.HttpsPort}}_{{.Index}}{{if .ServicePathExclude}} !url_exclude_https_{{$.AclName}}{{.HttpsPort}}_{{.Index}}{{end}}{{if .ServiceDomain}} domain_https_{{$.AclName}}{{.HttpsPort}}_{{.Index}}{{end}}{{.SrcHttpsPortAclName}}{{ $length := len .UserAgent.Value}}{{if gt $length 0}} user_agent_{{$.AclName}}_{{.UserAgent.AclName}}_{{.Index}}{{end}}
-        {{- end}}
-    {{- end}}
-{{- end}}`
-	return templateToString(tmplString, s)
+// TemplateOverridesPath is the default directory with templates that replace the embedded ones
+const TemplateOverridesPath = "/templates/overrides"
+
+// ServiceTemplatesDir is the directory with frontend and backend templates uploaded through the templates API
+var ServiceTemplatesDir = "/templates/services"
+
+// GetServiceTemplatePath returns the path of the file with an uploaded template.
+// The kind of the template is either `frontend` or `backend`.
+func GetServiceTemplatePath(name, kind string) string {
+	suffix := "be"
+	if kind == "frontend" {
+		suffix = "fe"
+	}
+	return fmt.Sprintf("%s/%s-%s.tmpl", ServiceTemplatesDir, name, suffix)
+}
+
+//go:embed templates/*.tmpl
+var embeddedTemplates embed.FS
+
+var globTemplateOverrides = filepath.Glob
+
+// backendData is passed to backend templates that generate a single destination of a service
+type backendData struct {
+	Service Service
+	Dest    ServiceDest
+	// The port of the destination servers. It is the HTTPS port if the backend is used for HTTPS requests.
+	Port  string
+	Https bool
+	// Whether the backend is used for WebSocket (upgrade) requests
+	Websocket bool
+	// The timeout in seconds applied to half-closed connections of WebSocket backends
+	TimeoutFin string
+}
+
+func newBackendData(s Service, sd ServiceDest, https bool) backendData {
+	port := sd.Port
+	if https {
+		port = strconv.Itoa(sd.HttpsPort)
+	}
+	return backendData{Service: s, Dest: sd, Port: port, Https: https}
+}
+
+// newWebsocketData returns the data of the backend that receives WebSocket requests of the destination.
+// The tunnel timeout defaults to WEBSOCKET_TIMEOUT_TUNNEL since connections stay open after the upgrade.
+func newWebsocketData(s Service, sd ServiceDest, https bool) backendData {
+	data := newBackendData(s, sd, https)
+	data.Websocket = true
+	if len(data.Dest.TimeoutTunnel) == 0 {
+		data.Dest.TimeoutTunnel = getSecretOrEnvVar("WEBSOCKET_TIMEOUT_TUNNEL", "3600")
+	}
+	data.TimeoutFin = getSecretOrEnvVar("WEBSOCKET_TIMEOUT_FIN", "30")
+	return data
+}
+
+// sniData is passed to the template that generates SNI rules of a single destination
+type sniData struct {
+	Service Service
+	Dest    ServiceDest
+	// One-based position of the destination in the service
+	Index int
+	// Whether the frontend of the source port should be generated as well
+	Header bool
+	// The inspect delay of the source port in seconds
+	InspectDelay string
+}
+
+func getFrontTemplate(s Service) (string, error) {
+	return executeTemplate("frontend", s)
 }
 
-func getFrontTemplateTcp(servicesByPort map[int]Services) string {
+func getFrontTemplateTcp(servicesByPort map[int]Services) (string, error) {
 	tmpl := ""
 	for _, services := range servicesByPort {
 		sort.Sort(services)
-		tmplString := `
-
-{{$sd := (index . 0).ServiceDest}}{{$srcPort := (index $sd 0).SrcPort}}frontend tcpFE_{{$srcPort}}
-    bind *:{{$srcPort}}
-    mode tcp
-    {{- if (index . 0).Debug}}{{$debugFormat := (index . 0).DebugFormat}}
-    option tcplog
-    log global
-        {{- if ne $debugFormat ""}}
-    log-format {{$debugFormat}}
-        {{- end}}
-    {{- end}}
-    {{- $timeoutClientSd := (index $sd 0).TimeoutClient -}}
-    {{- if ne $timeoutClientSd "" }}
-    timeout client {{$timeoutClientSd}}s
-    {{- end}}
-    {{- if (index $sd 0).Clitcpka }}
-    option clitcpka
-    {{- end}}
-    {{- range $s := .}}
-        {{- range $sd := .ServiceDest}}
-            {{- if $sd.ServiceDomain}}
-    acl domain_{{$s.AclName}}{{.Port}}_{{$sd.Index}} {{$s.ServiceDomainAlgo}} -i{{range $sd.ServiceDomain}} {{.}}{{end}}
-    use_backend {{$s.AclName}}-be{{$sd.Port}}_{{$sd.Index}} if domain_{{$s.AclName}}{{.Port}}_{{$sd.Index}}
-            {{- end}}
-            {{- if not $sd.ServiceDomain}}
-    default_backend {{$s.AclName}}-be{{$sd.Port}}_{{$sd.Index}}
-            {{- end}}
-        {{- end}}
-    {{- end}}`
-		tmpl += templateToString(tmplString, services)
+		content, err := executeTemplate("frontend-tcp", services)
+		if err != nil {
+			return "", err
+		}
+		tmpl += content
 	}
-	return tmpl
+	return tmpl, nil
+}
+
+func getFrontTemplateSNI(s Service, si int, genHeader bool, inspectDelay string) (string, error) {
+	return executeTemplate("frontend-sni", sniData{
+		Service:      s,
+		Dest:         s.ServiceDest[si],
+		Index:        si + 1,
+		Header:       genHeader,
+		InspectDelay: inspectDelay,
+	})
+}
+
+func getFrontTemplateSNIDefault(s Service, si int) (string, error) {
+	return executeTemplate("frontend-sni-default", sniData{
+		Service: s,
+		Dest:    s.ServiceDest[si],
+		Index:   si + 1,
+	})
 }
 
-func getFrontTemplateSNI(s Service, si int, genHeader bool) string {
-	tmplString := ``
-	if genHeader {
-		tmplString += fmt.Sprintf(`{{$sd1 := index $.ServiceDest %d}}
-
-frontend service_{{$sd1.SrcPort}}
-    bind *:{{$sd1.SrcPort}}
-    mode tcp
-    {{- if $.Debug}}{{$debugFormat := $.DebugFormat}}
-    option tcplog
-    log global
-        {{- if ne $debugFormat ""}}
-    log-format {{$debugFormat}}
-        {{- end}}
-    {{- end}}
-    {{- $timeoutClientSd := $sd1.TimeoutClient -}}
-    {{- if ne $timeoutClientSd "" }}
-    timeout client {{$timeoutClientSd}}s
-    {{- end}}
-    {{- if $sd1.Clitcpka }}
-    option clitcpka
-    {{- end}}
-    tcp-request inspect-delay 5s
-    tcp-request content accept if { req_ssl_hello_type 1 }`, si)
+// getSniCriteria returns the criteria of the ACL that matches SNI of connections to the destination.
+// Domains prefixed with `*.` (or `.`) match any of their subdomains and those prefixed with `~` are regular expressions.
+// `ServicePath` combined with `PathType` is used only when `ServiceDomain` is not set.
+func getSniCriteria(sd ServiceDest) []string {
+	if len(sd.ServiceDomain) == 0 {
+		paths := []string{}
+		for _, path := range sd.ServicePath {
+			paths = append(paths, fmt.Sprintf("%s %s", sd.PathType, path))
+		}
+		return []string{strings.Join(paths, " ")}
+	}
+	criteria := []string{}
+	exact := []string{}
+	suffixes := []string{}
+	for _, domain := range sd.ServiceDomain {
+		if strings.HasPrefix(domain, "~") {
+			criteria = append(criteria, fmt.Sprintf("req_ssl_sni -m reg -i %s", strings.TrimPrefix(domain, "~")))
+		} else if domain = strings.TrimPrefix(domain, "*"); strings.HasPrefix(domain, ".") {
+			suffixes = append(suffixes, domain)
+		} else {
+			exact = append(exact, domain)
+		}
+	}
+	if len(suffixes) > 0 {
+		criteria = append([]string{fmt.Sprintf("req_ssl_sni -m end -i %s", strings.Join(suffixes, " "))}, criteria...)
+	}
+	if len(exact) > 0 {
+		criteria = append([]string{fmt.Sprintf("req_ssl_sni -i %s", strings.Join(exact, " "))}, criteria...)
 	}
-	tmplString += fmt.Sprintf(`{{$sd := index $.ServiceDest %d}}
-    acl sni_{{.AclName}}{{$sd.Port}}-%d{{range $sd.ServicePath}} {{$sd.PathType}} {{.}}{{end}}
-    {{- if ne $sd.SrcPortAcl "" }}
-    {{$sd.SrcPortAcl}}
-    {{- end }}
-    use_backend {{$.ServiceName}}-be{{$sd.Port}}_{{$sd.Index}} if sni_{{$.AclName}}{{$sd.Port}}-%d{{$.AclCondition}}{{$sd.SrcPortAclName}}`, si, si+1, si+1)
-	return templateToString(tmplString, s)
+	return criteria
 }
 
-func getListenTCPGroup(tcpGroups map[string]*tcpGroupInfo) string {
-	tmplString := `{{- range $groupName, $info := . }}
-{{- $s := $info.TargetService }}
-{{- $sd := $info.TargetDest }}
-
-listen tcpListen_{{$groupName}}_{{$sd.SrcPort}}
-    bind *:{{$sd.SrcPort}}
-    mode tcp
-        {{- if $s.Debug}}{{$debugFormat := $s.DebugFormat}}
-    option tcplog
-    log global
-            {{- if ne $debugFormat ""}}
-    log-format {{$debugFormat}}
-            {{- end}}
-        {{- end}}
-        {{- if $sd.Clitcpka }}
-    option clitcpka
-        {{- end}}
-        {{- if $sd.CheckTCP}}
-    option tcp-check
-        {{- end}}
-        {{- if ne $sd.TimeoutClient "" }}
-    timeout client {{$sd.TimeoutClient}}s
-        {{- end}}
-        {{- if ne $sd.TimeoutServer ""}}
-    timeout server {{ $sd.TimeoutServer }}s
-        {{- end}}
-        {{- if ne $sd.TimeoutTunnel ""}}
-    timeout tunnel {{ $sd.TimeoutTunnel }}s
-        {{- end}}
-        {{- if ne $sd.BalanceGroup ""}}
-    balance {{$sd.BalanceGroup}}
-        {{- end}}
-        {{- range $tcpIn := .TCPInfo}}
-        {{- range $i, $ip := $tcpIn.IPs}}
-    server {{$sd.ServiceGroup}}-{{$tcpIn.ServiceName}}{{$tcpIn.Port}}_{{$i}} {{$ip}}:{{$tcpIn.Port}}{{if $sd.CheckTCP}} check{{end}}
-        {{- end}}
-        {{- end}}
-{{- end}}`
-	return templateToString(tmplString, tcpGroups)
+func getListenTCPGroup(tcpGroups map[string]*tcpGroupInfo) (string, error) {
+	return executeTemplate("listen-tcp-group", tcpGroups)
 }
 
-// GetBackTemplate returns template used to create a service backend
-// TODO: Change to private function when actions.GetTemplates is moved to the proxy package
-// TODO: Create a single string for the template
-// TODO: Unify HTTP and HTTPS into a single string
-// TODO: Move to a file
-func GetBackTemplate(sr *Service) string {
+// GetBackend returns the backend configuration of a service
+func GetBackend(sr *Service) (string, error) {
 	for i := range sr.ServiceDest {
 		if strings.EqualFold(sr.ServiceDest[i].ReqMode, "sni") {
 			sr.ServiceDest[i].ReqModeFormatted = "tcp"
+		} else if sr.ServiceDest[i].ReqMode == "grpc" {
+			sr.ServiceDest[i].ReqModeFormatted = "http"
 		} else {
 			sr.ServiceDest[i].ReqModeFormatted = sr.ServiceDest[i].ReqMode
 		}
@@ -226,168 +167,10 @@ func GetBackTemplate(sr *Service) string {
 	if strings.EqualFold(os.Getenv("DEBUG"), "true") {
 		sr.Debug = true
 	}
-
-	// HTTP
-	tmpl := `{{- range $sd := .ServiceDest}}
-{{- if ne $sd.Port ""}}
-{{- if eq $sd.ReqModeFormatted "http" }}
-backend {{$.AclName}}-be{{$sd.Port}}_{{.Index}}
-    mode {{.ReqModeFormatted}}
-    {{- if .HttpsOnly}}
-    http-request redirect scheme https{{if .HttpsRedirectCode}} code {{.HttpsRedirectCode}}{{end}} if !{ ssl_fc }
-    {{- end}}
-    {{- if eq .ReqModeFormatted "http"}}
-    http-request add-header X-Forwarded-Proto https if { ssl_fc }
-    {{- end}}
-    {{- if ne $.ConnectionMode ""}}
-    option {{$.ConnectionMode}}
-        {{- end}}
-        {{- if $.Debug}}
-    log global
-        {{- end}}`
-	tmpl += getHeaders(sr)
-	tmpl += `{{- if ne $sd.TimeoutServer ""}}
-    timeout server {{ $sd.TimeoutServer }}s
-    {{- end}}
-    {{- if ne $sd.TimeoutTunnel ""}}
-    timeout tunnel {{ $sd.TimeoutTunnel }}s
-    {{- end}}
-        {{- range $sd.ReqPathSearchReplaceFormatted}}
-    http-request set-path %[path,regsub({{.}})]
-        {{- end}}
-        {{- if eq .VerifyClientSsl true}}
-    acl valid_client_cert_{{$.ServiceName}}{{$sd.Port}} ssl_c_used ssl_c_verify 0
-    http-request deny unless valid_client_cert_{{$.ServiceName}}{{$sd.Port}}
-        {{- end}}
-        {{- if .AllowedMethods}}
-    acl valid_allowed_method method{{range .AllowedMethods}} {{.}}{{end}}
-    http-request deny unless valid_allowed_method
-        {{- end}}
-        {{- if .DeniedMethods}}
-    acl valid_denied_method method{{range .DeniedMethods}} {{.}}{{end}}
-    http-request deny if valid_denied_method
-        {{- end}}
-        {{- if .DenyHttp}}
-    http-request deny if !{ ssl_fc }
-        {{- end}}
-        {{- if eq $.SessionType "sticky-server"}}
-    balance roundrobin
-    cookie {{$.ServiceName}} insert indirect nocache
-        {{- end}}
-        {{- range $i, $t := $.Tasks}}
-    server {{$.ServiceName}}_{{$i}} {{$t}}:{{$sd.Port}} check cookie {{$.ServiceName}}_{{$i}}{{if eq $sd.SslVerifyNone true}} ssl verify none{{end}}
-        {{- end}}
-        {{- if not $.Tasks}}
-            {{- if eq $.DiscoveryType "DNS"}}
-    server-template {{$.ServiceName}} {{$.Replicas}} {{if eq $sd.OutboundHostname ""}}{{$.ServiceName}}{{end}}{{if ne $sd.OutboundHostname ""}}{{$sd.OutboundHostname}}{{end}}:{{$sd.Port}} check{{if eq $.CheckResolvers true}} resolvers docker{{end}}{{if eq $sd.SslVerifyNone true}} ssl verify none{{end}}
-            {{- else }}
-    server {{$.ServiceName}} {{if eq $sd.OutboundHostname ""}}{{$.ServiceName}}{{end}}{{if ne $sd.OutboundHostname ""}}{{$sd.OutboundHostname}}{{end}}:{{$sd.Port}}{{if eq $.CheckResolvers true}} check resolvers docker{{end}}{{if eq $sd.SslVerifyNone true}} ssl verify none{{end}}
-            {{- end}}
-        {{- end}}
-        {{- if not .IgnoreAuthorization}}
-            {{- if and ($.Users) (not .IgnoreAuthorization)}}
-    acl {{$.ServiceName}}UsersAcl http_auth({{$.ServiceName}}Users)
-    http-request auth realm {{$.ServiceName}}Realm if !{{$.ServiceName}}UsersAcl
-            {{- end}}
-            {{- if $.UseGlobalUsers}}
-    acl defaultUsersAcl http_auth(defaultUsers)
-    http-request auth realm defaultRealm if !defaultUsersAcl
-            {{- end}}
-            {{- if or ($.Users) ($.UseGlobalUsers)}}
-    http-request del-header Authorization
-            {{- end}}
-        {{- end}}
-{{- else if eq .ReqModeFormatted "tcp"}}
-    {{- if eq $sd.ServiceGroup "" }}
-backend {{$.AclName}}-be{{$sd.Port}}_{{.Index}}
-    mode tcp
-        {{- if .CheckTCP}}
-    option tcp-check
-        {{- end}}
-        {{- if ne $sd.TimeoutServer ""}}
-    timeout server {{ $sd.TimeoutServer }}s
-        {{- end}}
-        {{- if ne $sd.TimeoutTunnel ""}}
-    timeout tunnel {{ $sd.TimeoutTunnel }}s
-        {{- end}}
-    server {{$.ServiceName}} {{if eq $sd.OutboundHostname ""}}{{$.ServiceName}}{{end}}{{if ne $sd.OutboundHostname ""}}{{$sd.OutboundHostname}}{{end}}:{{$sd.Port}}{{if .CheckTCP}} check{{end}}
-    {{- end}}
-{{- end}}
-        {{- if ne $.BackendExtra ""}}
-    {{ $.BackendExtra }}
-        {{- end}}
-{{- end}}
-{{- end}}
-{{- range $sd := .ServiceDest}}
-    {{- if gt $sd.HttpsPort 0}}
-backend https-{{$.AclName}}-be{{.HttpsPort}}_{{.Index}}
-    mode {{.ReqModeFormatted}}
-            {{- if eq .ReqModeFormatted "http"}}
-    http-request add-header X-Forwarded-Proto https if { ssl_fc }
-            {{- end}}
-            {{- if ne $.ConnectionMode ""}}
-    option {{$.ConnectionMode}}
-            {{- end}}
-            {{- if $.Debug}}
-    log global
-            {{- end}}`
-	tmpl += getHeaders(sr)
-	tmpl += `
-        {{- if ne $sd.TimeoutServer ""}}
-    timeout server {{ $sd.TimeoutServer }}s
-        {{- end}}
-        {{- if ne $sd.TimeoutTunnel ""}}
-    timeout tunnel {{ $sd.TimeoutTunnel }}s
-        {{- end}}
-            {{- range $sd.ReqPathSearchReplaceFormatted}}
-    http-request set-path %[path,regsub({{.}})]
-            {{- end}}
-            {{- if eq .VerifyClientSsl true}}
-    acl valid_client_cert_{{$.ServiceName}}{{.HttpsPort}} ssl_c_used ssl_c_verify 0
-    http-request deny unless valid_client_cert_{{$.ServiceName}}{{.HttpsPort}}
-            {{- end}}
-            {{- if .AllowedMethods}}
-    acl valid_allowed_method method{{range .AllowedMethods}} {{.}}{{end}}
-    http-request deny unless valid_allowed_method
-            {{- end}}
-            {{- if .DeniedMethods}}
-    acl valid_denied_method method{{range .DeniedMethods}} {{.}}{{end}}
-    http-request deny if valid_denied_method
-            {{- end}}
-            {{- if eq $.SessionType "sticky-server"}}
-    balance roundrobin
-    cookie {{$.ServiceName}} insert indirect nocache
-            {{- end}}
-            {{- range $i, $t := $.Tasks}}
-    server {{$.ServiceName}}_{{$i}} {{$t}}:{{$sd.HttpsPort}} check cookie {{$.ServiceName}}_{{$i}}{{if eq $sd.SslVerifyNone true}} ssl verify none{{end}}
-            {{- end}}
-            {{- if not $.Tasks}}
-                {{- if eq $.DiscoveryType "DNS"}}
-    server-template {{$.ServiceName}} {{$.Replicas}} {{if eq $sd.OutboundHostname ""}}{{$.ServiceName}}{{end}}{{if ne $sd.OutboundHostname ""}}{{$sd.OutboundHostname}}{{end}}:{{$sd.HttpsPort}} check{{if eq $.CheckResolvers true}} resolvers docker{{end}}{{if eq $sd.SslVerifyNone true}} ssl verify none{{end}}
-                {{- else }}
-    server {{$.ServiceName}} {{if eq $sd.OutboundHostname ""}}{{$.ServiceName}}{{end}}{{if ne $sd.OutboundHostname ""}}{{$sd.OutboundHostname}}{{end}}:{{$sd.HttpsPort}}{{if eq $.CheckResolvers true}} check resolvers docker{{end}}{{if eq $sd.SslVerifyNone true}} ssl verify none{{end}}
-                {{- end}}
-            {{- end}}
-            {{- if not .IgnoreAuthorization}}
-                {{- if $.Users}}
-    acl {{$.ServiceName}}UsersAcl http_auth({{$.ServiceName}}Users)
-    http-request auth realm {{$.ServiceName}}Realm if !{{$.ServiceName}}UsersAcl
-                {{- end}}
-                {{- if $.UseGlobalUsers}}
-    acl defaultUsersAcl http_auth(defaultUsers)
-    http-request auth realm defaultRealm if !defaultUsersAcl
-                {{- end}}
-                {{- if or ($.Users) ($.UseGlobalUsers)}}
-    http-request del-header Authorization
-                {{- end}}
-            {{- end}}
-            {{- if ne $.BackendExtra ""}}
-    {{ $.BackendExtra }}
-            {{- end}}
-    {{- end}}
-{{- end}}`
-
-	return tmpl
+	if err := refreshTemplates(); err != nil {
+		return "", err
+	}
+	return executeTemplate("backend", sr)
 }
 
 // FormatServiceForTemplates adds addtional variables to service that is used
@@ -445,63 +228,153 @@ func FormatServiceForTemplates(sr *Service) {
 	}
 }
 
-func getHeaders(sr *Service) string {
-	tmpl := ""
-	for _, header := range sr.AddReqHeader {
-		tmpl += fmt.Sprintf(`
-    http-request add-header %s`,
-			header,
-		)
-	}
-	for _, header := range sr.SetReqHeader {
-		tmpl += fmt.Sprintf(`
-    http-request set-header %s`,
-			header,
-		)
+// templateCache holds the parsed templates.
+// The templates are parsed again only when the files in the overrides directory change.
+var templateCache = struct {
+	sync.Mutex
+	tmpl      *template.Template
+	err       error
+	signature string
+}{}
+
+// refreshTemplates parses the embedded templates and the overrides stored in the TEMPLATE_OVERRIDES_PATH directory
+// unless the overrides did not change since the templates were parsed last time.
+// It is invoked once per config generation so that changed overrides are picked up without parsing templates for each fragment.
+func refreshTemplates() error {
+	dir := getSecretOrEnvVar("TEMPLATE_OVERRIDES_PATH", TemplateOverridesPath)
+	overrides, err := globTemplateOverrides(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return err
 	}
-	for _, header := range sr.AddResHeader {
-		tmpl += fmt.Sprintf(`
-    http-response add-header %s`,
-			header,
-		)
+	signature := getTemplateOverridesSignature(dir, overrides)
+	templateCache.Lock()
+	defer templateCache.Unlock()
+	if templateCache.signature == signature && (templateCache.tmpl != nil || templateCache.err != nil) {
+		return templateCache.err
 	}
-	for _, header := range sr.SetResHeader {
-		tmpl += fmt.Sprintf(`
-    http-response set-header %s`,
-			header,
-		)
+	templateCache.tmpl, templateCache.err = parseTemplates(overrides)
+	templateCache.signature = signature
+	return templateCache.err
+}
+
+// getTemplateOverridesSignature returns a value that changes whenever an override is added, removed, or modified
+func getTemplateOverridesSignature(dir string, overrides []string) string {
+	signature := dir
+	for _, path := range overrides {
+		if info, err := os.Stat(path); err == nil {
+			signature += fmt.Sprintf("\n%s %d %d", path, info.Size(), info.ModTime().UnixNano())
+		} else {
+			signature += fmt.Sprintf("\n%s", path)
+		}
 	}
-	for _, header := range sr.DelReqHeader {
-		tmpl += fmt.Sprintf(`
-    http-request del-header %s`,
-			header,
-		)
+	return signature
+}
+
+// parseTemplates parses the embedded templates and the overrides.
+// Templates defined in the overrides replace the embedded templates with the same name.
+func parseTemplates(overrides []string) (*template.Template, error) {
+	tmpl, err := template.New("templates").
+		Option("missingkey=error").
+		Funcs(getTemplateFuncs()).
+		ParseFS(embeddedTemplates, "templates/*.tmpl")
+	if err != nil {
+		return nil, err
 	}
-	for _, header := range sr.DelResHeader {
-		tmpl += fmt.Sprintf(`
-    http-response del-header %s`,
-			header,
-		)
+	if len(overrides) > 0 {
+		if tmpl, err = tmpl.ParseFiles(overrides...); err != nil {
+			return nil, err
+		}
 	}
-	return tmpl
+	return tmpl, nil
 }
 
-func templateToString(templateString string, data interface{}) string {
+// getTemplates returns a copy of the parsed templates that can be executed once.
+// Each copy gets its own counter used by `resetIndex` and `incIndex` so that concurrent executions do not share it.
+func getTemplates() (*template.Template, error) {
+	templateCache.Lock()
+	tmpl, err := templateCache.tmpl, templateCache.err
+	templateCache.Unlock()
+	if tmpl == nil && err == nil {
+		if err := refreshTemplates(); err != nil {
+			return nil, err
+		}
+		templateCache.Lock()
+		tmpl = templateCache.tmpl
+		templateCache.Unlock()
+	} else if err != nil {
+		return nil, err
+	}
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
 	i := -1
-	funcMap := template.FuncMap{
+	return clone.Funcs(template.FuncMap{
 		"resetIndex": func() string {
 			i = -1
 			return ""
 		},
 		"incIndex": func() int {
-			i += 1
+			i++
 			return i
 		},
+	}), nil
+}
+
+func getTemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		// Replaced with counters of each execution by getTemplates
+		"resetIndex":    func() string { return "" },
+		"incIndex":      func() int { return 0 },
+		"backendData":   newBackendData,
+		"websocketData": newWebsocketData,
+		"maintenance": func(serviceName string) *Maintenance {
+			if m, ok := GetMaintenance(serviceName); ok {
+				return &m
+			}
+			return nil
+		},
+		"errorPagePath":       GetErrorPagePath,
+		"maintenancePagePath": GetMaintenancePagePath,
+		"grpcErrorCodes":      GetGrpcErrorCodes,
+		"grpcErrorPagePath":   GetGrpcErrorPagePath,
+		"acceptProxy": func() string {
+			return getAcceptProxy("")
+		},
+		"expectProxy": getExpectProxy,
+		"tcpSslBind":  getTcpSslBind,
+		"sniCriteria": getSniCriteria,
+		"default": func(defaultValue, value string) string {
+			if len(value) == 0 {
+				return defaultValue
+			}
+			return value
+		},
+		"env":       os.Getenv,
+		"join":      strings.Join,
+		"split":     strings.Split,
+		"contains":  strings.Contains,
+		"hasPrefix": strings.HasPrefix,
+		"hasSuffix": strings.HasSuffix,
+		"lower":     strings.ToLower,
+		"upper":     strings.ToUpper,
+		"trim":      strings.TrimSpace,
+		"replace": func(s, old, new string) string {
+			return strings.Replace(s, old, new, -1)
+		},
+	}
+}
+
+func executeTemplate(name string, data interface{}) (string, error) {
+	tmpl, err := getTemplates()
+	if err != nil {
+		return "", err
 	}
-	tmpl, _ := template.New("template").Funcs(funcMap).Parse(templateString)
 	var b bytes.Buffer
-	tmpl.Execute(&b, data)
-	return b.String()
+	if err := tmpl.ExecuteTemplate(&b, name, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
 }
 
 func putDomainAlgo(s *Service) {
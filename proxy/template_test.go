@@ -1,7 +1,12 @@
 package proxy
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/suite"
 )
@@ -118,3 +123,320 @@ func (s *TemplateTestSuite) Test_FormatData_DefinesSrcPortAclNameAndSrcPortAcl_D
 	s.True(sd.IncludeSrcPortACL)
 	s.True(sd.IncludeSrcHttpsPortACL)
 }
+
+// GetBackend
+
+func (s *TemplateTestSuite) Test_GetBackend_ReturnsBackendConfiguration() {
+	service := Service{
+		ServiceName: "my-service",
+		AclName:     "my-service",
+		ServiceDest: []ServiceDest{{ReqMode: "http", Port: "1111", HttpsPort: 2222, TimeoutServer: "10"}},
+	}
+
+	actual, err := GetBackend(&service)
+
+	s.NoError(err)
+	s.Equal(`
+backend my-service-be1111_0
+    mode http
+    http-request add-header X-Forwarded-Proto https if { ssl_fc }
+    timeout server 10s
+    server my-service my-service:1111
+backend https-my-service-be2222_0
+    mode http
+    http-request add-header X-Forwarded-Proto https if { ssl_fc }
+    timeout server 10s
+    server my-service my-service:2222`, actual)
+}
+
+func (s *TemplateTestSuite) Test_GetBackend_AddsProtoH2_WhenBackendProtoIsH2() {
+	service := Service{
+		ServiceName: "my-service",
+		AclName:     "my-service",
+		Tasks:       []string{"1.2.3.4"},
+		ServiceDest: []ServiceDest{{ReqMode: "http", Port: "1111", BackendProto: "h2"}},
+	}
+
+	actual, err := GetBackend(&service)
+
+	s.NoError(err)
+	s.Equal(`
+backend my-service-be1111_0
+    mode http
+    http-request add-header X-Forwarded-Proto https if { ssl_fc }
+    server my-service_0 1.2.3.4:1111 check cookie my-service_0 proto h2`, actual)
+}
+
+func (s *TemplateTestSuite) Test_GetBackend_AddsAlpnH2_WhenBackendProtoIsH2AndServiceUsesSsl() {
+	service := Service{
+		ServiceName: "my-service",
+		AclName:     "my-service",
+		ServiceDest: []ServiceDest{{ReqMode: "http", Port: "1111", BackendProto: "h2", SslVerifyNone: true}},
+	}
+
+	actual, err := GetBackend(&service)
+
+	s.NoError(err)
+	s.Equal(`
+backend my-service-be1111_0
+    mode http
+    http-request add-header X-Forwarded-Proto https if { ssl_fc }
+    server my-service my-service:1111 ssl verify none alpn h2`, actual)
+}
+
+func (s *TemplateTestSuite) Test_GetBackend_ReturnsHttpBackendWithH2ServersAndGrpcErrors_WhenReqModeIsGrpc() {
+	service := Service{
+		ServiceName: "my-service",
+		AclName:     "my-service",
+		ErrorPages:  []ErrorPage{{Code: 400, Location: "https://status.example.com"}},
+		ServiceDest: []ServiceDest{{ReqMode: "grpc", Port: "50051", GrpcHealthCheck: true}},
+	}
+	expectedErrorFiles := ""
+	for _, code := range ErrorPageCodes[1:] {
+		expectedErrorFiles += fmt.Sprintf("\n    errorfile %d /errorfiles/grpc/%d.http", code, code)
+	}
+
+	actual, err := GetBackend(&service)
+
+	s.NoError(err)
+	s.Equal(`
+backend my-service-be50051_0
+    mode http
+    http-request add-header X-Forwarded-Proto https if { ssl_fc }
+    option httpchk
+    http-check send meth POST uri /grpc.health.v1.Health/Check ver HTTP/2 hdr content-type application/grpc hdr te trailers body-hex 0000000000
+    http-check expect binary 00000000020801
+    server my-service my-service:50051 check proto h2 check-proto h2
+    errorloc302 400 https://status.example.com`+expectedErrorFiles, actual)
+}
+
+func (s *TemplateTestSuite) Test_GetBackend_AddsWebsocketBackends_WhenWebsocketIsTrue() {
+	service := Service{
+		ServiceName: "my-service",
+		AclName:     "my-service",
+		ServiceDest: []ServiceDest{{ReqMode: "http", Port: "1111", HttpsPort: 2222, Websocket: true}},
+	}
+
+	actual, err := GetBackend(&service)
+
+	s.NoError(err)
+	s.Equal(`
+backend my-service-be1111_0
+    mode http
+    http-request add-header X-Forwarded-Proto https if { ssl_fc }
+    server my-service my-service:1111
+backend my-service-ws-be1111_0
+    mode http
+    http-request add-header X-Forwarded-Proto https if { ssl_fc }
+    timeout tunnel 3600s
+    timeout server-fin 30s
+    server my-service my-service:1111
+backend https-my-service-be2222_0
+    mode http
+    http-request add-header X-Forwarded-Proto https if { ssl_fc }
+    server my-service my-service:2222
+backend https-my-service-ws-be2222_0
+    mode http
+    http-request add-header X-Forwarded-Proto https if { ssl_fc }
+    timeout tunnel 3600s
+    timeout server-fin 30s
+    server my-service my-service:2222`, actual)
+}
+
+func (s *TemplateTestSuite) Test_GetBackend_UsesWebsocketTimeouts() {
+	timeoutFinOrig := os.Getenv("WEBSOCKET_TIMEOUT_FIN")
+	defer func() { os.Setenv("WEBSOCKET_TIMEOUT_FIN", timeoutFinOrig) }()
+	os.Setenv("WEBSOCKET_TIMEOUT_FIN", "5")
+	service := Service{
+		ServiceName: "my-service",
+		AclName:     "my-service",
+		ServiceDest: []ServiceDest{{ReqMode: "http", Port: "1111", TimeoutTunnel: "600", Websocket: true}},
+	}
+
+	actual, err := GetBackend(&service)
+
+	s.NoError(err)
+	s.Contains(actual, `
+backend my-service-ws-be1111_0
+    mode http
+    http-request add-header X-Forwarded-Proto https if { ssl_fc }
+    timeout tunnel 600s
+    timeout server-fin 5s
+    server my-service my-service:1111`)
+}
+
+func (s *TemplateTestSuite) Test_GetBackend_AddsSendProxy_WhenSendProxyIsSet() {
+	service := Service{
+		ServiceName: "my-service",
+		AclName:     "my-service",
+		ServiceDest: []ServiceDest{
+			{ReqMode: "http", Port: "1111", SendProxy: "v1"},
+			{ReqMode: "tcp", Port: "2222", SendProxy: "v2", Index: 1},
+		},
+	}
+
+	actual, err := GetBackend(&service)
+
+	s.NoError(err)
+	s.Equal(`
+backend my-service-be1111_0
+    mode http
+    http-request add-header X-Forwarded-Proto https if { ssl_fc }
+    server my-service my-service:1111 send-proxy
+backend my-service-be2222_1
+    mode tcp
+    server my-service my-service:2222 send-proxy-v2`, actual)
+}
+
+func (s *TemplateTestSuite) Test_GetBackend_EncryptsTcpServer_WhenTerminateSslAndSslVerifyNoneAreSet() {
+	service := Service{
+		ServiceName: "my-service",
+		AclName:     "my-service",
+		ServiceDest: []ServiceDest{
+			{ReqMode: "tcp", Port: "1111", TerminateSsl: true},
+			{ReqMode: "tcp", Port: "2222", TerminateSsl: true, SslVerifyNone: true, Index: 1},
+		},
+	}
+
+	actual, err := GetBackend(&service)
+
+	s.NoError(err)
+	s.Equal(`
+backend my-service-be1111_0
+    mode tcp
+    server my-service my-service:1111
+backend my-service-be2222_1
+    mode tcp
+    server my-service my-service:2222 ssl verify none`, actual)
+}
+
+func (s *TemplateTestSuite) Test_GetBackend_SkipsUdpDestinations() {
+	service := Service{
+		ServiceName:  "my-service",
+		AclName:      "my-service",
+		BackendExtra: "option tcplog",
+		ServiceDest: []ServiceDest{
+			{ReqMode: "udp", Port: "53", SrcPort: 53},
+			{ReqMode: "tcp", Port: "2222", Index: 1},
+		},
+	}
+
+	actual, err := GetBackend(&service)
+
+	s.NoError(err)
+	s.Equal(`
+backend my-service-be2222_1
+    mode tcp
+    server my-service my-service:2222
+    option tcplog`, actual)
+}
+
+func (s *TemplateTestSuite) Test_GetBackend_ReplacesTemplates_WhenOverridesExist() {
+	dir := s.setOverrides(map[string]string{
+		"servers.tmpl": `{{define "backend-servers"}}
+    server {{upper .Service.ServiceName}} {{.Service.ServiceName}}.internal:{{.Port}} check
+{{- end}}`,
+	})
+	defer os.RemoveAll(dir)
+	service := Service{
+		ServiceName: "my-service",
+		AclName:     "my-service",
+		ServiceDest: []ServiceDest{{ReqMode: "http", Port: "1111"}},
+	}
+
+	actual, err := GetBackend(&service)
+
+	s.NoError(err)
+	s.Equal(`
+backend my-service-be1111_0
+    mode http
+    http-request add-header X-Forwarded-Proto https if { ssl_fc }
+    server MY-SERVICE my-service.internal:1111 check`, actual)
+}
+
+func (s *TemplateTestSuite) Test_GetBackend_ReturnsError_WhenOverrideCannotBeParsed() {
+	dir := s.setOverrides(map[string]string{
+		"servers.tmpl": "{{define \"backend-servers\"}}\n    server {{.Service.ServiceName\n{{- end}}",
+	})
+	defer os.RemoveAll(dir)
+	service := Service{ServiceName: "my-service", ServiceDest: []ServiceDest{{ReqMode: "http", Port: "1111"}}}
+
+	_, err := GetBackend(&service)
+
+	s.Error(err)
+	s.Contains(err.Error(), "servers.tmpl:3")
+}
+
+func (s *TemplateTestSuite) Test_GetBackend_ReturnsError_WhenOverrideUsesUnknownField() {
+	dir := s.setOverrides(map[string]string{
+		"servers.tmpl": `{{define "backend-servers"}}
+    server {{.Service.DoesNotExist}}
+{{- end}}`,
+	})
+	defer os.RemoveAll(dir)
+	service := Service{ServiceName: "my-service", ServiceDest: []ServiceDest{{ReqMode: "http", Port: "1111"}}}
+
+	_, err := GetBackend(&service)
+
+	s.Error(err)
+	s.Contains(err.Error(), "DoesNotExist")
+}
+
+// getFrontTemplate
+
+func (s *TemplateTestSuite) Test_GetFrontTemplate_ReplacesTemplate_WhenOverrideExists() {
+	dir := s.setOverrides(map[string]string{
+		"frontend.tmpl": `{{define "frontend"}}
+    use_backend {{.AclName}}-be{{(index .ServiceDest 0).Port}}_0 if { path_beg {{join (index .ServiceDest 0).ServicePath " "}} }
+{{- end}}`,
+	})
+	defer os.RemoveAll(dir)
+	service := Service{
+		AclName:     "my-service",
+		ServiceDest: []ServiceDest{{ReqMode: "http", Port: "1111", ServicePath: []string{"/api", "/admin"}}},
+	}
+
+	actual, err := getFrontTemplate(service)
+
+	s.NoError(err)
+	s.Equal(`
+    use_backend my-service-be1111_0 if { path_beg /api /admin }`, actual)
+}
+
+// refreshTemplates
+
+func (s *TemplateTestSuite) Test_RefreshTemplates_ParsesTemplatesOnlyWhenOverridesChange() {
+	dir := s.setOverrides(map[string]string{
+		"frontend.tmpl": `{{define "frontend"}}original{{end}}`,
+	})
+	defer os.RemoveAll(dir)
+	parsed := templateCache.tmpl
+
+	err := refreshTemplates()
+
+	s.NoError(err)
+	s.True(parsed == templateCache.tmpl)
+	path := filepath.Join(dir, "frontend.tmpl")
+	ioutil.WriteFile(path, []byte(`{{define "frontend"}}changed{{end}}`), 0644)
+	modTime := time.Now().Add(time.Minute)
+	os.Chtimes(path, modTime, modTime)
+	s.NoError(refreshTemplates())
+	s.False(parsed == templateCache.tmpl)
+	actual, _ := getFrontTemplate(Service{})
+	s.Equal("changed", actual)
+}
+
+func (s *TemplateTestSuite) setOverrides(files map[string]string) string {
+	dir, _ := ioutil.TempDir("", "dfp-template-test")
+	for name, content := range files {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+	overridesPathOrig := os.Getenv("TEMPLATE_OVERRIDES_PATH")
+	os.Setenv("TEMPLATE_OVERRIDES_PATH", dir)
+	refreshTemplates()
+	s.T().Cleanup(func() {
+		os.Setenv("TEMPLATE_OVERRIDES_PATH", overridesPathOrig)
+		refreshTemplates()
+	})
+	return dir
+}
@@ -13,6 +13,10 @@ var usersBasePath string = "/run/secrets/dfp_users_%s"
 type ServiceDest struct {
 	// The list of allowed methods. If specified, a request with a method that is not on the list will be denied.
 	AllowedMethods []string
+	// The protocol used to send requests to the service.
+	// If set to `h2`, requests are sent over HTTP/2 (h2c if the service does not use SSL).
+	// Only used in http mode.
+	BackendProto string
 	// HAProxy balance mode for in TCP groups.
 	BalanceGroup string
 	// Checks tcp connection. Only used in sni or tcp mode.
@@ -23,6 +27,9 @@ type ServiceDest struct {
 	DeniedMethods []string
 	// Whether to deny HTTP requests thus allowing only HTTPS.
 	DenyHttp bool
+	// Whether to check the health of servers through the gRPC health checking protocol.
+	// Only used in grpc mode.
+	GrpcHealthCheck bool
 	// Whether to redirect all http requests to https
 	HttpsOnly bool
 	// The internal HTTPS port of a service that should be reconfigured.
@@ -33,6 +40,9 @@ type ServiceDest struct {
 	HttpsRedirectCode string
 	// Whether to ignore authorization for this service destination.
 	IgnoreAuthorization bool
+	// The time in seconds the proxy waits for the SSL client hello of connections to the source port.
+	// Only used in sni mode. The longest delay of all the destinations of the port is used.
+	InspectDelay string
 	// The hostname where the service is running, for instance on a separate swarm.
 	// If specified, the proxy will dispatch requests to that domain.
 	OutboundHostname string
@@ -45,7 +55,8 @@ type ServiceDest struct {
 	// If a request is sent to one of the domains in this list, it will be redirected to one of the values of the `ServiceDomain`.
 	RedirectFromDomain []string
 	// The request mode. The proxy should be able to work with any mode supported by HAProxy.
-	// However, actively supported and tested modes are *http*, *tcp*, and *sni*.
+	// However, actively supported and tested modes are *http*, *grpc*, *tcp*, and *sni*.
+	// The *grpc* mode is the *http* mode with HTTP/2 connections to the servers.
 	ReqMode string
 	// Internal use only. Do not modify.
 	ReqModeFormatted string
@@ -79,6 +90,11 @@ type ServiceDest struct {
 	SrcHttpsPortAcl string
 	// Internal use only. Do not modify.
 	SrcHttpsPortAclName string
+	// The version of the PROXY protocol used to send client addresses to the service (`v1` or `v2`).
+	SendProxy string
+	// The names of the certificates used by the source port when the proxy terminates SSL in tcp mode.
+	// If not specified, all the certificates are used.
+	SslCert []string
 	// If set to true, server certificates are not verified. This flag should be set for SSL enabled backend services.
 	SslVerifyNone bool
 	// The server timeout in seconds
@@ -87,8 +103,16 @@ type ServiceDest struct {
 	TimeoutClient string
 	// The tunnel timeout in seconds
 	TimeoutTunnel string
+	// Whether the proxy terminates SSL of connections to the source port and forwards plain connections to the service.
+	// Connections to the service are encrypted as well if `SslVerifyNone` is set.
+	// Only used in tcp mode.
+	TerminateSsl bool
 	// Whether to verify client SSL and deny request when it is invalid
 	VerifyClientSsl bool
+	// Whether the service accepts WebSocket connections.
+	// If set to true, upgrade requests are sent to a separate backend with WebSocket timeouts
+	// and other requests to the same path are sent to the regular backend.
+	Websocket bool
 	// If specified, only requests with the same agent will be forwarded to the backend.
 	UserAgent UserAgent
 	// User defined value.
@@ -159,6 +183,9 @@ type Service struct {
 	// Whether to distribute a request to all the instances of the proxy.
 	// Used only in the swarm mode.
 	Distribute bool `split_words:"true"`
+	// Pages returned instead of those generated by HAProxy.
+	// They are defined through `errorPage.<code>`, `errorPageSecret.<code>`, and `errorPageUrl.<code>` parameters.
+	ErrorPages []ErrorPage
 	// If set to true, it will be the default_backend service.
 	IsDefaultBackend bool `split_words:"true"`
 	// When `FILTER_PROXY_INSTANCE_NAME` is set to `true`, only services with
@@ -194,11 +221,17 @@ type Service struct {
 	SetReqHeader []string `split_words:"true"`
 	// Additional headers that will be set to the response before forwarding it to the client. If a specified header exists, it will be replaced with the new one.
 	SetResHeader []string `split_words:"true"`
+	// The name of the backend template uploaded through the templates API.
+	// If specified, it is used instead of `templateBePath`.
+	TemplateBeName string `split_words:"true"`
 	// The path to the template representing a snippet of the backend configuration.
 	// If specified, the backend template will be loaded from the specified file.
 	// If specified, `templateFePath` must be set as well.
 	// See the https://github.com/docker-flow/docker-flow-proxy#templates section for more info.
 	TemplateBePath string `split_words:"true"`
+	// The name of the frontend template uploaded through the templates API.
+	// If specified, it is used instead of `templateFePath`.
+	TemplateFeName string `split_words:"true"`
 	// The path to the template representing a snippet of the frontend configuration.
 	// If specified, the frontend template will be loaded from the specified file.
 	// If specified, `templateBePath` must be set as well.
@@ -322,6 +355,17 @@ func GetServiceFromMap(req *map[string]string) *Service {
 	return GetServiceFromProvider(&provider)
 }
 
+// IsHttp returns true if requests to the destination are routed in the http mode of the frontend
+func (sd ServiceDest) IsHttp() bool {
+	return sd.ReqMode == "http" || sd.ReqMode == "grpc"
+}
+
+// HasTemplate returns true if the frontend or the backend of the service is generated from a custom template
+func (s Service) HasTemplate() bool {
+	return len(s.TemplateFePath) > 0 || len(s.TemplateBePath) > 0 ||
+		len(s.TemplateFeName) > 0 || len(s.TemplateBeName) > 0
+}
+
 // GetServiceFromProvider returns Service by extracting parameters from ServiceParameterProvider
 func GetServiceFromProvider(provider ServiceParameterProvider) *Service {
 	sr := new(Service)
@@ -363,7 +407,8 @@ func GetServiceFromProvider(provider ServiceParameterProvider) *Service {
 		sr.IsGlobal = true
 	}
 
-	if len(sr.SessionType) > 0 {
+	// Providers can fill tasks themselves (e.g. with addresses taken from a service registry)
+	if len(sr.SessionType) > 0 && len(sr.Tasks) == 0 {
 		sr.Tasks, _ = LookupHost("tasks." + sr.ServiceName)
 	}
 	globalUsersString := getSecretOrEnvVar("USERS", "")
@@ -377,6 +422,7 @@ func GetServiceFromProvider(provider ServiceParameterProvider) *Service {
 		globalUsersEncrypted,
 	)
 
+	sr.ErrorPages = getErrorPages(provider)
 	sr.ServiceDest = getServiceDestList(sr, provider)
 	return sr
 }
@@ -467,15 +513,18 @@ func getServiceDest(sr *Service, provider ServiceParameterProvider, index int) S
 	}
 	return ServiceDest{
 		AllowedMethods:                getSliceFromString(provider, "allowedMethods", suffix),
+		BackendProto:                  getFromString(provider, "backendProto", suffix),
 		BalanceGroup:                  getFromString(provider, "balanceGroup", suffix),
 		CheckTCP:                      getBoolParam(provider, "checkTcp", suffix),
 		Clitcpka:                      getBoolParam(provider, "clitcpka", suffix),
 		DeniedMethods:                 getSliceFromString(provider, "deniedMethods", suffix),
 		DenyHttp:                      getBoolParam(provider, "denyHttp", suffix),
+		GrpcHealthCheck:               getBoolParam(provider, "grpcHealthCheck", suffix),
 		HttpsOnly:                     getBoolParam(provider, "httpsOnly", suffix),
 		HttpsPort:                     httpsPort,
 		HttpsRedirectCode:             getFromString(provider, "httpsRedirectCode", suffix),
 		IgnoreAuthorization:           getBoolParam(provider, "ignoreAuthorization", suffix),
+		InspectDelay:                  getFromString(provider, "inspectDelay", suffix),
 		OutboundHostname:              getFromString(provider, "outboundHostname", suffix),
 		PathType:                      getFromString(provider, "pathType", suffix),
 		Port:                          getFromString(provider, "port", suffix),
@@ -490,11 +539,15 @@ func getServiceDest(sr *Service, provider ServiceParameterProvider, index int) S
 		ServicePathExclude:            getSliceFromString(provider, "servicePathExclude", suffix),
 		SrcPort:                       srcPort,
 		SrcHttpsPort:                  srcHttpsPort,
+		SendProxy:                     getFromString(provider, "sendProxy", suffix),
+		SslCert:                       getSliceFromString(provider, "sslCert", suffix),
 		SslVerifyNone:                 getBoolParam(provider, "sslVerifyNone", suffix),
 		TimeoutClient:                 getFromString(provider, "timeoutClient", suffix),
 		TimeoutServer:                 getFromString(provider, "timeoutServer", suffix),
 		TimeoutTunnel:                 getFromString(provider, "timeoutTunnel", suffix),
+		TerminateSsl:                  getBoolParam(provider, "terminateSsl", suffix),
 		VerifyClientSsl:               getBoolParam(provider, "verifyClientSsl", suffix),
+		Websocket:                     getBoolParam(provider, "websocket", suffix),
 		UserAgent:                     userAgent,
 		UserDef:                       getFromString(provider, "userDef", suffix),
 		Index:                         sdIndex,
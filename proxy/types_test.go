@@ -262,6 +262,28 @@ func (s *TypesTestSuite) Test_GetServiceFromProvider_AddsTasksWhenSessionTypeIsN
 	s.Equal(expected, *actual)
 }
 
+func (s *TypesTestSuite) Test_GetServiceFromProvider_DoesNotLookupTasks_WhenProviderSetsThem() {
+	serviceMap := map[string]string{
+		"serviceName": "my-service",
+		"port":        "1234",
+		"sessionType": "sticky-server",
+	}
+	provider := tasksParameterProvider{
+		ServiceParameterProvider: NewMapParameterProvider(&serviceMap),
+		tasks:                    []string{"10.0.0.1"},
+	}
+	lookupHostOrig := LookupHost
+	defer func() { LookupHost = lookupHostOrig }()
+	LookupHost = func(host string) (addrs []string, err error) {
+		s.Fail("LookupHost should not be called")
+		return nil, nil
+	}
+
+	actual := GetServiceFromProvider(&provider)
+
+	s.Equal([]string{"10.0.0.1"}, actual.Tasks)
+}
+
 func (s *TypesTestSuite) Test_GetServiceFromProvider_UsesNonIndexedData() {
 	expected := Service{
 		ServiceDest: []ServiceDest{{
@@ -278,6 +300,7 @@ func (s *TypesTestSuite) Test_GetServiceFromProvider_UsesNonIndexedData() {
 			ServiceHeader:                 map[string]string{},
 			ServicePath:                   []string{"/"},
 			ServicePathExclude:            []string{},
+			SslCert:                       []string{},
 		}},
 		ServiceName: "serviceName",
 		Replicas:    0,
@@ -311,6 +334,7 @@ func (s *TypesTestSuite) Test_GetServiceFromProvider_MovesHttpsOnlyToIndexedEntr
 			ServiceHeader:                 map[string]string{},
 			ServicePath:                   []string{"/"},
 			ServicePathExclude:            []string{},
+			SslCert:                       []string{},
 		}},
 		ServiceName: "serviceName",
 		Replicas:    3,
@@ -344,6 +368,7 @@ func (s *TypesTestSuite) Test_GetServiceFromProvider_UsesHttpsOnlyFromEnvVar() {
 			ServiceHeader:                 map[string]string{},
 			ServicePath:                   []string{"/"},
 			ServicePathExclude:            []string{},
+			SslCert:                       []string{},
 		}},
 		ServiceName: "serviceName",
 		Replicas:    3,
@@ -400,6 +425,7 @@ func (s *TypesTestSuite) getServiceMap(expected Service, indexSuffix, separator
 		"balanceGroup" + indexSuffix:         expected.ServiceDest[0].BalanceGroup,
 		"checkTcp" + indexSuffix:             strconv.FormatBool(expected.ServiceDest[0].CheckTCP),
 		"clitcpka" + indexSuffix:             strconv.FormatBool(expected.ServiceDest[0].Clitcpka),
+		"backendProto" + indexSuffix:         expected.ServiceDest[0].BackendProto,
 		"deniedMethods" + indexSuffix:        strings.Join(expected.ServiceDest[0].DeniedMethods, separator),
 		"denyHttp" + indexSuffix:             strconv.FormatBool(expected.ServiceDest[0].DenyHttp),
 		"httpsOnly" + indexSuffix:            strconv.FormatBool(expected.ServiceDest[0].HttpsOnly),
@@ -419,10 +445,15 @@ func (s *TypesTestSuite) getServiceMap(expected Service, indexSuffix, separator
 		"timeoutClient" + indexSuffix:        expected.ServiceDest[0].TimeoutClient,
 		"timeoutServer" + indexSuffix:        expected.ServiceDest[0].TimeoutServer,
 		"timeoutTunnel" + indexSuffix:        expected.ServiceDest[0].TimeoutTunnel,
+		"sendProxy" + indexSuffix:            expected.ServiceDest[0].SendProxy,
+		"inspectDelay" + indexSuffix:         expected.ServiceDest[0].InspectDelay,
+		"sslCert" + indexSuffix:              strings.Join(expected.ServiceDest[0].SslCert, separator),
 		"sslVerifyNone" + indexSuffix:        strconv.FormatBool(expected.ServiceDest[0].SslVerifyNone),
+		"terminateSsl" + indexSuffix:         strconv.FormatBool(expected.ServiceDest[0].TerminateSsl),
 		"userAgent" + indexSuffix:            strings.Join(expected.ServiceDest[0].UserAgent.Value, separator),
 		"userDef" + indexSuffix:              expected.ServiceDest[0].UserDef,
 		"verifyClientSsl" + indexSuffix:      strconv.FormatBool(expected.ServiceDest[0].VerifyClientSsl),
+		"websocket" + indexSuffix:            strconv.FormatBool(expected.ServiceDest[0].Websocket),
 	}
 }
 
@@ -447,6 +478,7 @@ func (s *TypesTestSuite) getExpectedService() Service {
 		ServiceDomainAlgo:     "hdr_dom",
 		ServiceDest: []ServiceDest{{
 			AllowedMethods:                []string{"GET", "DELETE"},
+			BackendProto:                  "h2",
 			BalanceGroup:                  "balanceGroup",
 			CheckTCP:                      true,
 			Clitcpka:                      true,
@@ -456,6 +488,7 @@ func (s *TypesTestSuite) getExpectedService() Service {
 			HttpsPort:                     1234,
 			HttpsRedirectCode:             "302",
 			IgnoreAuthorization:           true,
+			InspectDelay:                  "10",
 			OutboundHostname:              "outboundHostname",
 			PathType:                      "pathType",
 			Port:                          "1234",
@@ -468,6 +501,9 @@ func (s *TypesTestSuite) getExpectedService() Service {
 			ServiceHeader:                 map[string]string{"X-Version": "3", "name": "Viktor"},
 			ServicePath:                   []string{"/"},
 			ServicePathExclude:            []string{},
+			SslCert:                       []string{"my-cert.pem"},
+			TerminateSsl:                  true,
+			SendProxy:                     "v2",
 			SslVerifyNone:                 true,
 			TimeoutClient:                 "timeoutClient",
 			TimeoutServer:                 "timeoutServer",
@@ -475,6 +511,7 @@ func (s *TypesTestSuite) getExpectedService() Service {
 			UserAgent:                     UserAgent{Value: []string{"agent-1", "agent-2/replace-with_"}, AclName: "agent_1_agent_2_replace_with_"},
 			UserDef:                       "userDef",
 			VerifyClientSsl:               true,
+			Websocket:                     true,
 			Index:                         1,
 		}},
 		ServiceName:    "serviceName",
@@ -488,3 +525,13 @@ func (s *TypesTestSuite) getExpectedService() Service {
 		},
 	}
 }
+
+type tasksParameterProvider struct {
+	ServiceParameterProvider
+	tasks []string
+}
+
+func (p *tasksParameterProvider) Fill(service *Service) {
+	p.ServiceParameterProvider.Fill(service)
+	service.Tasks = p.tasks
+}
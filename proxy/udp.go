@@ -0,0 +1,440 @@
+package proxy
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// UdpStats contains statistics of a UDP listener.
+// Counters are accumulated since the listener was started.
+type UdpStats struct {
+	ServiceName     string
+	SrcPort         int
+	Port            string
+	Targets         int
+	CurrentSessions int
+	SessionsTotal   uint64
+	PacketsIn       uint64
+	PacketsOut      uint64
+	BytesIn         uint64
+	BytesOut        uint64
+	PacketsDropped  uint64
+}
+
+// udpConfig describes a UDP destination of a service.
+// A listener is restarted whenever its configuration changes.
+type udpConfig struct {
+	ServiceName string
+	Host        string
+	Port        string
+	SrcPort     int
+	Balance     string
+	Timeout     time.Duration
+}
+
+type udpSession struct {
+	// Accessed atomically so it is kept first to be 64-bit aligned
+	lastActive int64
+	client     *net.UDPAddr
+	target     string
+	conn       *net.UDPConn
+}
+
+// udpCounters are accessed atomically so they are kept first in udpListener to be 64-bit aligned
+type udpCounters struct {
+	sessionsTotal  uint64
+	packetsIn      uint64
+	packetsOut     uint64
+	bytesIn        uint64
+	bytesOut       uint64
+	packetsDropped uint64
+}
+
+type udpListener struct {
+	counters udpCounters
+	config   udpConfig
+	conn     *net.UDPConn
+	mu       sync.Mutex
+	targets  []string
+	next     int
+	sessions map[string]*udpSession
+	done     chan struct{}
+}
+
+type udpBalancer struct {
+	mu        sync.Mutex
+	listeners map[int]*udpListener
+}
+
+var udpBalancerInstance = &udpBalancer{listeners: map[int]*udpListener{}}
+
+// reconcileUdp starts, restarts, and stops UDP listeners so that they match the `udp` destinations of the services
+var reconcileUdp = func(services map[string]Service) error {
+	return udpBalancerInstance.reconcile(services)
+}
+
+var listenUdp = func(port int) (*net.UDPConn, error) {
+	return net.ListenUDP("udp", &net.UDPAddr{Port: port})
+}
+
+var dialUdp = func(address string) (*net.UDPConn, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return net.DialUDP("udp", nil, addr)
+}
+
+var udpResolveInterval = 10 * time.Second
+var udpExpireInterval = time.Second
+
+// GetUdpStats returns statistics of all the UDP listeners sorted by their source ports
+func GetUdpStats() []UdpStats {
+	return udpBalancerInstance.getStats()
+}
+
+// reconcile starts all the listeners it can.
+// Errors of the listeners that could not be started are returned together.
+func (m *udpBalancer) reconcile(services map[string]Service) error {
+	configs, errs := getUdpConfigs(services)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for srcPort, l := range m.listeners {
+		if config, ok := configs[srcPort]; !ok || config != l.config {
+			logPrintf("Stopping UDP listener on port %d", srcPort)
+			l.stop()
+			delete(m.listeners, srcPort)
+		}
+	}
+	for srcPort, config := range configs {
+		if _, ok := m.listeners[srcPort]; ok {
+			continue
+		}
+		logPrintf("Starting UDP listener on port %d for the service %s", srcPort, config.ServiceName)
+		l, err := startUdpListener(config)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("Could not listen on UDP port %d\n%s", srcPort, err.Error()))
+			continue
+		}
+		m.listeners[srcPort] = l
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+func (m *udpBalancer) getStats() []UdpStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := []UdpStats{}
+	for _, l := range m.listeners {
+		stats = append(stats, l.getStats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].SrcPort < stats[j].SrcPort })
+	return stats
+}
+
+// getUdpConfigs returns configurations of the udp destinations mapped by their source ports.
+// Services are processed in the order of their names and destinations with ports that are already used are skipped.
+func getUdpConfigs(services map[string]Service) (map[int]udpConfig, []string) {
+	timeout := 30
+	if value, err := strconv.Atoi(os.Getenv("UDP_SESSION_TIMEOUT")); err == nil && value > 0 {
+		timeout = value
+	}
+	names := []string{}
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	configs := map[int]udpConfig{}
+	errs := []string{}
+	for _, name := range names {
+		s := services[name]
+		for _, sd := range s.ServiceDest {
+			if sd.ReqMode != "udp" {
+				continue
+			}
+			if existing, ok := configs[sd.SrcPort]; ok {
+				errs = append(errs, fmt.Sprintf("UDP port %d is used by the services %s and %s", sd.SrcPort, existing.ServiceName, s.ServiceName))
+				continue
+			}
+			config := udpConfig{
+				ServiceName: s.ServiceName,
+				Host:        sd.OutboundHostname,
+				Port:        sd.Port,
+				SrcPort:     sd.SrcPort,
+				Balance:     sd.BalanceGroup,
+				Timeout:     time.Duration(timeout) * time.Second,
+			}
+			if value, err := strconv.Atoi(sd.TimeoutClient); err == nil && value > 0 {
+				config.Timeout = time.Duration(value) * time.Second
+			}
+			configs[sd.SrcPort] = config
+		}
+	}
+	return configs, errs
+}
+
+// getUdpSrcPortError returns a message if a udp destination of the service does not have a source port
+// or uses a source port that is already used by another udp destination.
+// Destinations of the service that is being reconfigured are replaced so they are not treated as conflicts.
+func getUdpSrcPortError(service *Service) string {
+	var used map[int]string
+	for _, sd := range service.ServiceDest {
+		if sd.ReqMode != "udp" {
+			continue
+		}
+		if used == nil {
+			used = getUsedUdpSrcPorts(service.ServiceName)
+		}
+		if sd.SrcPort <= 0 {
+			return "When using reqMode udp, srcPort parameter is mandatory."
+		}
+		if name, ok := used[sd.SrcPort]; ok {
+			return fmt.Sprintf("UDP port %d is already used by the service %s.", sd.SrcPort, name)
+		}
+		used[sd.SrcPort] = service.ServiceName
+	}
+	return ""
+}
+
+// getUsedUdpSrcPorts returns names of the services, other than the excluded one, mapped by the source ports of their udp destinations
+func getUsedUdpSrcPorts(excludedService string) map[int]string {
+	used := map[int]string{}
+	if Instance == nil {
+		return used
+	}
+	for _, s := range Instance.GetServices() {
+		if s.ServiceName == excludedService {
+			continue
+		}
+		for _, sd := range s.ServiceDest {
+			if sd.ReqMode == "udp" {
+				used[sd.SrcPort] = s.ServiceName
+			}
+		}
+	}
+	return used
+}
+
+func startUdpListener(config udpConfig) (*udpListener, error) {
+	conn, err := listenUdp(config.SrcPort)
+	if err != nil {
+		return nil, err
+	}
+	l := &udpListener{
+		config:   config,
+		conn:     conn,
+		sessions: map[string]*udpSession{},
+		done:     make(chan struct{}),
+	}
+	l.resolve()
+	go l.serve()
+	go l.maintain()
+	return l, nil
+}
+
+// resolve fetches the addresses of the service replicas.
+// The service name itself is used as the target if its tasks cannot be resolved.
+func (l *udpListener) resolve() {
+	host := l.config.Host
+	if len(host) == 0 {
+		host = "tasks." + l.config.ServiceName
+	}
+	ips, err := LookupHost(host)
+	if err != nil || len(ips) == 0 {
+		ips = []string{l.config.ServiceName}
+		if len(l.config.Host) > 0 {
+			ips = []string{l.config.Host}
+		}
+	}
+	sort.Strings(ips)
+	targets := []string{}
+	for _, ip := range ips {
+		targets = append(targets, net.JoinHostPort(ip, l.config.Port))
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.targets = targets
+	valid := map[string]bool{}
+	for _, target := range targets {
+		valid[target] = true
+	}
+	for key, session := range l.sessions {
+		if !valid[session.target] {
+			session.conn.Close()
+			delete(l.sessions, key)
+		}
+	}
+}
+
+func (l *udpListener) serve() {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := l.conn.ReadFromUDP(buf)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				continue
+			}
+			return
+		}
+		atomic.AddUint64(&l.counters.packetsIn, 1)
+		atomic.AddUint64(&l.counters.bytesIn, uint64(n))
+		session, err := l.getSession(addr)
+		if err != nil {
+			logPrintf("Could not forward UDP packet from %s\n%s", addr.String(), err.Error())
+			atomic.AddUint64(&l.counters.packetsDropped, 1)
+			continue
+		}
+		if _, err := session.conn.Write(buf[:n]); err != nil {
+			atomic.AddUint64(&l.counters.packetsDropped, 1)
+		}
+	}
+}
+
+// getSession returns the session of the client or creates a new one.
+// All the packets of a session are sent to the same target.
+// The target is dialed without holding the lock since resolving its name might take a while.
+func (l *udpListener) getSession(client *net.UDPAddr) (*udpSession, error) {
+	key := client.String()
+	l.mu.Lock()
+	if session, ok := l.sessions[key]; ok {
+		atomic.StoreInt64(&session.lastActive, time.Now().UnixNano())
+		l.mu.Unlock()
+		return session, nil
+	}
+	if len(l.targets) == 0 {
+		l.mu.Unlock()
+		return nil, fmt.Errorf("There are no targets for the service %s", l.config.ServiceName)
+	}
+	var target string
+	if l.config.Balance == "source" {
+		hash := fnv.New32a()
+		hash.Write(client.IP)
+		target = l.targets[hash.Sum32()%uint32(len(l.targets))]
+	} else {
+		target = l.targets[l.next%len(l.targets)]
+		l.next++
+	}
+	l.mu.Unlock()
+	conn, err := dialUdp(target)
+	if err != nil {
+		return nil, err
+	}
+	session := &udpSession{
+		client:     client,
+		target:     target,
+		conn:       conn,
+		lastActive: time.Now().UnixNano(),
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-l.done:
+		conn.Close()
+		return nil, fmt.Errorf("The UDP listener on port %d is stopped", l.config.SrcPort)
+	default:
+	}
+	// Sessions are created only by `serve` so no other session could be added in the meantime
+	l.sessions[key] = session
+	atomic.AddUint64(&l.counters.sessionsTotal, 1)
+	go l.reply(key, session)
+	return session, nil
+}
+
+// reply sends packets received from the target back to the client until the session is closed
+func (l *udpListener) reply(key string, session *udpSession) {
+	buf := make([]byte, 65535)
+	for {
+		n, err := session.conn.Read(buf)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				continue
+			}
+			break
+		}
+		atomic.StoreInt64(&session.lastActive, time.Now().UnixNano())
+		if _, err := l.conn.WriteToUDP(buf[:n], session.client); err != nil {
+			atomic.AddUint64(&l.counters.packetsDropped, 1)
+			continue
+		}
+		atomic.AddUint64(&l.counters.packetsOut, 1)
+		atomic.AddUint64(&l.counters.bytesOut, uint64(n))
+	}
+	// The session might have failed (e.g. the target is gone) so it is not closed by `expire` or `stop`
+	session.conn.Close()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.sessions[key] == session {
+		delete(l.sessions, key)
+	}
+}
+
+// maintain re-resolves the targets and closes sessions that were idle longer than the timeout
+func (l *udpListener) maintain() {
+	resolveTicker := time.NewTicker(udpResolveInterval)
+	expireTicker := time.NewTicker(udpExpireInterval)
+	defer resolveTicker.Stop()
+	defer expireTicker.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-resolveTicker.C:
+			l.resolve()
+		case <-expireTicker.C:
+			l.expire()
+		}
+	}
+}
+
+func (l *udpListener) expire() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	deadline := time.Now().Add(-l.config.Timeout).UnixNano()
+	for key, session := range l.sessions {
+		if atomic.LoadInt64(&session.lastActive) < deadline {
+			session.conn.Close()
+			delete(l.sessions, key)
+		}
+	}
+}
+
+func (l *udpListener) stop() {
+	close(l.done)
+	l.conn.Close()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, session := range l.sessions {
+		session.conn.Close()
+		delete(l.sessions, key)
+	}
+}
+
+func (l *udpListener) getStats() UdpStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return UdpStats{
+		ServiceName:     l.config.ServiceName,
+		SrcPort:         l.config.SrcPort,
+		Port:            l.config.Port,
+		Targets:         len(l.targets),
+		CurrentSessions: len(l.sessions),
+		SessionsTotal:   atomic.LoadUint64(&l.counters.sessionsTotal),
+		PacketsIn:       atomic.LoadUint64(&l.counters.packetsIn),
+		PacketsOut:      atomic.LoadUint64(&l.counters.packetsOut),
+		BytesIn:         atomic.LoadUint64(&l.counters.bytesIn),
+		BytesOut:        atomic.LoadUint64(&l.counters.bytesOut),
+		PacketsDropped:  atomic.LoadUint64(&l.counters.packetsDropped),
+	}
+}
@@ -0,0 +1,330 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type UdpTestSuite struct {
+	suite.Suite
+	echo           *net.UDPConn
+	echoPort       string
+	lookupHostOrig func(host string) (addrs []string, err error)
+	listenUdpOrig  func(port int) (*net.UDPConn, error)
+}
+
+func TestUdpUnitTestSuite(t *testing.T) {
+	suite.Run(t, new(UdpTestSuite))
+}
+
+func (s *UdpTestSuite) SetupTest() {
+	echo, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	s.Require().NoError(err)
+	s.echo = echo
+	s.echoPort = strconv.Itoa(echo.LocalAddr().(*net.UDPAddr).Port)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := echo.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			echo.WriteToUDP(append([]byte("echo "), buf[:n]...), addr)
+		}
+	}()
+	s.lookupHostOrig = LookupHost
+	s.listenUdpOrig = listenUdp
+	LookupHost = func(host string) (addrs []string, err error) {
+		return []string{"127.0.0.1"}, nil
+	}
+	listenUdp = func(port int) (*net.UDPConn, error) {
+		return net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	}
+}
+
+func (s *UdpTestSuite) TearDownTest() {
+	udpBalancerInstance.reconcile(map[string]Service{})
+	s.echo.Close()
+	LookupHost = s.lookupHostOrig
+	listenUdp = s.listenUdpOrig
+}
+
+// reconcile
+
+func (s *UdpTestSuite) Test_Reconcile_ForwardsPacketsToService() {
+	var lookupHost string
+	LookupHost = func(host string) (addrs []string, err error) {
+		lookupHost = host
+		return []string{"127.0.0.1"}, nil
+	}
+	services := map[string]Service{
+		"my-service": {
+			ServiceName: "my-service",
+			ServiceDest: []ServiceDest{{ReqMode: "udp", SrcPort: 53, Port: s.echoPort}},
+		},
+	}
+
+	err := udpBalancerInstance.reconcile(services)
+
+	s.NoError(err)
+	s.Equal("tasks.my-service", lookupHost)
+	client := s.dialListener(53)
+	defer client.Close()
+	s.Equal("echo ping", s.sendAndReceive(client, "ping"))
+	s.Equal("echo pong", s.sendAndReceive(client, "pong"))
+	// Replies are counted after they are sent
+	for i := 0; i < 100 && GetUdpStats()[0].PacketsOut < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats := GetUdpStats()
+	s.Require().Len(stats, 1)
+	s.Equal(UdpStats{
+		ServiceName:     "my-service",
+		SrcPort:         53,
+		Port:            s.echoPort,
+		Targets:         1,
+		CurrentSessions: 1,
+		SessionsTotal:   1,
+		PacketsIn:       2,
+		PacketsOut:      2,
+		BytesIn:         8,
+		BytesOut:        18,
+	}, stats[0])
+}
+
+func (s *UdpTestSuite) Test_Reconcile_StopsListeners_WhenServicesAreRemoved() {
+	services := map[string]Service{
+		"my-service": {
+			ServiceName: "my-service",
+			ServiceDest: []ServiceDest{{ReqMode: "udp", SrcPort: 53, Port: s.echoPort}},
+		},
+	}
+	udpBalancerInstance.reconcile(services)
+
+	err := udpBalancerInstance.reconcile(map[string]Service{})
+
+	s.NoError(err)
+	s.Empty(GetUdpStats())
+}
+
+func (s *UdpTestSuite) Test_Reconcile_RestartsListener_WhenConfigChanges() {
+	services := map[string]Service{
+		"my-service": {
+			ServiceName: "my-service",
+			ServiceDest: []ServiceDest{{ReqMode: "udp", SrcPort: 53, Port: s.echoPort}},
+		},
+	}
+	udpBalancerInstance.reconcile(services)
+	original := udpBalancerInstance.listeners[53]
+	services["my-service"].ServiceDest[0].BalanceGroup = "source"
+
+	err := udpBalancerInstance.reconcile(services)
+
+	s.NoError(err)
+	s.NotEqual(original, udpBalancerInstance.listeners[53])
+	s.Equal("source", udpBalancerInstance.listeners[53].config.Balance)
+}
+
+func (s *UdpTestSuite) Test_Reconcile_ReturnsError_WhenServicesUseTheSameSrcPort() {
+	services := map[string]Service{
+		"my-service-1": {ServiceName: "my-service-1", ServiceDest: []ServiceDest{{ReqMode: "udp", SrcPort: 53, Port: "53"}}},
+		"my-service-2": {ServiceName: "my-service-2", ServiceDest: []ServiceDest{{ReqMode: "udp", SrcPort: 53, Port: "53"}}},
+	}
+
+	err := udpBalancerInstance.reconcile(services)
+
+	s.EqualError(err, "UDP port 53 is used by the services my-service-1 and my-service-2")
+	stats := GetUdpStats()
+	s.Require().Len(stats, 1)
+	s.Equal("my-service-1", stats[0].ServiceName)
+}
+
+func (s *UdpTestSuite) Test_Reconcile_StartsOtherListeners_WhenListenerCannotBeStarted() {
+	listenUdp = func(port int) (*net.UDPConn, error) {
+		if port == 53 {
+			return nil, fmt.Errorf("This is an error")
+		}
+		return net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	}
+	services := map[string]Service{
+		"my-service-1": {ServiceName: "my-service-1", ServiceDest: []ServiceDest{{ReqMode: "udp", SrcPort: 53, Port: "53"}}},
+		"my-service-2": {ServiceName: "my-service-2", ServiceDest: []ServiceDest{{ReqMode: "udp", SrcPort: 514, Port: "514"}}},
+	}
+
+	err := udpBalancerInstance.reconcile(services)
+
+	s.EqualError(err, "Could not listen on UDP port 53\nThis is an error")
+	stats := GetUdpStats()
+	s.Require().Len(stats, 1)
+	s.Equal(514, stats[0].SrcPort)
+}
+
+func (s *UdpTestSuite) Test_Reconcile_IgnoresNonUdpDestinations() {
+	services := map[string]Service{
+		"my-service": {
+			ServiceName: "my-service",
+			ServiceDest: []ServiceDest{{ReqMode: "tcp", SrcPort: 53, Port: "53"}},
+		},
+	}
+
+	err := udpBalancerInstance.reconcile(services)
+
+	s.NoError(err)
+	s.Empty(GetUdpStats())
+}
+
+// getUdpConfigs
+
+func (s *UdpTestSuite) Test_GetUdpConfigs_UsesTimeoutClient() {
+	timeoutOrig := os.Getenv("UDP_SESSION_TIMEOUT")
+	defer func() { os.Setenv("UDP_SESSION_TIMEOUT", timeoutOrig) }()
+	os.Setenv("UDP_SESSION_TIMEOUT", "60")
+	services := map[string]Service{
+		"my-service": {
+			ServiceName: "my-service",
+			ServiceDest: []ServiceDest{
+				{ReqMode: "udp", SrcPort: 53, Port: "53"},
+				{ReqMode: "udp", SrcPort: 514, Port: "514", TimeoutClient: "5", OutboundHostname: "syslog"},
+			},
+		},
+	}
+
+	actual, errs := getUdpConfigs(services)
+
+	s.Empty(errs)
+	s.Equal(map[int]udpConfig{
+		53:  {ServiceName: "my-service", Port: "53", SrcPort: 53, Timeout: 60 * time.Second},
+		514: {ServiceName: "my-service", Host: "syslog", Port: "514", SrcPort: 514, Timeout: 5 * time.Second},
+	}, actual)
+}
+
+// getSession
+
+func (s *UdpTestSuite) Test_GetSession_BalancesNewClientsInRoundRobin() {
+	l := s.newListener("")
+	defer l.stop()
+
+	first, _ := l.getSession(&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000})
+	second, _ := l.getSession(&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1001})
+	same, _ := l.getSession(&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000})
+
+	s.Equal("127.0.0.1:"+s.echoPort, first.target)
+	s.Equal("127.0.0.2:"+s.echoPort, second.target)
+	s.Equal(first, same)
+}
+
+func (s *UdpTestSuite) Test_GetSession_SendsClientsToTheSameTarget_WhenBalanceIsSource() {
+	l := s.newListener("source")
+	defer l.stop()
+
+	first, _ := l.getSession(&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000})
+	second, _ := l.getSession(&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1001})
+
+	s.NotEqual(first, second)
+	s.Equal(first.target, second.target)
+}
+
+// expire
+
+func (s *UdpTestSuite) Test_Expire_ClosesIdleSessions() {
+	l := s.newListener("")
+	defer l.stop()
+	idle, _ := l.getSession(&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000})
+	l.getSession(&net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 1000})
+	atomic.StoreInt64(&idle.lastActive, time.Now().Add(-time.Minute).UnixNano())
+
+	l.expire()
+
+	s.Len(l.sessions, 1)
+	s.NotContains(l.sessions, idle.client.String())
+}
+
+func (s *UdpTestSuite) Test_GetSession_DoesNotLockListener_WhileDialingTarget() {
+	l := s.newListener("")
+	defer l.stop()
+	dialUdpOrig := dialUdp
+	defer func() { dialUdp = dialUdpOrig }()
+	dialing := make(chan bool)
+	release := make(chan bool)
+	dialUdp = func(address string) (*net.UDPConn, error) {
+		dialing <- true
+		<-release
+		return dialUdpOrig(address)
+	}
+	done := make(chan bool)
+	go func() {
+		l.getSession(&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000})
+		close(done)
+	}()
+	<-dialing
+
+	stats := l.getStats()
+
+	s.Equal(0, stats.CurrentSessions)
+	close(release)
+	<-done
+	s.Len(l.sessions, 1)
+}
+
+// reply
+
+func (s *UdpTestSuite) Test_Reply_ClosesSession_WhenTargetFails() {
+	l := s.newListener("")
+	defer l.stop()
+	closed, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	s.Require().NoError(err)
+	closedAddr := closed.LocalAddr().String()
+	closed.Close()
+	dialUdpOrig := dialUdp
+	defer func() { dialUdp = dialUdpOrig }()
+	dialUdp = func(address string) (*net.UDPConn, error) {
+		return dialUdpOrig(closedAddr)
+	}
+	session, err := l.getSession(&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000})
+	s.Require().NoError(err)
+
+	// The target is not listening so reading the reply fails with "connection refused"
+	session.conn.Write([]byte("ping"))
+	for i := 0; i < 100 && l.getStats().CurrentSessions > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.Equal(0, l.getStats().CurrentSessions)
+	_, err = session.conn.Write([]byte("ping"))
+	s.Error(err)
+}
+
+// Util
+
+func (s *UdpTestSuite) newListener(balance string) *udpListener {
+	LookupHost = func(host string) (addrs []string, err error) {
+		return []string{"127.0.0.2", "127.0.0.1"}, nil
+	}
+	l, err := startUdpListener(udpConfig{ServiceName: "my-service", Port: s.echoPort, SrcPort: 53, Balance: balance, Timeout: 30 * time.Second})
+	s.Require().NoError(err)
+	return l
+}
+
+func (s *UdpTestSuite) dialListener(srcPort int) *net.UDPConn {
+	addr := udpBalancerInstance.listeners[srcPort].conn.LocalAddr().(*net.UDPAddr)
+	client, err := net.DialUDP("udp", nil, addr)
+	s.Require().NoError(err)
+	return client
+}
+
+func (s *UdpTestSuite) sendAndReceive(client *net.UDPConn, msg string) string {
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err := client.Write([]byte(msg))
+	s.Require().NoError(err)
+	buf := make([]byte, 1024)
+	n, err := client.Read(buf)
+	s.Require().NoError(err)
+	return string(buf[:n])
+}
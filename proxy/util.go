@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -11,6 +12,7 @@ import (
 	"os"
 	"os/exec"
 	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -46,7 +48,7 @@ var cmdRunHa = func(args []string) error {
 	if exitError, ok := err.(*exec.ExitError); ok {
 		waitStatus := exitError.Sys().(syscall.WaitStatus)
 		fmt.Printf("Exit Status: %s\n", []byte(fmt.Sprintf("%d", waitStatus.ExitStatus())))
-		return fmt.Errorf(combinedOut)
+		return errors.New(combinedOut)
 	}
 
 	if errStr != "" {
@@ -114,14 +116,62 @@ var lowerFirst = func(s string) string {
 	return string(append([]rune{unicode.ToLower([]rune(s)[0])}, []rune(s)[1:]...))
 }
 
+var haProxyVersionRegexp = regexp.MustCompile(`^(\d+)\.(\d+)`)
+
+// isHaProxyVersionAtLeast returns true if the HAProxy version is the same or newer than major.minor.
+// The version is taken from `HAPROXY_VERSION` set by the HAProxy image.
+// Any version is considered supported if the variable is not set or cannot be parsed.
+func isHaProxyVersionAtLeast(major, minor int) bool {
+	matches := haProxyVersionRegexp.FindStringSubmatch(os.Getenv("HAPROXY_VERSION"))
+	if len(matches) == 0 {
+		return true
+	}
+	actualMajor, _ := strconv.Atoi(matches[1])
+	actualMinor, _ := strconv.Atoi(matches[2])
+	return actualMajor > major || (actualMajor == major && actualMinor >= minor)
+}
+
 // IsValidReconf validates whether reconfigure data is valid
 func IsValidReconf(service *Service) (statusCode int, msg string) {
 	reqMode := "http"
 	if len(service.ServiceName) == 0 {
 		return http.StatusBadRequest, "serviceName parameter is mandatory."
+	} else if !IsValidPathName(service.ServiceName) || !IsValidPathName(service.AclName) {
+		return http.StatusBadRequest, "serviceName and aclName parameters cannot contain / or .."
 	} else if len(service.ServiceDest[0].ReqMode) > 0 {
 		reqMode = service.ServiceDest[0].ReqMode
 	}
+	for _, sd := range service.ServiceDest {
+		if len(sd.SendProxy) > 0 && sd.SendProxy != "v1" && sd.SendProxy != "v2" {
+			return http.StatusBadRequest, "sendProxy parameter must be v1 or v2."
+		}
+		if sd.TerminateSsl && !strings.EqualFold(sd.ReqMode, "tcp") {
+			return http.StatusBadRequest, "terminateSsl parameter can be used only with reqMode tcp."
+		}
+		if sd.TerminateSsl {
+			if err := validateTcpSsl(sd); err != nil {
+				return http.StatusBadRequest, err.Error()
+			}
+		}
+		if _, err := strconv.Atoi(sd.InspectDelay); len(sd.InspectDelay) > 0 && err != nil {
+			return http.StatusBadRequest, "inspectDelay parameter must be a number of seconds."
+		}
+		if sd.ReqMode == "udp" && len(sd.BalanceGroup) > 0 && sd.BalanceGroup != "roundrobin" && sd.BalanceGroup != "source" {
+			return http.StatusBadRequest, "When using reqMode udp, balanceGroup must be roundrobin or source."
+		}
+		if sd.ReqMode == "grpc" && sd.GrpcHealthCheck && !isHaProxyVersionAtLeast(2, 2) {
+			return http.StatusBadRequest, "grpcHealthCheck parameter requires HAProxy 2.2 or newer."
+		}
+		if sd.ReqMode == "grpc" && !isHaProxyVersionAtLeast(2, 0) {
+			return http.StatusBadRequest, "reqMode grpc requires HAProxy 2.0 or newer."
+		}
+		if sd.BackendProto == "h2" && !isHaProxyVersionAtLeast(2, 0) {
+			return http.StatusBadRequest, "backendProto h2 requires HAProxy 2.0 or newer."
+		}
+	}
+	if msg := getUdpSrcPortError(service); len(msg) > 0 {
+		return http.StatusBadRequest, msg
+	}
 	hasPath := len(service.ServiceDest[0].ServicePath) > 0
 	hasSrcPort := service.ServiceDest[0].SrcPort > 0
 	hasPort := len(service.ServiceDest[0].Port) > 0
@@ -131,6 +181,15 @@ func IsValidReconf(service *Service) (statusCode int, msg string) {
 		if !hasPath && !hasDomain {
 			return http.StatusConflict, "When using reqMode http, servicePath or serviceDomain are mandatory"
 		}
+	} else if strings.EqualFold(reqMode, "grpc") {
+		if !hasPath {
+			return http.StatusConflict, "When using reqMode grpc, servicePath is mandatory"
+		}
+		for _, path := range service.ServiceDest[0].ServicePath {
+			if !strings.HasPrefix(path, "/") {
+				return http.StatusBadRequest, "When using reqMode grpc, servicePath must contain gRPC service or method paths (e.g. /helloworld.Greeter/)"
+			}
+		}
 	} else if !hasSrcPort || !hasPort {
 		return http.StatusBadRequest, "When NOT using reqMode http (e.g. tcp), srcPort and port parameters are mandatory."
 	}
@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"net/http"
 	"os"
 	"testing"
 	"time"
@@ -76,3 +77,322 @@ L:
 
 	s.Equal(2, readPidFileCalledCnt)
 }
+
+// isHaProxyVersionAtLeast
+
+func (s *UtilTestSuite) Test_IsHaProxyVersionAtLeast_ComparesHaProxyVersion() {
+	haProxyVersionOrig := os.Getenv("HAPROXY_VERSION")
+	defer func() { os.Setenv("HAPROXY_VERSION", haProxyVersionOrig) }()
+
+	os.Setenv("HAPROXY_VERSION", "1.8.13")
+	s.False(isHaProxyVersionAtLeast(2, 0))
+	os.Setenv("HAPROXY_VERSION", "2.2.33")
+	s.True(isHaProxyVersionAtLeast(2, 0))
+	s.True(isHaProxyVersionAtLeast(2, 2))
+	s.False(isHaProxyVersionAtLeast(2, 6))
+	os.Setenv("HAPROXY_VERSION", "3.0-dev1")
+	s.True(isHaProxyVersionAtLeast(2, 6))
+	os.Unsetenv("HAPROXY_VERSION")
+	s.True(isHaProxyVersionAtLeast(2, 6))
+}
+
+// IsValidReconf
+
+func (s *UtilTestSuite) Test_IsValidReconf_ReturnsOK_WhenGrpcServiceHasServicePath() {
+	service := Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{{ReqMode: "grpc", Port: "50051", ServicePath: []string{"/helloworld.Greeter/"}}},
+	}
+
+	actual, _ := IsValidReconf(&service)
+
+	s.Equal(http.StatusOK, actual)
+}
+
+func (s *UtilTestSuite) Test_IsValidReconf_ReturnsConflict_WhenGrpcServiceDoesNotHaveServicePath() {
+	service := Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{{ReqMode: "grpc", Port: "50051", ServiceDomain: []string{"my-domain.com"}}},
+	}
+
+	actual, msg := IsValidReconf(&service)
+
+	s.Equal(http.StatusConflict, actual)
+	s.Equal("When using reqMode grpc, servicePath is mandatory", msg)
+}
+
+func (s *UtilTestSuite) Test_IsValidReconf_ReturnsBadRequest_WhenGrpcServicePathIsNotAbsolute() {
+	service := Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{{ReqMode: "grpc", Port: "50051", ServicePath: []string{"helloworld.Greeter"}}},
+	}
+
+	actual, _ := IsValidReconf(&service)
+
+	s.Equal(http.StatusBadRequest, actual)
+}
+
+func (s *UtilTestSuite) Test_IsValidReconf_ReturnsBadRequest_WhenHaProxyDoesNotSupportHttp2Backends() {
+	haProxyVersionOrig := os.Getenv("HAPROXY_VERSION")
+	defer func() { os.Setenv("HAPROXY_VERSION", haProxyVersionOrig) }()
+	os.Setenv("HAPROXY_VERSION", "1.8.13")
+	services := []Service{
+		{ServiceName: "my-service", ServiceDest: []ServiceDest{{ReqMode: "grpc", Port: "50051", ServicePath: []string{"/helloworld.Greeter/"}}}},
+		{ServiceName: "my-service", ServiceDest: []ServiceDest{{Port: "1111", ServicePath: []string{"/"}, BackendProto: "h2"}}},
+	}
+
+	for _, service := range services {
+		actual, _ := IsValidReconf(&service)
+
+		s.Equal(http.StatusBadRequest, actual)
+	}
+}
+
+func (s *UtilTestSuite) Test_IsValidReconf_ReturnsBadRequest_WhenHaProxyDoesNotSupportGrpcHealthChecks() {
+	haProxyVersionOrig := os.Getenv("HAPROXY_VERSION")
+	defer func() { os.Setenv("HAPROXY_VERSION", haProxyVersionOrig) }()
+	os.Setenv("HAPROXY_VERSION", "2.0.33")
+	service := Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{{ReqMode: "grpc", Port: "50051", ServicePath: []string{"/helloworld.Greeter/"}, GrpcHealthCheck: true}},
+	}
+
+	actual, msg := IsValidReconf(&service)
+
+	s.Equal(http.StatusBadRequest, actual)
+	s.Equal("grpcHealthCheck parameter requires HAProxy 2.2 or newer.", msg)
+	service.ServiceDest[0].GrpcHealthCheck = false
+	actual, _ = IsValidReconf(&service)
+	s.Equal(http.StatusOK, actual)
+}
+
+func (s *UtilTestSuite) Test_IsValidReconf_ReturnsBadRequest_WhenSendProxyIsInvalid() {
+	service := Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{{Port: "1111", ServicePath: []string{"/"}, SendProxy: "v3"}},
+	}
+
+	actual, msg := IsValidReconf(&service)
+
+	s.Equal(http.StatusBadRequest, actual)
+	s.Equal("sendProxy parameter must be v1 or v2.", msg)
+}
+
+func (s *UtilTestSuite) Test_IsValidReconf_ReturnsBadRequest_WhenAclNameContainsPathSeparators() {
+	service := Service{
+		ServiceName: "my-service",
+		AclName:     "../../..",
+		ServiceDest: []ServiceDest{{Port: "1111", ServicePath: []string{"/"}}},
+	}
+
+	actual, msg := IsValidReconf(&service)
+
+	s.Equal(http.StatusBadRequest, actual)
+	s.Equal("serviceName and aclName parameters cannot contain / or ..", msg)
+}
+
+func (s *UtilTestSuite) Test_IsValidReconf_ReturnsBadRequest_WhenTerminateSslIsUsedWithoutTcpMode() {
+	service := Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{{Port: "1111", ServicePath: []string{"/"}, ReqMode: "http", TerminateSsl: true}},
+	}
+
+	actual, msg := IsValidReconf(&service)
+
+	s.Equal(http.StatusBadRequest, actual)
+	s.Equal("terminateSsl parameter can be used only with reqMode tcp.", msg)
+}
+
+func (s *UtilTestSuite) Test_IsValidReconf_ReturnsBadRequest_WhenTcpCertificateDoesNotExist() {
+	readDirOrig := readDir
+	defer func() { readDir = readDirOrig }()
+	readDir = func(dir string) ([]os.FileInfo, error) {
+		return []os.FileInfo{}, nil
+	}
+	service := Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{{Port: "4321", SrcPort: 1234, ReqMode: "tcp", TerminateSsl: true, SslCert: []string{"my-cert"}}},
+	}
+
+	actual, msg := IsValidReconf(&service)
+
+	s.Equal(http.StatusBadRequest, actual)
+	s.Equal("Certificate my-cert used by port 1234 does not exist", msg)
+}
+
+func (s *UtilTestSuite) Test_IsValidReconf_ReturnsBadRequest_WhenTcpTerminatesSslWithoutCertificates() {
+	readDirOrig := readDir
+	defer func() { readDir = readDirOrig }()
+	readDir = func(dir string) ([]os.FileInfo, error) {
+		return []os.FileInfo{}, nil
+	}
+	service := Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{{Port: "4321", SrcPort: 1234, ReqMode: "tcp", TerminateSsl: true}},
+	}
+
+	actual, msg := IsValidReconf(&service)
+
+	s.Equal(http.StatusBadRequest, actual)
+	s.Equal("Port 1234 terminates SSL but there are no certificates", msg)
+}
+
+func (s *UtilTestSuite) Test_IsValidReconf_ReturnsBadRequest_WhenTcpVerifiesClientSslWithoutCaFile() {
+	readDirOrig := readDir
+	caFileOrig := os.Getenv("CA_FILE")
+	defer func() {
+		readDir = readDirOrig
+		os.Setenv("CA_FILE", caFileOrig)
+	}()
+	os.Unsetenv("CA_FILE")
+	readDir = func(dir string) ([]os.FileInfo, error) {
+		if dir == "/certs" {
+			return []os.FileInfo{
+				FileInfoMock{
+					NameMock:  func() string { return "my-cert" },
+					IsDirMock: func() bool { return false },
+				},
+			}, nil
+		}
+		return []os.FileInfo{}, nil
+	}
+	service := Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{{Port: "4321", SrcPort: 1234, ReqMode: "tcp", TerminateSsl: true, SslCert: []string{"my-cert"}, VerifyClientSsl: true}},
+	}
+
+	actual, msg := IsValidReconf(&service)
+
+	s.Equal(http.StatusBadRequest, actual)
+	s.Equal("Port 1234 verifies client certificates but CA_FILE is not set", msg)
+}
+
+func (s *UtilTestSuite) Test_IsValidReconf_ReturnsOk_WhenTcpCertificateExists() {
+	readDirOrig := readDir
+	defer func() { readDir = readDirOrig }()
+	readDir = func(dir string) ([]os.FileInfo, error) {
+		if dir == "/certs" {
+			return []os.FileInfo{
+				FileInfoMock{
+					NameMock:  func() string { return "my-cert" },
+					IsDirMock: func() bool { return false },
+				},
+			}, nil
+		}
+		return []os.FileInfo{}, nil
+	}
+	service := Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{{Port: "4321", SrcPort: 1234, ReqMode: "tcp", TerminateSsl: true, SslCert: []string{"my-cert"}}},
+	}
+
+	actual, _ := IsValidReconf(&service)
+
+	s.Equal(http.StatusOK, actual)
+}
+
+func (s *UtilTestSuite) Test_IsValidReconf_ReturnsBadRequest_WhenUdpBalanceIsInvalid() {
+	service := Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{{Port: "53", SrcPort: 53, ReqMode: "udp", BalanceGroup: "leastconn"}},
+	}
+
+	actual, msg := IsValidReconf(&service)
+
+	s.Equal(http.StatusBadRequest, actual)
+	s.Equal("When using reqMode udp, balanceGroup must be roundrobin or source.", msg)
+}
+
+func (s *UtilTestSuite) Test_IsValidReconf_ReturnsOk_WhenUdpHasSrcPortAndPort() {
+	service := Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{{Port: "53", SrcPort: 53, ReqMode: "udp", BalanceGroup: "source"}},
+	}
+
+	actual, _ := IsValidReconf(&service)
+
+	s.Equal(http.StatusOK, actual)
+}
+
+func (s *UtilTestSuite) Test_IsValidReconf_ReturnsBadRequest_WhenUdpSrcPortIsNotSet() {
+	service := Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{
+			{Port: "53", SrcPort: 53, ReqMode: "udp"},
+			{Port: "514", ReqMode: "udp"},
+		},
+	}
+
+	actual, msg := IsValidReconf(&service)
+
+	s.Equal(http.StatusBadRequest, actual)
+	s.Equal("When using reqMode udp, srcPort parameter is mandatory.", msg)
+}
+
+func (s *UtilTestSuite) Test_IsValidReconf_ReturnsBadRequest_WhenUdpSrcPortIsUsedTwice() {
+	service := Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{
+			{Port: "53", SrcPort: 53, ReqMode: "udp"},
+			{Port: "54", SrcPort: 53, ReqMode: "udp"},
+		},
+	}
+
+	actual, msg := IsValidReconf(&service)
+
+	s.Equal(http.StatusBadRequest, actual)
+	s.Equal("UDP port 53 is already used by the service my-service.", msg)
+}
+
+func (s *UtilTestSuite) Test_IsValidReconf_ReturnsBadRequest_WhenUdpSrcPortIsUsedByAnotherService() {
+	instanceOrig := Instance
+	defer func() { Instance = instanceOrig }()
+	p := NewHaProxy("", "")
+	p.AddService(Service{
+		ServiceName: "other-service",
+		ServiceDest: []ServiceDest{{Port: "53", SrcPort: 53, ReqMode: "udp"}},
+	})
+	defer p.RemoveService("other-service")
+	Instance = p
+	service := Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{{Port: "53", SrcPort: 53, ReqMode: "udp"}},
+	}
+
+	actual, msg := IsValidReconf(&service)
+
+	s.Equal(http.StatusBadRequest, actual)
+	s.Equal("UDP port 53 is already used by the service other-service.", msg)
+}
+
+func (s *UtilTestSuite) Test_IsValidReconf_ReturnsOk_WhenUdpSrcPortIsUsedByTheSameService() {
+	instanceOrig := Instance
+	defer func() { Instance = instanceOrig }()
+	p := NewHaProxy("", "")
+	p.AddService(Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{{Port: "53", SrcPort: 53, ReqMode: "udp"}},
+	})
+	defer p.RemoveService("my-service")
+	Instance = p
+	service := Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{{Port: "5353", SrcPort: 53, ReqMode: "udp"}},
+	}
+
+	actual, _ := IsValidReconf(&service)
+
+	s.Equal(http.StatusOK, actual)
+}
+
+func (s *UtilTestSuite) Test_IsValidReconf_ReturnsBadRequest_WhenInspectDelayIsNotANumber() {
+	service := Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{{Port: "1111", SrcPort: 443, ReqMode: "sni", InspectDelay: "5s"}},
+	}
+
+	actual, msg := IsValidReconf(&service)
+
+	s.Equal(http.StatusBadRequest, actual)
+	s.Equal("inspectDelay parameter must be a number of seconds.", msg)
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker-flow/docker-flow-proxy/metrics"
@@ -23,9 +24,13 @@ type Server interface {
 }
 
 type serve struct {
+	ConsulAddress        string   `long:"consul-address" env:"CONSUL_ADDRESS" description:"The address of the Consul HTTP API. If set, the proxy is configured from services registered in the Consul catalog."`
+	DockerEngineAddress  string   `long:"docker-engine-address" env:"DOCKER_ENGINE_ADDRESS" description:"The address of the Docker Engine API (e.g. unix:///var/run/docker.sock). If set, the proxy is configured from Swarm services without Docker Flow Swarm Listener."`
 	IP                   string   `short:"i" long:"ip" default:"0.0.0.0" env:"IP" description:"IP the server listens to."`
+	KubernetesAddress    string   `long:"kubernetes-address" env:"KUBERNETES_ADDRESS" description:"The address of the Kubernetes API. If set, the proxy is configured from Kubernetes Ingress objects."`
 	ListenerAddresses    []string `short:"l" long:"listener-address" env:"LISTENER_ADDRESS" env-delim:"," description:"The address of the Docker Flow: Swarm Listener. The address matches the name of the Swarm service (e.g. swarm-listener)" default:""`
 	Port                 string   `short:"p" long:"port" default:"8080" env:"PORT" description:"Port the server listens to."`
+	ServicesConfigPath   string   `long:"services-config-path" env:"SERVICES_CONFIG_PATH" description:"The path to a YAML or JSON file, or a directory with such files, that defines services."`
 	ServiceName          string   `short:"n" long:"service-name" default:"proxy" env:"SERVICE_NAME" description:"The name of the proxy service. It is used only when running in 'swarm' mode and must match the '--name' parameter used to launch the service."`
 	SuccessfulInitReload bool
 	// TODO: Remove
@@ -35,7 +40,9 @@ type serve struct {
 var serverImpl = serve{
 	ListenerAddresses: []string{},
 }
+var successfulInitReloadMu = &sync.Mutex{}
 var cert server.Certer = server.NewCert("/certs")
+var errorPage = server.NewErrorPage(proxy.ErrorPagesDir)
 
 // Execute runs the Web server.
 // Args are not used and are present only for compatibility reasons. Define them as an empty slice.
@@ -47,6 +54,11 @@ func (m *serve) Execute(args []string) error {
 	newRun().Execute([]string{})
 	address := fmt.Sprintf("%s:%s", m.IP, m.Port)
 	cert.Init()
+	errorPage.Init()
+	templates := server.NewTemplates(proxy.ServiceTemplatesDir, m.BaseReconfigure)
+	templates.Init()
+	maintenance := server.NewMaintenance(m.BaseReconfigure)
+	maintenance.Init()
 	var server2 = server.NewServer(
 		m.ListenerAddresses,
 		m.Port,
@@ -57,6 +69,7 @@ func (m *serve) Execute(args []string) error {
 	)
 	config := server.NewConfig()
 	sm := server.NewMetrics("")
+	status := server.NewStatus()
 	if err := m.reconfigure(server2); err != nil {
 		return err
 	}
@@ -66,22 +79,48 @@ func (m *serve) Execute(args []string) error {
 	r.HandleFunc("/v1/docker-flow-proxy/cert", m.certPutHandler).Methods("PUT")
 	r.HandleFunc("/v1/docker-flow-proxy/certs", m.certsHandler)
 	r.HandleFunc("/v1/docker-flow-proxy/config", config.Get)
+	r.HandleFunc("/v1/docker-flow-proxy/errorpage", errorPage.Put).Methods("PUT")
+	r.HandleFunc("/v1/docker-flow-proxy/errorpages", errorPage.GetAll)
+	r.HandleFunc("/v1/docker-flow-proxy/maintenance", server2.MaintenanceHandler)
+	r.HandleFunc("/v1/docker-flow-proxy/maintenances", maintenance.GetAll)
 	r.HandleFunc("/v1/docker-flow-proxy/metrics", sm.Get)
-	r.Handle("/metrics", prometheus.Handler())
+	r.Handle("/metrics", metrics.NewClusterHandler(m.ServiceName, m.Port, prometheus.Handler()))
 	r.HandleFunc("/v1/docker-flow-proxy/ping", server2.PingHandler)
 	r.HandleFunc("/v1/docker-flow-proxy/reconfigure", server2.ReconfigureHandler)
 	r.HandleFunc("/v1/docker-flow-proxy/reload", server2.ReloadHandler)
 	r.HandleFunc("/v1/docker-flow-proxy/remove", server2.RemoveHandler)
+	r.HandleFunc("/v1/docker-flow-proxy/services/{name}/status", status.Get).Methods("GET")
 	r.HandleFunc("/v1/docker-flow-proxy/successfulinitreload", m.SuccessfulInitReloadHandler)
+	r.HandleFunc("/v1/docker-flow-proxy/template", templates.Put).Methods("PUT")
+	r.HandleFunc("/v1/docker-flow-proxy/templates", templates.GetAll)
+	r.HandleFunc("/v1/docker-flow-proxy/templates/validate", templates.Validate)
 	r.HandleFunc("/v1/test", server2.Test1Handler)
 	r.HandleFunc("/v2/test", server2.Test2Handler)
 	return httpListenAndServe(address, r)
 }
 
 func (m *serve) reconfigure(server server.Server) error {
-	fetch := actions.NewFetch(m.BaseReconfigure)
+	fetch := actions.NewFetch(m.BaseReconfigure, m.ListenerAddresses)
+	subscribe := strings.EqualFold(os.Getenv("LISTENER_SUBSCRIBE"), "true")
 
-	if len(m.ListenerAddresses) == 1 && len(m.ListenerAddresses[0]) > 0 {
+	if subscribe {
+		lAddrs := []string{}
+		for _, addr := range m.ListenerAddresses {
+			if len(addr) > 0 {
+				lAddrs = append(lAddrs, fmt.Sprintf("http://%s:8080", addr))
+			}
+		}
+		if len(lAddrs) > 0 {
+			go func() {
+				onSync := func() { m.setSuccessfulInitReload() }
+				if err := fetch.SubscribeConfig(m.BaseReconfigure, lAddrs, onSync, nil); err != nil {
+					logPrintf("Error: Subscription to swarm listener failed: %s", err.Error())
+				}
+			}()
+		}
+	}
+
+	if !subscribe && len(m.ListenerAddresses) == 1 && len(m.ListenerAddresses[0]) > 0 {
 		lAddr := fmt.Sprintf("http://%s:8080", m.ListenerAddresses[0])
 		go func() {
 			retryInterval := os.Getenv("RELOAD_INTERVAL")
@@ -95,7 +134,7 @@ func (m *serve) reconfigure(server server.Server) error {
 						interval/time.Second,
 					)
 				} else {
-					m.SuccessfulInitReload = true
+					m.setSuccessfulInitReload()
 					if !repeatReload {
 						break
 					}
@@ -106,7 +145,7 @@ func (m *serve) reconfigure(server server.Server) error {
 	}
 
 	// Handlers Listener Addresses
-	if len(m.ListenerAddresses) > 1 {
+	if !subscribe && len(m.ListenerAddresses) > 1 {
 		reloadAttemptsStr := os.Getenv("RELOAD_ATTEMPTS")
 		retryInterval := os.Getenv("RELOAD_INTERVAL")
 		interval, _ := time.ParseDuration(retryInterval + "ms")
@@ -128,7 +167,7 @@ func (m *serve) reconfigure(server server.Server) error {
 							interval/time.Second,
 						)
 					} else {
-						m.SuccessfulInitReload = true
+						m.setSuccessfulInitReload()
 						break
 					}
 					reloadAttempts = reloadAttempts - 1
@@ -140,12 +179,50 @@ func (m *serve) reconfigure(server server.Server) error {
 		}
 	}
 
+	if len(m.KubernetesAddress) > 0 {
+		kubernetes := actions.NewKubernetes(m.BaseReconfigure, m.KubernetesAddress)
+		go func() {
+			if err := kubernetes.Run(nil); err != nil {
+				logPrintf("Error: Kubernetes discovery failed: %s", err.Error())
+			}
+		}()
+	}
+
+	if len(m.ConsulAddress) > 0 {
+		consul := actions.NewConsul(m.BaseReconfigure, m.ConsulAddress)
+		go func() {
+			if err := consul.Run(nil); err != nil {
+				logPrintf("Error: Consul discovery failed: %s", err.Error())
+			}
+		}()
+	}
+
+	if len(m.DockerEngineAddress) > 0 {
+		docker := actions.NewDocker(m.BaseReconfigure, m.DockerEngineAddress)
+		go func() {
+			if err := docker.Run(nil); err != nil {
+				logPrintf("Error: Docker discovery failed: %s", err.Error())
+			}
+		}()
+	}
+
+	if len(m.ServicesConfigPath) > 0 {
+		file := actions.NewFile(m.BaseReconfigure, m.ServicesConfigPath)
+		go func() {
+			if err := file.Run(nil); err != nil {
+				logPrintf("Error: Watching services config failed: %s", err.Error())
+			}
+		}()
+	}
+
 	services := server.GetServicesFromEnvVars()
 
 	for _, service := range *services {
 		recon := actions.NewReconfigure(m.BaseReconfigure, service)
 		//todo: there could be only one reload after this whole loop
-		recon.Execute(true)
+		if err := recon.Execute(true); err != nil {
+			logPrintf("Error: Reconfiguring %s failed: %s", service.ServiceName, err.Error())
+		}
 	}
 	return nil
 }
@@ -153,13 +230,24 @@ func (m *serve) reconfigure(server server.Server) error {
 // SuccessfulInitReloadHandler responses with StatusOK when is SuccessfulInitReload otherwise
 // it response with StatusInternalServerError
 func (m *serve) SuccessfulInitReloadHandler(w http.ResponseWriter, req *http.Request) {
-	if !m.SuccessfulInitReload {
+	successfulInitReloadMu.Lock()
+	successful := m.SuccessfulInitReload
+	successfulInitReloadMu.Unlock()
+	if !successful {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
 
+// setSuccessfulInitReload marks the initial reload as successful.
+// It can be invoked concurrently by the goroutines that fetch services from listeners.
+func (m *serve) setSuccessfulInitReload() {
+	successfulInitReloadMu.Lock()
+	defer successfulInitReloadMu.Unlock()
+	m.SuccessfulInitReload = true
+}
+
 // TODO: Move to server package
 func (m *serve) certPutHandler(w http.ResponseWriter, req *http.Request) {
 	cert.Put(w, req)
@@ -2,6 +2,7 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -89,7 +90,10 @@ func (m *cert) Put(w http.ResponseWriter, req *http.Request) (string, error) {
 		return "", err
 	}
 
-	proxy.Instance.CreateConfigFromTemplates()
+	if err := proxy.Instance.CreateConfigFromTemplates(); err != nil {
+		m.writeError(w, err)
+		return "", err
+	}
 	proxy.Instance.Reload()
 
 	msg := CertResponse{Status: "OK", Message: ""}
@@ -139,7 +143,9 @@ func (m *cert) Init() error {
 		for _, cert := range certs {
 			m.writeFile(cert.ProxyServiceName, []byte(cert.CertContent))
 		}
-		proxy.Instance.CreateConfigFromTemplates()
+		if err := proxy.Instance.CreateConfigFromTemplates(); err != nil {
+			return err
+		}
 		proxy.Instance.Reload()
 	}
 	return nil
@@ -172,7 +178,7 @@ func (m *cert) sendDistributeRequests(w http.ResponseWriter, req *http.Request)
 		return m.writeError(w, err)
 	} else if status >= 300 {
 		msg := fmt.Sprintf("Distribution request failed with status %d", status)
-		return m.writeError(w, fmt.Errorf(msg))
+		return m.writeError(w, errors.New(msg))
 	}
 	return nil
 }
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/docker-flow/docker-flow-proxy/proxy"
+)
+
+var readErrorPageFile = ioutil.ReadFile
+var writeErrorPageFile = ioutil.WriteFile
+
+// ErrorPager defines the interface that must be implemented by any struct that deals with global error pages.
+type ErrorPager interface {
+	Put(w http.ResponseWriter, req *http.Request)
+	GetAll(w http.ResponseWriter, req *http.Request)
+	Init() error
+}
+
+type errorPage struct {
+	ServicePort      string
+	ProxyServiceName string
+	Dir              string
+}
+
+// ErrorPage contains a global error page
+type ErrorPage struct {
+	Code    int
+	Content string
+}
+
+// ErrorPageResponse represent a response when a request for error pages is made.
+type ErrorPageResponse struct {
+	Status     string
+	Message    string
+	ErrorPages []ErrorPage
+}
+
+// NewErrorPage returns an instance of the ErrorPager interface with pre-populated variables.
+var NewErrorPage = func(dir string) ErrorPager {
+	return &errorPage{
+		Dir:              dir,
+		ProxyServiceName: os.Getenv("SERVICE_NAME"),
+		ServicePort:      "8080",
+	}
+}
+
+// GetAll returns all the global error pages used by the proxy.
+func (m *errorPage) GetAll(w http.ResponseWriter, req *http.Request) {
+	m.writeResponse(w, http.StatusOK, ErrorPageResponse{Status: "OK", ErrorPages: m.getAll()})
+}
+
+// Put replaces the global error page of the status code specified through the `code` query parameter.
+// The body of the request is the content of the page.
+// If the `distribute` query parameter is set to `true`, the request is sent to all the replicas of the proxy.
+func (m *errorPage) Put(w http.ResponseWriter, req *http.Request) {
+	distribute, _ := strconv.ParseBool(req.URL.Query().Get("distribute"))
+	if distribute {
+		_, port, err := net.SplitHostPort(req.URL.Host)
+		if err != nil {
+			port = m.ServicePort
+		}
+		status, err := sendDistributeRequests(req, port, m.ProxyServiceName)
+		if err == nil && status >= 300 {
+			err = fmt.Errorf("Distribution request failed with status %d", status)
+		}
+		if err != nil {
+			m.writeResponse(w, http.StatusBadRequest, ErrorPageResponse{Status: "NOK", Message: err.Error()})
+			return
+		}
+		m.writeResponse(w, http.StatusOK, ErrorPageResponse{Status: "OK", Message: distributed})
+		return
+	}
+	code, err := strconv.Atoi(req.URL.Query().Get("code"))
+	if err != nil || !proxy.IsValidErrorPageCode(code) {
+		msg := fmt.Sprintf("Query parameter code must be one of %v", proxy.ErrorPageCodes)
+		m.writeResponse(w, http.StatusBadRequest, ErrorPageResponse{Status: "NOK", Message: msg})
+		return
+	}
+	defer req.Body.Close()
+	content, err := ioutil.ReadAll(req.Body)
+	if err == nil && len(content) == 0 {
+		err = fmt.Errorf("Body is empty")
+	}
+	if err != nil {
+		m.writeResponse(w, http.StatusBadRequest, ErrorPageResponse{Status: "NOK", Message: err.Error()})
+		return
+	}
+	if err := m.write(code, string(content)); err != nil {
+		m.writeResponse(w, http.StatusInternalServerError, ErrorPageResponse{Status: "NOK", Message: err.Error()})
+		return
+	}
+	if err := proxy.Instance.CreateConfigFromTemplates(); err != nil {
+		m.writeResponse(w, http.StatusInternalServerError, ErrorPageResponse{Status: "NOK", Message: err.Error()})
+		return
+	}
+	if err := proxy.Instance.Reload(); err != nil {
+		m.writeResponse(w, http.StatusInternalServerError, ErrorPageResponse{Status: "NOK", Message: err.Error()})
+		return
+	}
+	m.writeResponse(w, http.StatusOK, ErrorPageResponse{Status: "OK"})
+}
+
+// Init should be executed when the proxy starts.
+// It retrieves global error pages from the other proxy replicas and reloads the proxy if any of them differs from the local one.
+func (m *errorPage) Init() error {
+	dns := fmt.Sprintf("tasks.%s", m.ProxyServiceName)
+	ips, err := lookupHost(dns)
+	if err != nil {
+		return err
+	}
+	local := map[int]string{}
+	for _, page := range m.getAll() {
+		local[page.Code] = page.Content
+	}
+	changed := false
+	client := &http.Client{}
+	for _, ip := range filterNetworkIPs(ips) {
+		hostPort := ip
+		if !strings.Contains(ip, ":") {
+			hostPort = net.JoinHostPort(ip, m.ServicePort)
+		}
+		addr := fmt.Sprintf("http://%s/v1/docker-flow-proxy/errorpages", hostPort)
+		resp, err := client.Get(addr)
+		if err != nil {
+			continue
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		data := ErrorPageResponse{}
+		json.Unmarshal(body, &data)
+		for _, page := range data.ErrorPages {
+			if !proxy.IsValidErrorPageCode(page.Code) || local[page.Code] == page.Content {
+				continue
+			}
+			if err := m.write(page.Code, page.Content); err != nil {
+				return err
+			}
+			local[page.Code] = page.Content
+			changed = true
+		}
+	}
+	if changed {
+		logPrintf("Updated error pages from other replicas")
+		if err := proxy.Instance.CreateConfigFromTemplates(); err != nil {
+			return err
+		}
+		return proxy.Instance.Reload()
+	}
+	return nil
+}
+
+func (m *errorPage) getAll() []ErrorPage {
+	pages := []ErrorPage{}
+	for _, code := range proxy.ErrorPageCodes {
+		if content, err := readErrorPageFile(m.getPath(code)); err == nil {
+			pages = append(pages, ErrorPage{Code: code, Content: string(content)})
+		}
+	}
+	return pages
+}
+
+func (m *errorPage) write(code int, content string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	return writeErrorPageFile(m.getPath(code), []byte(proxy.FormatErrorPage(code, content)), 0664)
+}
+
+func (m *errorPage) getPath(code int) string {
+	return fmt.Sprintf("%s/%d.http", m.Dir, code)
+}
+
+func (m *errorPage) writeResponse(w http.ResponseWriter, status int, resp ErrorPageResponse) {
+	httpWriterSetContentType(w, "application/json")
+	w.WriteHeader(status)
+	js, _ := json.Marshal(resp)
+	w.Write(js)
+}
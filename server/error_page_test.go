@@ -0,0 +1,183 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/docker-flow/docker-flow-proxy/proxy"
+	"github.com/stretchr/testify/suite"
+)
+
+type ErrorPageTestSuite struct {
+	suite.Suite
+	files     map[string]string
+	proxyMock *ProxyMock
+	restore   func()
+}
+
+func TestErrorPageUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	suite.Run(t, new(ErrorPageTestSuite))
+}
+
+func (s *ErrorPageTestSuite) SetupTest() {
+	proxyOrig := proxy.Instance
+	readOrig := readErrorPageFile
+	writeOrig := writeErrorPageFile
+	lookupHostOrig := lookupHost
+	filterOrig := filterNetworkIPs
+	setContentTypeOrig := httpWriterSetContentType
+	s.restore = func() {
+		proxy.Instance = proxyOrig
+		readErrorPageFile = readOrig
+		writeErrorPageFile = writeOrig
+		lookupHost = lookupHostOrig
+		filterNetworkIPs = filterOrig
+		httpWriterSetContentType = setContentTypeOrig
+	}
+	httpWriterSetContentType = func(w http.ResponseWriter, value string) {}
+	s.files = map[string]string{"/errorfiles/503.http": "HTTP/1.0 503 Service Unavailable\n\ndefault"}
+	readErrorPageFile = func(path string) ([]byte, error) {
+		if content, ok := s.files[path]; ok {
+			return []byte(content), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	writeErrorPageFile = func(path string, data []byte, perm os.FileMode) error {
+		s.files[path] = string(data)
+		return nil
+	}
+	filterNetworkIPs = func(ips []string) []string { return ips }
+	s.proxyMock = getProxyMock("")
+	proxy.Instance = s.proxyMock
+}
+
+func (s *ErrorPageTestSuite) TearDownTest() {
+	s.restore()
+}
+
+// GetAll
+
+func (s *ErrorPageTestSuite) Test_GetAll_ReturnsExistingPages() {
+	w := httptest.NewRecorder()
+
+	NewErrorPage("/errorfiles").GetAll(w, httptest.NewRequest("GET", "/v1/docker-flow-proxy/errorpages", nil))
+
+	actual := ErrorPageResponse{}
+	json.Unmarshal(w.Body.Bytes(), &actual)
+	s.Equal(http.StatusOK, w.Code)
+	s.Equal([]ErrorPage{{Code: 503, Content: s.files["/errorfiles/503.http"]}}, actual.ErrorPages)
+}
+
+// Put
+
+func (s *ErrorPageTestSuite) Test_Put_WritesPageAndReloads() {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("PUT", "/v1/docker-flow-proxy/errorpage?code=503", strings.NewReader("<h1>Be right back</h1>"))
+
+	NewErrorPage("/errorfiles").Put(w, req)
+
+	s.Equal(http.StatusOK, w.Code)
+	s.Equal(proxy.FormatErrorPage(503, "<h1>Be right back</h1>"), s.files["/errorfiles/503.http"])
+	s.proxyMock.AssertCalled(s.T(), "CreateConfigFromTemplates")
+	s.proxyMock.AssertCalled(s.T(), "Reload")
+}
+
+func (s *ErrorPageTestSuite) Test_Put_ReturnsBadRequest_WhenCodeIsNotSupported() {
+	for _, code := range []string{"", "404", "abc"} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", "/v1/docker-flow-proxy/errorpage?code="+code, strings.NewReader("content"))
+
+		NewErrorPage("/errorfiles").Put(w, req)
+
+		s.Equal(http.StatusBadRequest, w.Code)
+	}
+	s.proxyMock.AssertNotCalled(s.T(), "Reload")
+}
+
+func (s *ErrorPageTestSuite) Test_Put_ReturnsBadRequest_WhenBodyIsEmpty() {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("PUT", "/v1/docker-flow-proxy/errorpage?code=503", strings.NewReader(""))
+
+	NewErrorPage("/errorfiles").Put(w, req)
+
+	s.Equal(http.StatusBadRequest, w.Code)
+}
+
+func (s *ErrorPageTestSuite) Test_Put_SendsDistributeRequests_WhenDistribute() {
+	var actualPath, actualQuery, actualBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		actualPath = r.URL.Path
+		actualQuery = r.URL.RawQuery
+		actualBody = string(body)
+	}))
+	defer srv.Close()
+	addr, _ := url.Parse(srv.URL)
+	lookupHost = func(host string) ([]string, error) {
+		return []string{addr.Hostname()}, nil
+	}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(
+		"PUT",
+		fmt.Sprintf("%s/v1/docker-flow-proxy/errorpage?code=503&distribute=true", srv.URL),
+		strings.NewReader("content"),
+	)
+
+	NewErrorPage("/errorfiles").Put(w, req)
+
+	s.Equal(http.StatusOK, w.Code)
+	s.Equal("/v1/docker-flow-proxy/errorpage", actualPath)
+	s.Contains(actualQuery, "distribute=false")
+	s.Equal("content", actualBody)
+	s.proxyMock.AssertNotCalled(s.T(), "Reload")
+}
+
+// Init
+
+func (s *ErrorPageTestSuite) Test_Init_CopiesPagesFromReplicas() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		js, _ := json.Marshal(ErrorPageResponse{Status: "OK", ErrorPages: []ErrorPage{
+			{Code: 502, Content: "HTTP/1.0 502 Bad Gateway\n\ncustom"},
+			{Code: 503, Content: s.files["/errorfiles/503.http"]},
+		}})
+		w.Write(js)
+	}))
+	defer srv.Close()
+	addr, _ := url.Parse(srv.URL)
+	lookupHost = func(host string) ([]string, error) {
+		return []string{addr.Host}, nil
+	}
+
+	err := NewErrorPage("/errorfiles").Init()
+
+	s.NoError(err)
+	s.Equal("HTTP/1.0 502 Bad Gateway\n\ncustom", s.files["/errorfiles/502.http"])
+	s.proxyMock.AssertNumberOfCalls(s.T(), "Reload", 1)
+}
+
+func (s *ErrorPageTestSuite) Test_Init_DoesNotReload_WhenPagesAreTheSame() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		js, _ := json.Marshal(ErrorPageResponse{Status: "OK", ErrorPages: []ErrorPage{
+			{Code: 503, Content: s.files["/errorfiles/503.http"]},
+		}})
+		w.Write(js)
+	}))
+	defer srv.Close()
+	addr, _ := url.Parse(srv.URL)
+	lookupHost = func(host string) ([]string, error) {
+		return []string{addr.Host}, nil
+	}
+
+	err := NewErrorPage("/errorfiles").Init()
+
+	s.NoError(err)
+	s.proxyMock.AssertNotCalled(s.T(), "Reload")
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/docker-flow/docker-flow-proxy/actions"
+	"github.com/docker-flow/docker-flow-proxy/proxy"
+)
+
+// Maintainer defines the interface that must be implemented by any struct that shares the maintenance state of services.
+type Maintainer interface {
+	GetAll(w http.ResponseWriter, req *http.Request)
+	Init() error
+}
+
+type maintenance struct {
+	BaseReconfigure  actions.BaseReconfigure
+	ProxyServiceName string
+	ServicePort      string
+}
+
+// MaintenanceResponse represent a response when a request for the maintenance of services is made.
+type MaintenanceResponse struct {
+	Status       string
+	Message      string
+	Maintenances map[string]proxy.Maintenance
+}
+
+// NewMaintenance returns an instance of the Maintainer interface with pre-populated variables.
+// Services that are put into maintenance by Init are reconfigured with `baseData`.
+var NewMaintenance = func(baseData actions.BaseReconfigure) Maintainer {
+	return &maintenance{
+		BaseReconfigure:  baseData,
+		ProxyServiceName: os.Getenv("SERVICE_NAME"),
+		ServicePort:      "8080",
+	}
+}
+
+// GetAll returns the maintenance of all the services that are in maintenance.
+func (m *maintenance) GetAll(w http.ResponseWriter, req *http.Request) {
+	js, _ := json.Marshal(MaintenanceResponse{Status: "OK", Maintenances: proxy.GetMaintenances()})
+	httpWriterSetContentType(w, "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(js)
+}
+
+// Init should be executed when the proxy starts.
+// It retrieves the maintenance of services from the other proxy replicas and reconfigures the services whose maintenance changed.
+func (m *maintenance) Init() error {
+	dns := fmt.Sprintf("tasks.%s", m.ProxyServiceName)
+	ips, err := lookupHost(dns)
+	if err != nil {
+		return err
+	}
+	local := proxy.GetMaintenances()
+	changed := map[string]bool{}
+	client := &http.Client{}
+	for _, ip := range filterNetworkIPs(ips) {
+		hostPort := ip
+		if !strings.Contains(ip, ":") {
+			hostPort = net.JoinHostPort(ip, m.ServicePort)
+		}
+		addr := fmt.Sprintf("http://%s/v1/docker-flow-proxy/maintenances", hostPort)
+		resp, err := client.Get(addr)
+		if err != nil {
+			continue
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		data := MaintenanceResponse{}
+		json.Unmarshal(body, &data)
+		for name, maintenance := range data.Maintenances {
+			if current, ok := local[name]; ok && reflect.DeepEqual(current, maintenance) {
+				continue
+			}
+			maintenance := maintenance
+			proxy.SetMaintenance(name, &maintenance)
+			local[name] = maintenance
+			changed[name] = true
+		}
+	}
+	if len(changed) > 0 {
+		logPrintf("Updated the maintenance of services from other replicas")
+		return m.reconfigureServices(changed)
+	}
+	return nil
+}
+
+// reconfigureServices reconfigures the services that are already configured and reloads the proxy.
+// Services that are not configured yet pick up the maintenance when they are.
+func (m *maintenance) reconfigureServices(names map[string]bool) error {
+	reconfigured := false
+	for name, service := range proxy.Instance.GetServices() {
+		if !names[name] {
+			continue
+		}
+		if err := actions.NewReconfigure(m.BaseReconfigure, service).Execute(false); err != nil {
+			return err
+		}
+		reconfigured = true
+	}
+	if reconfigured {
+		return actions.NewReload().Execute(true)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/docker-flow/docker-flow-proxy/actions"
+	"github.com/docker-flow/docker-flow-proxy/proxy"
+	"github.com/stretchr/testify/suite"
+)
+
+type MaintenanceTestSuite struct {
+	suite.Suite
+	proxyMock    *ProxyMock
+	reconfigured []string
+	reloaded     bool
+	restore      func()
+}
+
+func TestMaintenanceUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	suite.Run(t, new(MaintenanceTestSuite))
+}
+
+func (s *MaintenanceTestSuite) SetupTest() {
+	setContentTypeOrig := httpWriterSetContentType
+	proxyOrig := proxy.Instance
+	lookupHostOrig := lookupHost
+	filterOrig := filterNetworkIPs
+	newReconfigureOrig := actions.NewReconfigure
+	restoreReload := MockReload(ReloadMock{ExecuteMock: func(recreate bool) error {
+		s.reloaded = true
+		return nil
+	}})
+	s.restore = func() {
+		httpWriterSetContentType = setContentTypeOrig
+		proxy.Instance = proxyOrig
+		lookupHost = lookupHostOrig
+		filterNetworkIPs = filterOrig
+		actions.NewReconfigure = newReconfigureOrig
+		restoreReload()
+		for name := range proxy.GetMaintenances() {
+			proxy.SetMaintenance(name, nil)
+		}
+	}
+	httpWriterSetContentType = func(w http.ResponseWriter, value string) {}
+	filterNetworkIPs = func(ips []string) []string { return ips }
+	s.reconfigured = []string{}
+	s.reloaded = false
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service) actions.Reconfigurable {
+		return ReconfigureMock{
+			ExecuteMock: func(reloadAfter bool) error {
+				s.reconfigured = append(s.reconfigured, serviceData.ServiceName)
+				return nil
+			},
+		}
+	}
+	s.proxyMock = getProxyMock("GetServices")
+	s.proxyMock.On("GetServices").Return(map[string]proxy.Service{
+		"service-1": {ServiceName: "service-1"},
+		"service-2": {ServiceName: "service-2"},
+	})
+	proxy.Instance = s.proxyMock
+}
+
+func (s *MaintenanceTestSuite) TearDownTest() {
+	s.restore()
+}
+
+// GetAll
+
+func (s *MaintenanceTestSuite) Test_GetAll_ReturnsMaintenanceOfAllServices() {
+	proxy.SetMaintenance("service-1", &proxy.Maintenance{AllowedIPs: []string{"10.0.0.0/8"}, Body: "Be back soon"})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/v1/docker-flow-proxy/maintenances", nil)
+
+	NewMaintenance(actions.BaseReconfigure{}).GetAll(w, req)
+
+	actual := MaintenanceResponse{}
+	json.Unmarshal(w.Body.Bytes(), &actual)
+	s.Equal(http.StatusOK, w.Code)
+	s.Equal(
+		map[string]proxy.Maintenance{"service-1": {AllowedIPs: []string{"10.0.0.0/8"}, Body: "Be back soon"}},
+		actual.Maintenances,
+	)
+}
+
+// Init
+
+func (s *MaintenanceTestSuite) Test_Init_CopiesMaintenanceFromReplicasAndReconfiguresServices() {
+	proxy.SetMaintenance("service-2", &proxy.Maintenance{AllowedIPs: []string{}})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		js, _ := json.Marshal(MaintenanceResponse{Status: "OK", Maintenances: map[string]proxy.Maintenance{
+			"service-1":         {AllowedIPs: []string{"10.0.0.1"}},
+			"service-2":         {AllowedIPs: []string{}},
+			"not-yet-available": {AllowedIPs: []string{}, Body: "Be back soon"},
+		}})
+		w.Write(js)
+	}))
+	defer srv.Close()
+	addr, _ := url.Parse(srv.URL)
+	lookupHost = func(host string) ([]string, error) {
+		return []string{addr.Host}, nil
+	}
+
+	err := NewMaintenance(actions.BaseReconfigure{}).Init()
+
+	s.NoError(err)
+	actual, ok := proxy.GetMaintenance("service-1")
+	s.True(ok)
+	s.Equal([]string{"10.0.0.1"}, actual.AllowedIPs)
+	actual, ok = proxy.GetMaintenance("not-yet-available")
+	s.True(ok)
+	s.Equal("Be back soon", actual.Body)
+	s.Equal([]string{"service-1"}, s.reconfigured)
+	s.True(s.reloaded)
+}
+
+func (s *MaintenanceTestSuite) Test_Init_DoesNotReconfigure_WhenMaintenanceIsTheSame() {
+	proxy.SetMaintenance("service-1", &proxy.Maintenance{AllowedIPs: []string{"10.0.0.1"}})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		js, _ := json.Marshal(MaintenanceResponse{Status: "OK", Maintenances: map[string]proxy.Maintenance{
+			"service-1": {AllowedIPs: []string{"10.0.0.1"}},
+		}})
+		w.Write(js)
+	}))
+	defer srv.Close()
+	addr, _ := url.Parse(srv.URL)
+	lookupHost = func(host string) ([]string, error) {
+		return []string{addr.Host}, nil
+	}
+
+	err := NewMaintenance(actions.BaseReconfigure{}).Init()
+
+	s.NoError(err)
+	s.Empty(s.reconfigured)
+	s.False(s.reloaded)
+}
@@ -3,6 +3,8 @@ package server
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
@@ -17,6 +19,7 @@ import (
 type Server interface {
 	GetServicesFromEnvVars() *[]proxy.Service
 	GetServiceFromUrl(req *http.Request) *proxy.Service
+	MaintenanceHandler(w http.ResponseWriter, req *http.Request)
 	PingHandler(w http.ResponseWriter, req *http.Request)
 	ReconfigureHandler(w http.ResponseWriter, req *http.Request)
 	ReloadHandler(w http.ResponseWriter, req *http.Request)
@@ -157,7 +160,7 @@ func (m *serve) ReloadHandler(w http.ResponseWriter, req *http.Request) {
 			if len(listenerAddr) == 0 {
 				continue
 			}
-			fetch := actions.NewFetch(m.getBaseReconfigure())
+			fetch := actions.NewFetch(m.getBaseReconfigure(), m.listenerAddresses)
 			if err := fetch.ReloadClusterConfig(listenerAddr); err != nil {
 				errs = append(errs, err.Error())
 				logPrintf("Error: ReloadClusterConfig failed: %s", err.Error())
@@ -200,6 +203,10 @@ func (m *serve) RemoveHandler(w http.ResponseWriter, req *http.Request) {
 		response.Status = "NOK"
 		response.Message = "The serviceName query is mandatory"
 		header = http.StatusBadRequest
+	} else if !proxy.IsValidPathName(params.ServiceName) || !proxy.IsValidPathName(params.AclName) {
+		response.Status = "NOK"
+		response.Message = "The serviceName and aclName queries cannot contain / or .."
+		header = http.StatusBadRequest
 	} else if params.Distribute {
 		if status, err := sendDistributeRequests(req, m.port, m.serviceName); err != nil || status >= 300 {
 			response.Status = "NOK"
@@ -223,6 +230,86 @@ func (m *serve) RemoveHandler(w http.ResponseWriter, req *http.Request) {
 	w.Write(js)
 }
 
+// MaintenanceHandler puts the service specified through the `serviceName` query into maintenance or takes it out of it.
+// While in maintenance, the service responds with 503 to all clients except those listed in the `allowedIps` query.
+// The body of the request, if not empty, is returned to clients instead of the 503 error page.
+func (m *serve) MaintenanceHandler(w http.ResponseWriter, req *http.Request) {
+	params := new(maintenanceParams)
+	// The query is decoded directly so that the body is not consumed as a form
+	decoder.Decode(params, req.URL.Query())
+	header := http.StatusOK
+	response := Response{
+		Status:      "OK",
+		ServiceName: params.ServiceName,
+	}
+	if len(params.ServiceName) == 0 {
+		response.Status = "NOK"
+		response.Message = "The serviceName query is mandatory"
+		header = http.StatusBadRequest
+	} else if params.Distribute {
+		if status, err := sendDistributeRequests(req, m.port, m.serviceName); err != nil || status >= 300 {
+			response.Status = "NOK"
+			response.Message = fmt.Sprintf("Distribution request failed with status %d", status)
+			if err != nil {
+				response.Message = err.Error()
+			}
+			header = http.StatusInternalServerError
+		} else {
+			response.Message = distributed
+		}
+	} else if service, ok := proxy.Instance.GetServices()[params.ServiceName]; !ok {
+		response.Status = "NOK"
+		response.Message = fmt.Sprintf("Service %s is not configured", params.ServiceName)
+		header = http.StatusNotFound
+	} else if allowedIPs, err := getMaintenanceAllowedIPs(params.AllowedIPs); err != nil {
+		response.Status = "NOK"
+		response.Message = err.Error()
+		header = http.StatusBadRequest
+	} else {
+		if params.Enabled {
+			maintenance := proxy.Maintenance{AllowedIPs: allowedIPs}
+			if req.Body != nil {
+				body, _ := ioutil.ReadAll(req.Body)
+				req.Body.Close()
+				maintenance.Body = string(body)
+			}
+			proxy.SetMaintenance(params.ServiceName, &maintenance)
+			response.Message = "Maintenance enabled"
+		} else {
+			proxy.SetMaintenance(params.ServiceName, nil)
+			response.Message = "Maintenance disabled"
+		}
+		logPrintf("%s for the service %s", response.Message, params.ServiceName)
+		response.Service = service
+		action := actions.NewReconfigure(m.getBaseReconfigure(), service)
+		if err := action.Execute(true); err != nil {
+			response.Status = "NOK"
+			response.Message = err.Error()
+			header = http.StatusInternalServerError
+		}
+	}
+	httpWriterSetContentType(w, "application/json")
+	w.WriteHeader(header)
+	js, _ := json.Marshal(response)
+	w.Write(js)
+}
+
+// getMaintenanceAllowedIPs converts the comma separated list of IPs and CIDR blocks into a slice
+func getMaintenanceAllowedIPs(value string) ([]string, error) {
+	ips := []string{}
+	for _, ip := range strings.Split(value, ",") {
+		ip = strings.TrimSpace(ip)
+		if len(ip) == 0 {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(ip); err != nil && net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("%s is neither an IP nor a CIDR block", ip)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
 func (m *serve) GetServicesFromEnvVars() *[]proxy.Service {
 	services := []proxy.Service{}
 	s, err := m.getServiceFromEnvVars("DFP_SERVICE")
@@ -281,25 +368,36 @@ func (m *serve) getServiceFromEnvVars(prefix string) (proxy.Service, error) {
 	servicePathExclude := getSliceFromString(os.Getenv(prefix + "_SERVICE_PATH_EXCLUDE"))
 	verifyClientSsl, _ := strconv.ParseBool(os.Getenv(prefix + "_VERIFY_CLIENT_SSL"))
 	denyHTTP, _ := strconv.ParseBool(os.Getenv(prefix + "_DENY_HTTP"))
+	grpcHealthCheck, _ := strconv.ParseBool(os.Getenv(prefix + "_GRPC_HEALTH_CHECK"))
+	websocket, _ := strconv.ParseBool(os.Getenv(prefix + "_WEBSOCKET"))
+	sendProxy := os.Getenv(prefix + "_SEND_PROXY")
+	terminateSsl, _ := strconv.ParseBool(os.Getenv(prefix + "_TERMINATE_SSL"))
+	sslCert := getSliceFromString(os.Getenv(prefix + "_SSL_CERT"))
 	ignoreAuthorization, _ := strconv.ParseBool(os.Getenv(prefix + "_IGNORE_AUTHORIZATION"))
+	inspectDelay := os.Getenv(prefix + "_INSPECT_DELAY")
 	sslVerifyNone, _ := strconv.ParseBool(os.Getenv(prefix + "_SSL_VERIFY_NONE"))
+	backendProto := os.Getenv(prefix + "_BACKEND_PROTO")
 
 	if len(path) > 0 || len(port) > 0 {
 		sd = append(
 			sd,
 			proxy.ServiceDest{
 				AllowedMethods:                allowedMethods,
+				BackendProto:                  backendProto,
 				DeniedMethods:                 deniedMethods,
 				DenyHttp:                      denyHTTP,
+				GrpcHealthCheck:               grpcHealthCheck,
 				HttpsOnly:                     httpsOnly,
 				HttpsPort:                     httpsPort,
 				HttpsRedirectCode:             httpsRedirectCode,
 				IgnoreAuthorization:           ignoreAuthorization,
+				InspectDelay:                  inspectDelay,
 				OutboundHostname:              globalOutboundHostname,
 				PathType:                      pathType,
 				Port:                          port,
 				RedirectFromDomain:            redirectFromDomain,
 				ReqMode:                       reqMode,
+				SendProxy:                     sendProxy,
 				ReqPathSearchReplace:          reqPathSearchReplace,
 				ReqPathSearchReplaceFormatted: reqPathSearchReplaceFormatted,
 				ServiceDomain:                 domain,
@@ -307,10 +405,13 @@ func (m *serve) getServiceFromEnvVars(prefix string) (proxy.Service, error) {
 				ServicePathExclude:            servicePathExclude,
 				SrcPort:                       srcPort,
 				SrcHttpsPort:                  srcHttpsPort,
+				SslCert:                       sslCert,
 				SslVerifyNone:                 sslVerifyNone,
+				TerminateSsl:                  terminateSsl,
 				TimeoutServer:                 timeoutServer,
 				TimeoutTunnel:                 timeoutTunnel,
 				VerifyClientSsl:               verifyClientSsl,
+				Websocket:                     websocket,
 			},
 		)
 	}
@@ -340,7 +441,14 @@ func (m *serve) getServiceFromEnvVars(prefix string) (proxy.Service, error) {
 		servicePathExclude := getSliceFromString(os.Getenv(fmt.Sprintf("%s_SERVICE_PATH_EXCLUDE_%d", prefix, i)))
 		verifyClientSsl, _ := strconv.ParseBool(os.Getenv(fmt.Sprintf("%s_VERIFY_CLIENT_SSL_%d", prefix, i)))
 		denyHTTP, _ := strconv.ParseBool(os.Getenv(fmt.Sprintf("%s_DENY_HTTP_%d", prefix, i)))
+		grpcHealthCheck, _ := strconv.ParseBool(os.Getenv(fmt.Sprintf("%s_GRPC_HEALTH_CHECK_%d", prefix, i)))
+		websocket, _ := strconv.ParseBool(os.Getenv(fmt.Sprintf("%s_WEBSOCKET_%d", prefix, i)))
+		sendProxy := os.Getenv(fmt.Sprintf("%s_SEND_PROXY_%d", prefix, i))
+		terminateSsl, _ := strconv.ParseBool(os.Getenv(fmt.Sprintf("%s_TERMINATE_SSL_%d", prefix, i)))
+		sslCert := getSliceFromString(os.Getenv(fmt.Sprintf("%s_SSL_CERT_%d", prefix, i)))
 		ignoreAuthorization, _ := strconv.ParseBool(os.Getenv(fmt.Sprintf("%s_IGNORE_AUTHORIZATION_%d", prefix, i)))
+		inspectDelay := os.Getenv(fmt.Sprintf("%s_INSPECT_DELAY_%d", prefix, i))
+		backendProto := os.Getenv(fmt.Sprintf("%s_BACKEND_PROTO_%d", prefix, i))
 		if len(path) > 0 && len(port) > 0 {
 			outboundHostname := os.Getenv(fmt.Sprintf("%s_OUTBOUND_HOSTNAME_%d", prefix, i))
 			if len(outboundHostname) == 0 {
@@ -350,11 +458,14 @@ func (m *serve) getServiceFromEnvVars(prefix string) (proxy.Service, error) {
 				sd,
 				proxy.ServiceDest{
 					AllowedMethods:                allowedMethods,
+					BackendProto:                  backendProto,
 					DeniedMethods:                 deniedMethods,
 					DenyHttp:                      denyHTTP,
+					GrpcHealthCheck:               grpcHealthCheck,
 					HttpsOnly:                     httpsOnly,
 					HttpsRedirectCode:             httpsRedirectCode,
 					IgnoreAuthorization:           ignoreAuthorization,
+					InspectDelay:                  inspectDelay,
 					OutboundHostname:              outboundHostname,
 					Port:                          port,
 					RedirectFromDomain:            redirectFromDomain,
@@ -368,7 +479,11 @@ func (m *serve) getServiceFromEnvVars(prefix string) (proxy.Service, error) {
 					TimeoutServer:                 timeoutServer,
 					TimeoutTunnel:                 timeoutTunnel,
 					ReqMode:                       reqMode,
+					SendProxy:                     sendProxy,
+					SslCert:                       sslCert,
+					TerminateSsl:                  terminateSsl,
 					VerifyClientSsl:               verifyClientSsl,
+					Websocket:                     websocket,
 				},
 			)
 		} else {
@@ -525,6 +525,22 @@ func (s *ServerTestSuite) Test_RemoveHandler_ReturnsStatus400_WhenServiceNameIsN
 	respWriterMock.AssertCalled(s.T(), "WriteHeader", 400)
 }
 
+func (s *ServerTestSuite) Test_RemoveHandler_ReturnsStatus400_WhenAclNameContainsPathSeparators() {
+	newRemoveOrig := actions.NewRemove
+	defer func() { actions.NewRemove = newRemoveOrig }()
+	actions.NewRemove = func(serviceName, aclName, configsPath, templatesPath string, instanceName string) actions.Removable {
+		s.Fail("The service should not be removed")
+		return getRemoveMock("")
+	}
+	req, _ := http.NewRequest("GET", "/v1/docker-flow-proxy/remove?serviceName=my-service&aclName=../../..", nil)
+	respWriterMock := getResponseWriterMock()
+
+	srv := serve{}
+	srv.RemoveHandler(respWriterMock, req)
+
+	respWriterMock.AssertCalled(s.T(), "WriteHeader", 400)
+}
+
 func (s *ServerTestSuite) Test_RemoveHandler_InvokesRemoveExecute() {
 	mockObj := getRemoveMock("")
 	aclName := "my-acl"
@@ -572,6 +588,127 @@ func (s *ServerTestSuite) Test_RemoveHandler_WritesErrorHeader_WhenRemoveDistrib
 	respWriterMock.AssertCalled(s.T(), "WriteHeader", 500)
 }
 
+// MaintenanceHandler
+
+func (s *ServerTestSuite) Test_MaintenanceHandler_EnablesMaintenanceAndReconfigures() {
+	proxyOrig := proxy.Instance
+	defer func() {
+		proxy.Instance = proxyOrig
+		proxy.SetMaintenance("my-service", nil)
+	}()
+	proxyMock := getProxyMock("GetServices")
+	proxyMock.On("GetServices").Return(map[string]proxy.Service{"my-service": {ServiceName: "my-service"}})
+	proxy.Instance = proxyMock
+	var actualService proxy.Service
+	newReconfigureOrig := actions.NewReconfigure
+	defer func() { actions.NewReconfigure = newReconfigureOrig }()
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service) actions.Reconfigurable {
+		actualService = serviceData
+		return ReconfigureMock{
+			ExecuteMock: func(reloadAfter bool) error {
+				return nil
+			},
+		}
+	}
+	addr := "/v1/docker-flow-proxy/maintenance?serviceName=my-service&enabled=true&allowedIps=10.0.0.1,10.1.0.0/16"
+	req, _ := http.NewRequest("PUT", addr, strings.NewReader("<h1>Maintenance</h1>"))
+	rw := getResponseWriterMock()
+
+	srv := serve{}
+	srv.MaintenanceHandler(rw, req)
+
+	rw.AssertCalled(s.T(), "WriteHeader", 200)
+	s.Equal("my-service", actualService.ServiceName)
+	actual, ok := proxy.GetMaintenance("my-service")
+	s.True(ok)
+	s.Equal(proxy.Maintenance{AllowedIPs: []string{"10.0.0.1", "10.1.0.0/16"}, Body: "<h1>Maintenance</h1>"}, actual)
+}
+
+func (s *ServerTestSuite) Test_MaintenanceHandler_DisablesMaintenance() {
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxyMock := getProxyMock("GetServices")
+	proxyMock.On("GetServices").Return(map[string]proxy.Service{"my-service": {ServiceName: "my-service"}})
+	proxy.Instance = proxyMock
+	newReconfigureOrig := actions.NewReconfigure
+	defer func() { actions.NewReconfigure = newReconfigureOrig }()
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service) actions.Reconfigurable {
+		return ReconfigureMock{
+			ExecuteMock: func(reloadAfter bool) error {
+				return nil
+			},
+		}
+	}
+	proxy.SetMaintenance("my-service", &proxy.Maintenance{})
+	req, _ := http.NewRequest("PUT", "/v1/docker-flow-proxy/maintenance?serviceName=my-service&enabled=false", nil)
+	rw := getResponseWriterMock()
+
+	srv := serve{}
+	srv.MaintenanceHandler(rw, req)
+
+	rw.AssertCalled(s.T(), "WriteHeader", 200)
+	_, ok := proxy.GetMaintenance("my-service")
+	s.False(ok)
+}
+
+func (s *ServerTestSuite) Test_MaintenanceHandler_ReturnsStatus404_WhenServiceIsNotConfigured() {
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxy.Instance = getProxyMock("")
+	req, _ := http.NewRequest("PUT", "/v1/docker-flow-proxy/maintenance?serviceName=my-service&enabled=true", nil)
+	rw := getResponseWriterMock()
+
+	srv := serve{}
+	srv.MaintenanceHandler(rw, req)
+
+	rw.AssertCalled(s.T(), "WriteHeader", 404)
+	_, ok := proxy.GetMaintenance("my-service")
+	s.False(ok)
+}
+
+func (s *ServerTestSuite) Test_MaintenanceHandler_ReturnsStatus400_WhenAllowedIpsAreInvalid() {
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxyMock := getProxyMock("GetServices")
+	proxyMock.On("GetServices").Return(map[string]proxy.Service{"my-service": {ServiceName: "my-service"}})
+	proxy.Instance = proxyMock
+	req, _ := http.NewRequest("PUT", "/v1/docker-flow-proxy/maintenance?serviceName=my-service&enabled=true&allowedIps=my-laptop", nil)
+	rw := getResponseWriterMock()
+
+	srv := serve{}
+	srv.MaintenanceHandler(rw, req)
+
+	rw.AssertCalled(s.T(), "WriteHeader", 400)
+}
+
+func (s *ServerTestSuite) Test_MaintenanceHandler_ReturnsStatus400_WhenServiceNameIsNotPresent() {
+	req, _ := http.NewRequest("PUT", "/v1/docker-flow-proxy/maintenance?enabled=true", nil)
+	rw := getResponseWriterMock()
+
+	srv := serve{}
+	srv.MaintenanceHandler(rw, req)
+
+	rw.AssertCalled(s.T(), "WriteHeader", 400)
+}
+
+func (s *ServerTestSuite) Test_MaintenanceHandler_SendsDistributeRequests_WhenDistributeIsTrue() {
+	actualPort := ""
+	sendDistributeRequestsOrig := sendDistributeRequests
+	defer func() { sendDistributeRequests = sendDistributeRequestsOrig }()
+	sendDistributeRequests = func(req *http.Request, port, serviceName string) (status int, err error) {
+		actualPort = port
+		return http.StatusOK, nil
+	}
+	req, _ := http.NewRequest("PUT", "/v1/docker-flow-proxy/maintenance?serviceName=my-service&enabled=true&distribute=true", nil)
+	rw := getResponseWriterMock()
+
+	srv := serve{port: "1234"}
+	srv.MaintenanceHandler(rw, req)
+
+	rw.AssertCalled(s.T(), "WriteHeader", 200)
+	s.Equal("1234", actualPort)
+}
+
 // GetServiceFromUrl
 
 func (s *ServerTestSuite) Test_GetServiceFromUrl_ReturnsProxyService() {
@@ -613,6 +750,7 @@ func (s *ServerTestSuite) Test_GetServiceFromUrl_ReturnsProxyService() {
 			ServiceHeader:                 map[string]string{"X-Version": "3", "name": "Viktor"},
 			ServicePath:                   []string{"/"},
 			ServicePathExclude:            []string{"/excluded-path"},
+			SslCert:                       []string{},
 			SrcPort:                       8080,
 			SrcHttpsPort:                  4443,
 			SslVerifyNone:                 true,
@@ -753,6 +891,7 @@ func (s *ServerTestSuite) Test_GetServiceFromUrl_SetsServicePathToSlash_WhenDoma
 				ServiceHeader:                 map[string]string{},
 				ServicePath:                   []string{"/"},
 				ServicePathExclude:            []string{},
+				SslCert:                       []string{},
 				Index:                         0,
 			},
 		},
@@ -815,9 +954,13 @@ func (s *ServerTestSuite) Test_GetServicesFromEnvVars_ReturnsServices() {
 				DeniedMethods:                 []string{"OPTION", "TRACE"},
 				RedirectFromDomain:            []string{"proxy.dockerflow.com", "dockerflow.com"},
 				ServicePathExclude:            []string{"some-path", "some-path2"},
+				SslCert:                       []string{"my-cert.pem"},
+				TerminateSsl:                  true,
 				VerifyClientSsl:               true,
 				DenyHttp:                      true,
 				SslVerifyNone:                 true,
+				BackendProto:                  "h2",
+				InspectDelay:                  "10",
 				TimeoutServer:                 "my-TimeoutServer",
 				TimeoutTunnel:                 "my-TimeoutTunnel",
 			},
@@ -840,6 +983,7 @@ func (s *ServerTestSuite) Test_GetServicesFromEnvVars_ReturnsServices() {
 	os.Setenv("DFP_SERVICE_HTTPS_REDIRECT_CODE", service.ServiceDest[0].HttpsRedirectCode)
 	os.Setenv("DFP_SERVICE_HTTPS_PORT", strconv.Itoa(service.ServiceDest[0].HttpsPort))
 	os.Setenv("DFP_SERVICE_IGNORE_AUTHORIZATION", strconv.FormatBool(service.ServiceDest[0].IgnoreAuthorization))
+	os.Setenv("DFP_SERVICE_INSPECT_DELAY", service.ServiceDest[0].InspectDelay)
 	os.Setenv("DFP_SERVICE_IS_DEFAULT_BACKEND", strconv.FormatBool(service.IsDefaultBackend))
 	os.Setenv("DFP_SERVICE_OUTBOUND_HOSTNAME", service.ServiceDest[0].OutboundHostname)
 	os.Setenv("DFP_SERVICE_PATH_TYPE", service.ServiceDest[0].PathType)
@@ -853,7 +997,10 @@ func (s *ServerTestSuite) Test_GetServicesFromEnvVars_ReturnsServices() {
 	os.Setenv("DFP_SERVICE_SERVICE_DOMAIN_ALGO", service.ServiceDomainAlgo)
 	os.Setenv("DFP_SERVICE_SERVICE_NAME", service.ServiceName)
 	os.Setenv("DFP_SERVICE_SERVICE_PATH_EXCLUDE", strings.Join(service.ServiceDest[0].ServicePathExclude, ","))
+	os.Setenv("DFP_SERVICE_SSL_CERT", strings.Join(service.ServiceDest[0].SslCert, ","))
 	os.Setenv("DFP_SERVICE_SSL_VERIFY_NONE", strconv.FormatBool(service.ServiceDest[0].SslVerifyNone))
+	os.Setenv("DFP_SERVICE_TERMINATE_SSL", strconv.FormatBool(service.ServiceDest[0].TerminateSsl))
+	os.Setenv("DFP_SERVICE_BACKEND_PROTO", service.ServiceDest[0].BackendProto)
 	os.Setenv("DFP_SERVICE_TEMPLATE_BE_PATH", service.TemplateBePath)
 	os.Setenv("DFP_SERVICE_TEMPLATE_FE_PATH", service.TemplateFePath)
 	os.Setenv("DFP_SERVICE_TIMEOUT_SERVER", service.ServiceDest[0].TimeoutServer)
@@ -905,6 +1052,10 @@ func (s *ServerTestSuite) Test_GetServicesFromEnvVars_ReturnsServices() {
 		os.Unsetenv("DFP_SERVICE_SRC_PORT")
 		os.Unsetenv("DFP_SERVICE_SRC_HTTPS_PORT")
 		os.Unsetenv("DFP_SERVICE_SSL_VERIFY_NONE")
+		os.Unsetenv("DFP_SERVICE_INSPECT_DELAY")
+		os.Unsetenv("DFP_SERVICE_SSL_CERT")
+		os.Unsetenv("DFP_SERVICE_TERMINATE_SSL")
+		os.Unsetenv("DFP_SERVICE_BACKEND_PROTO")
 		os.Unsetenv("DFP_SERVICE_TEMPLATE_BE_PATH")
 		os.Unsetenv("DFP_SERVICE_TEMPLATE_FE_PATH")
 		os.Unsetenv("DFP_SERVICE_TIMEOUT_SERVER")
@@ -933,6 +1084,7 @@ func (s *ServerTestSuite) Test_GetServicesFromEnvVars_SetsServiceDomainAlgoToHdr
 				DeniedMethods:                 []string{},
 				RedirectFromDomain:            []string{},
 				ServicePathExclude:            []string{},
+				SslCert:                       []string{},
 			},
 		},
 		ServiceDomainAlgo: "hdr_dom(host)",
@@ -970,6 +1122,7 @@ func (s *ServerTestSuite) Test_GetServicesFromEnvVars_ReturnsServicesWithIndexed
 				DeniedMethods:                 []string{},
 				RedirectFromDomain:            []string{},
 				ServicePathExclude:            []string{},
+				SslCert:                       []string{},
 				SrcPort:                       1112,
 				SrcHttpsPort:                  4443,
 				HttpsOnly:                     true,
@@ -987,6 +1140,7 @@ func (s *ServerTestSuite) Test_GetServicesFromEnvVars_ReturnsServicesWithIndexed
 				DeniedMethods:                 []string{"OPTION", "TRACE"},
 				RedirectFromDomain:            []string{"proxy.dockerflow.com", "dockerflow.com"},
 				ServicePathExclude:            []string{"some-path", "some-path2"},
+				SslCert:                       []string{},
 				DenyHttp:                      true,
 				IgnoreAuthorization:           true,
 			},
@@ -1072,6 +1226,7 @@ func (s *ServerTestSuite) Test_GetServicesFromEnvVars_ReturnsMultipleServices()
 				DeniedMethods:                 []string{},
 				RedirectFromDomain:            []string{},
 				ServicePathExclude:            []string{},
+				SslCert:                       []string{},
 			},
 		},
 	}
@@ -1152,6 +1307,7 @@ type FetchMock struct {
 	ReloadServicesFromRegistryMock func(addresses []string, instanceName string) error
 	ReloadClusterConfigMock        func(listenerAddr string) error
 	ReloadConfigMock               func(baseData actions.BaseReconfigure, listenerAddr string) error
+	SubscribeConfigMock            func(baseData actions.BaseReconfigure, listenerAddrs []string, onSync func(), stop <-chan struct{}) error
 }
 
 func (m *FetchMock) ReloadServicesFromRegistry(addresses []string, instanceName string) error {
@@ -1163,9 +1319,12 @@ func (m FetchMock) ReloadClusterConfig(listenerAddr string) error {
 func (m FetchMock) ReloadConfig(baseData actions.BaseReconfigure, listenerAddr string) error {
 	return m.ReloadConfigMock(baseData, listenerAddr)
 }
+func (m FetchMock) SubscribeConfig(baseData actions.BaseReconfigure, listenerAddrs []string, onSync func(), stop <-chan struct{}) error {
+	return m.SubscribeConfigMock(baseData, listenerAddrs, onSync, stop)
+}
 func MockFetch(mock FetchMock) func() {
 	newFetchOrig := actions.NewFetch
-	actions.NewFetch = func(baseData actions.BaseReconfigure) actions.Fetchable {
+	actions.NewFetch = func(baseData actions.BaseReconfigure, listenerAddrs []string) actions.Fetchable {
 		return &mock
 	}
 	return func() {
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/docker-flow/docker-flow-proxy/proxy"
+	"github.com/gorilla/mux"
+)
+
+// Health verdicts of services, destinations, and backends
+const (
+	healthUp       = "UP"
+	healthDown     = "DOWN"
+	healthDegraded = "DEGRADED"
+	healthUnknown  = "UNKNOWN"
+)
+
+// Statuser defines the interface that must be implemented by any struct that reports the runtime status of services.
+type Statuser interface {
+	Get(w http.ResponseWriter, req *http.Request)
+}
+
+type status struct{}
+
+// NewStatus returns a new instance of the Statuser interface
+func NewStatus() Statuser {
+	return &status{}
+}
+
+// ServiceStatus combines the definition of a service with the live data of its backends
+type ServiceStatus struct {
+	Status       string
+	Message      string
+	ServiceName  string
+	Health       string
+	Service      proxy.Service
+	Destinations []DestinationStatus
+}
+
+// DestinationStatus contains the health of a service destination
+type DestinationStatus struct {
+	Index    int
+	Port     string
+	Health   string
+	Backends []BackendStatus
+}
+
+// BackendStatus contains the status of a backend and its servers as reported by HAProxy
+type BackendStatus struct {
+	Name    string
+	Status  string
+	Health  string
+	Servers []ServerStatus
+}
+
+// ServerStatus contains the status of a server as reported by HAProxy
+type ServerStatus struct {
+	Name             string
+	Address          string
+	Status           string
+	CheckStatus      string
+	CheckDescription string
+	CurrentSessions  int64
+	ConnectionErrors int64
+	ResponseErrors   int64
+	Retries          int64
+	Redispatches     int64
+	CheckFailures    int64
+}
+
+type runtimeStat map[string]string
+
+// Get writes the status of the service specified through the `name` path variable.
+// Live data is retrieved from the HAProxy runtime API through `show stat` and `show servers state` commands.
+func (m *status) Get(w http.ResponseWriter, req *http.Request) {
+	name := mux.Vars(req)["name"]
+	resp := ServiceStatus{Status: "OK", ServiceName: name, Health: healthUnknown}
+	httpWriterSetContentType(w, "application/json")
+	service, ok := proxy.Instance.GetServices()[name]
+	if !ok {
+		resp.Status = "NOK"
+		resp.Message = fmt.Sprintf("Service %s is not configured", name)
+		w.WriteHeader(http.StatusNotFound)
+		js, _ := json.Marshal(resp)
+		w.Write(js)
+		return
+	}
+	resp.Service = service
+	stats, addresses, err := m.getRuntimeData()
+	if err != nil {
+		logPrintf("Could not retrieve data from the runtime API: %s", err.Error())
+		resp.Message = fmt.Sprintf("Could not retrieve data from the runtime API: %s", err.Error())
+	}
+	healths := []string{}
+	for _, sd := range service.ServiceDest {
+		if len(sd.Port) == 0 {
+			continue
+		}
+		dest := DestinationStatus{Index: sd.Index, Port: sd.Port}
+		for _, backend := range proxy.GetBackendNames(service, sd) {
+			dest.Backends = append(dest.Backends, m.getBackendStatus(backend, stats, addresses))
+		}
+		destHealths := []string{}
+		for _, backend := range dest.Backends {
+			destHealths = append(destHealths, backend.Health)
+		}
+		dest.Health = aggregateHealth(destHealths)
+		healths = append(healths, dest.Health)
+		resp.Destinations = append(resp.Destinations, dest)
+	}
+	if err == nil {
+		resp.Health = aggregateHealth(healths)
+	}
+	js, _ := json.Marshal(resp)
+	w.WriteHeader(http.StatusOK)
+	w.Write(js)
+}
+
+// getRuntimeData returns rows of `show stat` and addresses of servers from `show servers state`.
+// Addresses are mapped by `<backend>/<server>` keys.
+func (m *status) getRuntimeData() ([]runtimeStat, map[string]string, error) {
+	out, err := proxy.RunRuntimeCommand("show stat")
+	if err != nil {
+		return nil, nil, err
+	}
+	stats, err := parseRuntimeStats(out)
+	if err != nil {
+		return nil, nil, err
+	}
+	addresses := map[string]string{}
+	// Servers state is available only since HAProxy 1.6. Addresses from `show stat` are used without it.
+	if out, err := proxy.RunRuntimeCommand("show servers state"); err == nil {
+		addresses = parseServersState(out)
+	}
+	return stats, addresses, nil
+}
+
+func (m *status) getBackendStatus(backend string, stats []runtimeStat, addresses map[string]string) BackendStatus {
+	status := BackendStatus{Name: backend, Health: healthUnknown, Servers: []ServerStatus{}}
+	healths := []string{}
+	for _, stat := range stats {
+		if stat["pxname"] != backend {
+			continue
+		}
+		switch stat["type"] {
+		case "1":
+			status.Status = stat["status"]
+		case "2":
+			server := ServerStatus{
+				Name:             stat["svname"],
+				Address:          stat["addr"],
+				Status:           stat["status"],
+				CheckStatus:      strings.TrimSpace(strings.TrimPrefix(stat["check_status"], "*")),
+				CheckDescription: stat["check_desc"],
+				CurrentSessions:  stat.getInt("scur"),
+				ConnectionErrors: stat.getInt("econ"),
+				ResponseErrors:   stat.getInt("eresp"),
+				Retries:          stat.getInt("wretr"),
+				Redispatches:     stat.getInt("wredis"),
+				CheckFailures:    stat.getInt("chkfail"),
+			}
+			if addr, ok := addresses[backend+"/"+server.Name]; ok {
+				server.Address = addr
+			}
+			status.Servers = append(status.Servers, server)
+			if isServerUp(server.Status) {
+				healths = append(healths, healthUp)
+			} else {
+				healths = append(healths, healthDown)
+			}
+		}
+	}
+	if len(healths) > 0 {
+		status.Health = aggregateHealth(healths)
+	}
+	return status
+}
+
+func (s runtimeStat) getInt(name string) int64 {
+	value, _ := strconv.ParseInt(s[name], 10, 64)
+	return value
+}
+
+// parseRuntimeStats converts the CSV output of `show stat` into rows with values mapped by column names
+func parseRuntimeStats(out string) ([]runtimeStat, error) {
+	reader := csv.NewReader(strings.NewReader(out))
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	if len(header) == 0 || !strings.HasPrefix(header[0], "#") {
+		return nil, fmt.Errorf("the output of show stat does not start with a header")
+	}
+	header[0] = strings.TrimSpace(strings.TrimPrefix(header[0], "#"))
+	stats := []runtimeStat{}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return stats, nil
+		} else if err != nil {
+			return nil, err
+		}
+		stat := runtimeStat{}
+		for i, value := range row {
+			if i < len(header) {
+				stat[header[i]] = value
+			}
+		}
+		stats = append(stats, stat)
+	}
+}
+
+// parseServersState returns addresses of servers from the output of `show servers state`
+func parseServersState(out string) map[string]string {
+	addresses := map[string]string{}
+	var header []string
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "#" {
+			header = fields[1:]
+			continue
+		}
+		if header == nil || len(fields) < len(header) {
+			continue
+		}
+		state := map[string]string{}
+		for i, name := range header {
+			state[name] = fields[i]
+		}
+		addr := state["srv_addr"]
+		if port, ok := state["srv_port"]; ok && port != "0" {
+			addr = fmt.Sprintf("%s:%s", addr, port)
+		}
+		addresses[state["be_name"]+"/"+state["srv_name"]] = addr
+	}
+	return addresses
+}
+
+// isServerUp returns true if HAProxy sends requests to the server.
+// Servers without health checks are considered up.
+func isServerUp(status string) bool {
+	return strings.HasPrefix(status, "UP") || status == "no check"
+}
+
+// aggregateHealth returns the common health or DEGRADED if healths differ
+func aggregateHealth(healths []string) string {
+	if len(healths) == 0 {
+		return healthUnknown
+	}
+	for _, health := range healths[1:] {
+		if health != healths[0] {
+			return healthDegraded
+		}
+	}
+	return healths[0]
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker-flow/docker-flow-proxy/proxy"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/suite"
+)
+
+const statusStatHeader = "# pxname,svname,qcur,qmax,scur,smax,slim,stot,bin,bout,dreq,dresp,ereq,econ,eresp,wretr,wredis,status,weight,act,bck,chkfail,chkdown,lastchg,downtime,qlimit,pid,iid,sid,throttle,lbtot,tracked,type,rate,rate_lim,rate_max,check_status,check_code,check_duration,hrsp_1xx,hrsp_2xx,hrsp_3xx,hrsp_4xx,hrsp_5xx,hrsp_other,hanafail,req_rate,req_rate_max,req_tot,cli_abrt,srv_abrt,comp_in,comp_out,comp_byp,comp_rsp,lastsess,last_chk,last_agt,qtime,ctime,rtime,ttime,agent_status,agent_code,agent_duration,check_desc,agent_desc,check_rise,check_fall,check_health,agent_rise,agent_fall,agent_health,addr,cookie,mode,algo,conn_rate,conn_rate_max,conn_tot,intercepted,dcon,dses,"
+
+type StatusTestSuite struct {
+	suite.Suite
+	commands    map[string]string
+	contentType string
+	restore     []func()
+}
+
+func TestStatusUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	suite.Run(t, new(StatusTestSuite))
+}
+
+func (s *StatusTestSuite) SetupTest() {
+	proxyOrig := proxy.Instance
+	runOrig := proxy.RunRuntimeCommand
+	setContentTypeOrig := httpWriterSetContentType
+	s.restore = []func(){func() {
+		proxy.Instance = proxyOrig
+		proxy.RunRuntimeCommand = runOrig
+		httpWriterSetContentType = setContentTypeOrig
+	}}
+	httpWriterSetContentType = func(w http.ResponseWriter, value string) {
+		s.contentType = value
+	}
+	proxyMock := getProxyMock("GetServices")
+	proxyMock.On("GetServices").Return(map[string]proxy.Service{
+		"go-demo": {
+			ServiceName: "go-demo",
+			ServiceDest: []proxy.ServiceDest{
+				{Port: "8080", Index: 0, ServicePath: []string{"/demo"}},
+				{Port: "8081", Index: 1, ServicePath: []string{"/admin"}},
+			},
+		},
+	})
+	proxy.Instance = proxyMock
+	s.commands = map[string]string{
+		"show stat": statusStatHeader + "\n" +
+			s.getStatRow("services", "FRONTEND", "0", "OPEN", "", "") +
+			s.getStatRow("go-demo-be8080_0", "go-demo-1", "2", "UP", "L7OK", "10.0.0.5:8080") +
+			s.getStatRow("go-demo-be8080_0", "go-demo-2", "2", "DOWN", "* L4CON", "10.0.0.6:8080") +
+			s.getStatRow("go-demo-be8080_0", "BACKEND", "1", "UP", "", "") +
+			s.getStatRow("go-demo-be8081_1", "go-demo", "2", "no check", "", "10.0.0.7:8081") +
+			s.getStatRow("go-demo-be8081_1", "BACKEND", "1", "UP", "", ""),
+		"show servers state": `1
+# be_id be_name srv_id srv_name srv_addr srv_op_state srv_admin_state srv_uweight srv_iweight srv_time_since_last_change srv_check_status srv_check_result srv_check_health srv_check_state srv_agent_state bk_f_forced_id srv_f_forced_id srv_fqdn srv_port
+3 go-demo-be8080_0 1 go-demo-1 10.0.1.5 2 0 1 1 20 6 3 4 6 0 0 0 - 8080
+3 go-demo-be8080_0 2 go-demo-2 10.0.1.6 0 0 1 1 20 6 3 4 6 0 0 0 - 8080
+`,
+	}
+	proxy.RunRuntimeCommand = func(cmd string) (string, error) {
+		out, ok := s.commands[cmd]
+		if !ok {
+			return "", fmt.Errorf("Unknown command %s", cmd)
+		}
+		return out, nil
+	}
+}
+
+func (s *StatusTestSuite) TearDownTest() {
+	for _, restore := range s.restore {
+		restore()
+	}
+}
+
+// Get
+
+func (s *StatusTestSuite) Test_Get_ReturnsServiceStatus() {
+	rw, actual := s.get("go-demo")
+
+	s.Equal(http.StatusOK, rw.Code)
+	s.Equal("application/json", s.contentType)
+	s.Equal("OK", actual.Status)
+	s.Equal("go-demo", actual.Service.ServiceName)
+	s.Equal(healthDegraded, actual.Health)
+	s.Len(actual.Destinations, 2)
+	s.Equal(healthDegraded, actual.Destinations[0].Health)
+	s.Equal(BackendStatus{
+		Name:   "go-demo-be8080_0",
+		Status: "UP",
+		Health: healthDegraded,
+		Servers: []ServerStatus{
+			{Name: "go-demo-1", Address: "10.0.1.5:8080", Status: "UP", CheckStatus: "L7OK", CurrentSessions: 3, ConnectionErrors: 1, ResponseErrors: 2, CheckFailures: 4},
+			{Name: "go-demo-2", Address: "10.0.1.6:8080", Status: "DOWN", CheckStatus: "L4CON", CurrentSessions: 3, ConnectionErrors: 1, ResponseErrors: 2, CheckFailures: 4},
+		},
+	}, actual.Destinations[0].Backends[0])
+	s.Equal(1, actual.Destinations[1].Index)
+	s.Equal(healthUp, actual.Destinations[1].Health)
+	s.Equal("10.0.0.7:8081", actual.Destinations[1].Backends[0].Servers[0].Address)
+}
+
+func (s *StatusTestSuite) Test_Get_ReturnsDefinition_WhenRuntimeApiIsNotAvailable() {
+	s.commands = map[string]string{}
+
+	rw, actual := s.get("go-demo")
+
+	s.Equal(http.StatusOK, rw.Code)
+	s.Equal(healthUnknown, actual.Health)
+	s.Contains(actual.Message, "Unknown command show stat")
+	s.Equal("go-demo", actual.Service.ServiceName)
+	s.Equal(healthUnknown, actual.Destinations[0].Health)
+}
+
+func (s *StatusTestSuite) Test_Get_UsesStatAddresses_WhenServersStateIsNotAvailable() {
+	delete(s.commands, "show servers state")
+
+	_, actual := s.get("go-demo")
+
+	s.Equal("10.0.0.5:8080", actual.Destinations[0].Backends[0].Servers[0].Address)
+}
+
+func (s *StatusTestSuite) Test_Get_ReturnsStatus404_WhenServiceIsNotConfigured() {
+	rw, actual := s.get("unknown")
+
+	s.Equal(http.StatusNotFound, rw.Code)
+	s.Equal("NOK", actual.Status)
+}
+
+// Util
+
+func (s *StatusTestSuite) get(name string) (*httptest.ResponseRecorder, ServiceStatus) {
+	req := httptest.NewRequest("GET", fmt.Sprintf("/v1/docker-flow-proxy/services/%s/status", name), nil)
+	req = mux.SetURLVars(req, map[string]string{"name": name})
+	rw := httptest.NewRecorder()
+	NewStatus().Get(rw, req)
+	actual := ServiceStatus{}
+	s.NoError(json.Unmarshal(rw.Body.Bytes(), &actual))
+	return rw, actual
+}
+
+func (s *StatusTestSuite) getStatRow(pxname, svname, typ, status, checkStatus, addr string) string {
+	values := map[int]string{0: pxname, 1: svname, 4: "3", 13: "1", 14: "2", 17: status, 21: "4", 32: typ, 36: checkStatus, 73: addr}
+	row := ""
+	for i := 0; i < 83; i++ {
+		row += values[i] + ","
+	}
+	return row + "\n"
+}
@@ -0,0 +1,299 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/docker-flow/docker-flow-proxy/actions"
+	"github.com/docker-flow/docker-flow-proxy/proxy"
+)
+
+var readTemplatesDir = ioutil.ReadDir
+var readTemplateFile = ioutil.ReadFile
+var writeTemplateFile = ioutil.WriteFile
+var mkdirTemplatesDir = os.MkdirAll
+
+const invalidTemplateType = "Query parameter type must be frontend or backend"
+
+var templateNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// Templater defines the interface that must be implemented by any struct that deals with custom templates.
+type Templater interface {
+	Put(w http.ResponseWriter, req *http.Request)
+	GetAll(w http.ResponseWriter, req *http.Request)
+	Init() error
+	Validate(w http.ResponseWriter, req *http.Request)
+}
+
+type templates struct {
+	BaseReconfigure  actions.BaseReconfigure
+	Dir              string
+	ProxyServiceName string
+	ServicePort      string
+}
+
+// Template contains a frontend or a backend template uploaded through the API
+type Template struct {
+	Name    string
+	Type    string
+	Content string
+}
+
+// TemplateResponse represent a response when a request for templates is made.
+type TemplateResponse struct {
+	Status    string
+	Message   string
+	Config    string     `json:",omitempty"`
+	Templates []Template `json:",omitempty"`
+}
+
+// NewTemplates returns an instance of the Templater interface with pre-populated variables.
+// Uploaded templates are stored in `dir` and services that use them are reconfigured with `baseData`.
+var NewTemplates = func(dir string, baseData actions.BaseReconfigure) Templater {
+	return &templates{
+		BaseReconfigure:  baseData,
+		Dir:              dir,
+		ProxyServiceName: os.Getenv("SERVICE_NAME"),
+		ServicePort:      "8080",
+	}
+}
+
+// GetAll returns all the uploaded templates.
+func (m *templates) GetAll(w http.ResponseWriter, req *http.Request) {
+	m.writeResponse(w, http.StatusOK, TemplateResponse{Status: "OK", Templates: m.getAll()})
+}
+
+// Put stores the template sent as the body of the request.
+// The `name` query parameter is the name services use to reference the template (`templateFeName` or `templateBeName`)
+// and the `type` query parameter defines whether it is a `frontend` or a `backend` template.
+// Services that use the template are reconfigured.
+// If the `distribute` query parameter is set to `true`, the request is sent to all the replicas of the proxy.
+func (m *templates) Put(w http.ResponseWriter, req *http.Request) {
+	distribute, _ := strconv.ParseBool(req.URL.Query().Get("distribute"))
+	if distribute {
+		_, port, err := net.SplitHostPort(req.URL.Host)
+		if err != nil {
+			port = m.ServicePort
+		}
+		status, err := sendDistributeRequests(req, port, m.ProxyServiceName)
+		if err == nil && status >= 300 {
+			err = fmt.Errorf("Distribution request failed with status %d", status)
+		}
+		if err != nil {
+			m.writeResponse(w, http.StatusBadRequest, TemplateResponse{Status: "NOK", Message: err.Error()})
+			return
+		}
+		m.writeResponse(w, http.StatusOK, TemplateResponse{Status: "OK", Message: distributed})
+		return
+	}
+	tmpl := Template{Name: req.URL.Query().Get("name"), Type: req.URL.Query().Get("type")}
+	if !templateNameRegexp.MatchString(tmpl.Name) {
+		msg := "Query parameter name is mandatory and can contain only letters, digits, dots, dashes, and underscores"
+		m.writeResponse(w, http.StatusBadRequest, TemplateResponse{Status: "NOK", Message: msg})
+		return
+	}
+	if !isValidTemplateType(tmpl.Type) {
+		m.writeResponse(w, http.StatusBadRequest, TemplateResponse{Status: "NOK", Message: invalidTemplateType})
+		return
+	}
+	content := []byte{}
+	if req.Body != nil {
+		defer req.Body.Close()
+		content, _ = ioutil.ReadAll(req.Body)
+	}
+	if len(content) == 0 {
+		m.writeResponse(w, http.StatusBadRequest, TemplateResponse{Status: "NOK", Message: "Body is empty"})
+		return
+	}
+	tmpl.Content = string(content)
+	sr := getSampleService(req)
+	proxy.FormatServiceForTemplates(sr)
+	if _, err := actions.ParseTemplate(tmpl.Name, tmpl.Content, sr); err != nil {
+		m.writeResponse(w, http.StatusBadRequest, TemplateResponse{Status: "NOK", Message: err.Error()})
+		return
+	}
+	if err := m.write(tmpl); err != nil {
+		m.writeResponse(w, http.StatusInternalServerError, TemplateResponse{Status: "NOK", Message: err.Error()})
+		return
+	}
+	if err := m.reconfigureServices(map[string]bool{tmpl.Name: true}); err != nil {
+		m.writeResponse(w, http.StatusInternalServerError, TemplateResponse{Status: "NOK", Message: err.Error()})
+		return
+	}
+	m.writeResponse(w, http.StatusOK, TemplateResponse{Status: "OK"})
+}
+
+// Init should be executed when the proxy starts.
+// It retrieves uploaded templates from the other proxy replicas and reconfigures the services that use those that changed.
+func (m *templates) Init() error {
+	dns := fmt.Sprintf("tasks.%s", m.ProxyServiceName)
+	ips, err := lookupHost(dns)
+	if err != nil {
+		return err
+	}
+	local := map[string]string{}
+	for _, tmpl := range m.getAll() {
+		local[m.getPath(tmpl)] = tmpl.Content
+	}
+	changed := map[string]bool{}
+	client := &http.Client{}
+	for _, ip := range filterNetworkIPs(ips) {
+		hostPort := ip
+		if !strings.Contains(ip, ":") {
+			hostPort = net.JoinHostPort(ip, m.ServicePort)
+		}
+		addr := fmt.Sprintf("http://%s/v1/docker-flow-proxy/templates", hostPort)
+		resp, err := client.Get(addr)
+		if err != nil {
+			continue
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		data := TemplateResponse{}
+		json.Unmarshal(body, &data)
+		for _, tmpl := range data.Templates {
+			if !templateNameRegexp.MatchString(tmpl.Name) ||
+				!isValidTemplateType(tmpl.Type) ||
+				local[m.getPath(tmpl)] == tmpl.Content {
+				continue
+			}
+			if err := m.write(tmpl); err != nil {
+				return err
+			}
+			local[m.getPath(tmpl)] = tmpl.Content
+			changed[tmpl.Name] = true
+		}
+	}
+	if len(changed) > 0 {
+		logPrintf("Updated templates from other replicas")
+		return m.reconfigureServices(changed)
+	}
+	return nil
+}
+
+// Validate executes the template sent as the body of the request with a sample service and returns the result.
+// The `type` query parameter defines whether the template is a `frontend` or a `backend` snippet.
+// Other query parameters are the same as those used with reconfigure requests and they override the sample service.
+func (m *templates) Validate(w http.ResponseWriter, req *http.Request) {
+	body := []byte{}
+	if req.Body != nil {
+		defer req.Body.Close()
+		body, _ = ioutil.ReadAll(req.Body)
+	}
+	kind := req.URL.Query().Get("type")
+	if !isValidTemplateType(kind) {
+		m.writeResponse(w, http.StatusBadRequest, TemplateResponse{Status: "NOK", Message: invalidTemplateType})
+		return
+	}
+	if len(body) == 0 {
+		m.writeResponse(w, http.StatusBadRequest, TemplateResponse{Status: "NOK", Message: "Body is empty"})
+		return
+	}
+	sr := getSampleService(req)
+	proxy.FormatServiceForTemplates(sr)
+	config, err := actions.ParseTemplate(fmt.Sprintf("%s template", kind), string(body), sr)
+	if err != nil {
+		m.writeResponse(w, http.StatusBadRequest, TemplateResponse{Status: "NOK", Message: err.Error()})
+		return
+	}
+	m.writeResponse(w, http.StatusOK, TemplateResponse{Status: "OK", Config: config})
+}
+
+// getSampleService returns the service defined through the request parameters.
+// The name and the port of the service are set to sample values if they are not specified.
+func getSampleService(req *http.Request) *proxy.Service {
+	provider := HttpRequestParameterProvider{Request: req}
+	sr := proxy.GetServiceFromProvider(&provider)
+	if len(sr.ServiceName) == 0 {
+		sr.ServiceName = "sample-service"
+	}
+	for i := range sr.ServiceDest {
+		if len(sr.ServiceDest[i].Port) == 0 {
+			sr.ServiceDest[i].Port = "8080"
+		}
+		if len(sr.ServiceDest[i].ServicePath) == 0 {
+			sr.ServiceDest[i].ServicePath = []string{"/"}
+		}
+	}
+	return sr
+}
+
+// reconfigureServices reconfigures all the services that use any of the templates and reloads the proxy
+func (m *templates) reconfigureServices(names map[string]bool) error {
+	reconfigured := false
+	for _, service := range proxy.Instance.GetServices() {
+		if !names[service.TemplateFeName] && !names[service.TemplateBeName] {
+			continue
+		}
+		if err := actions.NewReconfigure(m.BaseReconfigure, service).Execute(false); err != nil {
+			return err
+		}
+		reconfigured = true
+	}
+	if reconfigured {
+		return actions.NewReload().Execute(true)
+	}
+	return nil
+}
+
+func (m *templates) getAll() []Template {
+	all := []Template{}
+	files, err := readTemplatesDir(m.Dir)
+	if err != nil {
+		return all
+	}
+	for _, file := range files {
+		tmpl := Template{}
+		if strings.HasSuffix(file.Name(), "-fe.tmpl") {
+			tmpl.Name = strings.TrimSuffix(file.Name(), "-fe.tmpl")
+			tmpl.Type = "frontend"
+		} else if strings.HasSuffix(file.Name(), "-be.tmpl") {
+			tmpl.Name = strings.TrimSuffix(file.Name(), "-be.tmpl")
+			tmpl.Type = "backend"
+		} else {
+			continue
+		}
+		content, err := readTemplateFile(m.getPath(tmpl))
+		if err != nil {
+			continue
+		}
+		tmpl.Content = string(content)
+		all = append(all, tmpl)
+	}
+	return all
+}
+
+func (m *templates) write(tmpl Template) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := mkdirTemplatesDir(m.Dir, 0755); err != nil {
+		return err
+	}
+	return writeTemplateFile(m.getPath(tmpl), []byte(tmpl.Content), 0664)
+}
+
+func (m *templates) getPath(tmpl Template) string {
+	suffix := "be"
+	if tmpl.Type == "frontend" {
+		suffix = "fe"
+	}
+	return fmt.Sprintf("%s/%s-%s.tmpl", m.Dir, tmpl.Name, suffix)
+}
+
+func isValidTemplateType(kind string) bool {
+	return kind == "frontend" || kind == "backend"
+}
+
+func (m *templates) writeResponse(w http.ResponseWriter, status int, resp TemplateResponse) {
+	httpWriterSetContentType(w, "application/json")
+	w.WriteHeader(status)
+	js, _ := json.Marshal(resp)
+	w.Write(js)
+}
@@ -0,0 +1,345 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/docker-flow/docker-flow-proxy/actions"
+	"github.com/docker-flow/docker-flow-proxy/proxy"
+	"github.com/stretchr/testify/suite"
+)
+
+type TemplateTestSuite struct {
+	suite.Suite
+	dir          string
+	proxyMock    *ProxyMock
+	reconfigured []string
+	reloaded     bool
+	restore      func()
+}
+
+func TestTemplateUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	suite.Run(t, new(TemplateTestSuite))
+}
+
+func (s *TemplateTestSuite) SetupTest() {
+	setContentTypeOrig := httpWriterSetContentType
+	separatorOrig := os.Getenv("SEPARATOR")
+	proxyOrig := proxy.Instance
+	lookupHostOrig := lookupHost
+	filterOrig := filterNetworkIPs
+	newReconfigureOrig := actions.NewReconfigure
+	restoreReload := MockReload(ReloadMock{ExecuteMock: func(recreate bool) error {
+		s.reloaded = true
+		return nil
+	}})
+	s.dir, _ = ioutil.TempDir("", "dfp-templates-test")
+	s.restore = func() {
+		httpWriterSetContentType = setContentTypeOrig
+		os.Setenv("SEPARATOR", separatorOrig)
+		proxy.Instance = proxyOrig
+		lookupHost = lookupHostOrig
+		filterNetworkIPs = filterOrig
+		actions.NewReconfigure = newReconfigureOrig
+		restoreReload()
+		os.RemoveAll(s.dir)
+	}
+	os.Setenv("SEPARATOR", ",")
+	httpWriterSetContentType = func(w http.ResponseWriter, value string) {}
+	filterNetworkIPs = func(ips []string) []string { return ips }
+	s.reconfigured = []string{}
+	s.reloaded = false
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service) actions.Reconfigurable {
+		return ReconfigureMock{
+			ExecuteMock: func(reloadAfter bool) error {
+				s.reconfigured = append(s.reconfigured, serviceData.ServiceName)
+				return nil
+			},
+		}
+	}
+	s.proxyMock = getProxyMock("GetServices")
+	s.proxyMock.On("GetServices").Return(map[string]proxy.Service{
+		"service-1": {ServiceName: "service-1", TemplateFeName: "my-template"},
+		"service-2": {ServiceName: "service-2", TemplateBeName: "other-template"},
+	})
+	proxy.Instance = s.proxyMock
+}
+
+func (s *TemplateTestSuite) TearDownTest() {
+	s.restore()
+}
+
+// Put
+
+func (s *TemplateTestSuite) Test_Put_WritesTemplateAndReconfiguresServicesThatUseIt() {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(
+		"PUT",
+		"/v1/docker-flow-proxy/template?name=my-template&type=frontend",
+		strings.NewReader("acl url_{{.ServiceName}} path_beg /"),
+	)
+
+	NewTemplates(s.dir, actions.BaseReconfigure{}).Put(w, req)
+
+	content, _ := ioutil.ReadFile(s.dir + "/my-template-fe.tmpl")
+	s.Equal(http.StatusOK, w.Code)
+	s.Equal("acl url_{{.ServiceName}} path_beg /", string(content))
+	s.Equal([]string{"service-1"}, s.reconfigured)
+	s.True(s.reloaded)
+}
+
+func (s *TemplateTestSuite) Test_Put_DoesNotReload_WhenTemplateIsNotUsed() {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(
+		"PUT",
+		"/v1/docker-flow-proxy/template?name=unused&type=backend",
+		strings.NewReader("backend {{.ServiceName}}-be"),
+	)
+
+	NewTemplates(s.dir, actions.BaseReconfigure{}).Put(w, req)
+
+	_, err := os.Stat(s.dir + "/unused-be.tmpl")
+	s.Equal(http.StatusOK, w.Code)
+	s.NoError(err)
+	s.Empty(s.reconfigured)
+	s.False(s.reloaded)
+}
+
+func (s *TemplateTestSuite) Test_Put_ReturnsBadRequest_WhenParametersAreInvalid() {
+	for _, query := range []string{"type=frontend", "name=../../etc/passwd&type=frontend", "name=my-template&type=listen"} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(
+			"PUT",
+			"/v1/docker-flow-proxy/template?"+query,
+			strings.NewReader("acl url_{{.ServiceName}} path_beg /"),
+		)
+
+		NewTemplates(s.dir, actions.BaseReconfigure{}).Put(w, req)
+
+		s.Equal(http.StatusBadRequest, w.Code, query)
+	}
+	s.Empty(s.reconfigured)
+}
+
+func (s *TemplateTestSuite) Test_Put_ReturnsBadRequest_WhenTemplateCannotBeParsed() {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(
+		"PUT",
+		"/v1/docker-flow-proxy/template?name=my-template&type=frontend",
+		strings.NewReader("acl url_{{.ServiceName"),
+	)
+
+	NewTemplates(s.dir, actions.BaseReconfigure{}).Put(w, req)
+
+	actual := TemplateResponse{}
+	json.Unmarshal(w.Body.Bytes(), &actual)
+	s.Equal(http.StatusBadRequest, w.Code)
+	s.Contains(actual.Message, "my-template:1")
+	s.Empty(s.reconfigured)
+}
+
+func (s *TemplateTestSuite) Test_Put_ReturnsBadRequest_WhenTemplateCannotBeExecuted() {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(
+		"PUT",
+		"/v1/docker-flow-proxy/template?name=my-template&type=frontend",
+		strings.NewReader("acl url_{{.ServiceName}} path_beg {{.DoesNotExist}}"),
+	)
+
+	NewTemplates(s.dir, actions.BaseReconfigure{}).Put(w, req)
+
+	_, err := os.Stat(s.dir + "/my-template-fe.tmpl")
+	s.Equal(http.StatusBadRequest, w.Code)
+	s.Error(err)
+	s.Empty(s.reconfigured)
+}
+
+func (s *TemplateTestSuite) Test_Put_SendsDistributeRequests_WhenDistribute() {
+	var actualQuery, actualBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		actualQuery = r.URL.RawQuery
+		actualBody = string(body)
+	}))
+	defer srv.Close()
+	addr, _ := url.Parse(srv.URL)
+	lookupHost = func(host string) ([]string, error) {
+		return []string{addr.Hostname()}, nil
+	}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(
+		"PUT",
+		srv.URL+"/v1/docker-flow-proxy/template?name=my-template&type=frontend&distribute=true",
+		strings.NewReader("content"),
+	)
+
+	NewTemplates(s.dir, actions.BaseReconfigure{}).Put(w, req)
+
+	s.Equal(http.StatusOK, w.Code)
+	s.Contains(actualQuery, "distribute=false")
+	s.Equal("content", actualBody)
+	s.Empty(s.reconfigured)
+}
+
+// GetAll
+
+func (s *TemplateTestSuite) Test_GetAll_ReturnsUploadedTemplates() {
+	ioutil.WriteFile(s.dir+"/my-template-fe.tmpl", []byte("frontend content"), 0664)
+	ioutil.WriteFile(s.dir+"/my-template-be.tmpl", []byte("backend content"), 0664)
+	ioutil.WriteFile(s.dir+"/something-else", []byte("ignored"), 0664)
+	w := httptest.NewRecorder()
+
+	NewTemplates(s.dir, actions.BaseReconfigure{}).GetAll(w, httptest.NewRequest("GET", "/v1/docker-flow-proxy/templates", nil))
+
+	actual := TemplateResponse{}
+	json.Unmarshal(w.Body.Bytes(), &actual)
+	s.Equal(http.StatusOK, w.Code)
+	s.ElementsMatch([]Template{
+		{Name: "my-template", Type: "frontend", Content: "frontend content"},
+		{Name: "my-template", Type: "backend", Content: "backend content"},
+	}, actual.Templates)
+}
+
+// Init
+
+func (s *TemplateTestSuite) Test_Init_CopiesTemplatesFromReplicas() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		js, _ := json.Marshal(TemplateResponse{Status: "OK", Templates: []Template{
+			{Name: "other-template", Type: "backend", Content: "backend content"},
+		}})
+		w.Write(js)
+	}))
+	defer srv.Close()
+	addr, _ := url.Parse(srv.URL)
+	lookupHost = func(host string) ([]string, error) {
+		return []string{addr.Host}, nil
+	}
+
+	err := NewTemplates(s.dir, actions.BaseReconfigure{}).Init()
+
+	content, _ := ioutil.ReadFile(s.dir + "/other-template-be.tmpl")
+	s.NoError(err)
+	s.Equal("backend content", string(content))
+	s.Equal([]string{"service-2"}, s.reconfigured)
+	s.True(s.reloaded)
+}
+
+func (s *TemplateTestSuite) Test_Init_DoesNotReconfigure_WhenTemplatesAreTheSame() {
+	ioutil.WriteFile(s.dir+"/other-template-be.tmpl", []byte("backend content"), 0664)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		js, _ := json.Marshal(TemplateResponse{Status: "OK", Templates: []Template{
+			{Name: "other-template", Type: "backend", Content: "backend content"},
+		}})
+		w.Write(js)
+	}))
+	defer srv.Close()
+	addr, _ := url.Parse(srv.URL)
+	lookupHost = func(host string) ([]string, error) {
+		return []string{addr.Host}, nil
+	}
+
+	err := NewTemplates(s.dir, actions.BaseReconfigure{}).Init()
+
+	s.NoError(err)
+	s.Empty(s.reconfigured)
+	s.False(s.reloaded)
+}
+
+// Validate
+
+func (s *TemplateTestSuite) Test_Validate_ReturnsConfigOfSampleService() {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(
+		"POST",
+		"/v1/docker-flow-proxy/templates/validate?type=backend",
+		strings.NewReader("backend {{.AclName}}-be\n    server {{.ServiceName}} {{.ServiceName}}:{{(index .ServiceDest 0).Port}}"),
+	)
+
+	NewTemplates(s.dir, actions.BaseReconfigure{}).Validate(w, req)
+
+	actual := TemplateResponse{}
+	json.Unmarshal(w.Body.Bytes(), &actual)
+	s.Equal(http.StatusOK, w.Code)
+	s.Equal("OK", actual.Status)
+	s.Equal("backend sample-service-be\n    server sample-service sample-service:8080", actual.Config)
+}
+
+func (s *TemplateTestSuite) Test_Validate_UsesServiceFromQueryParameters() {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(
+		"POST",
+		"/v1/docker-flow-proxy/templates/validate?type=frontend&serviceName=go-demo&port=1234&servicePath=/demo",
+		strings.NewReader("acl url_{{.ServiceName}} path_beg{{range (index .ServiceDest 0).ServicePath}} {{.}}{{end}}"),
+	)
+
+	NewTemplates(s.dir, actions.BaseReconfigure{}).Validate(w, req)
+
+	actual := TemplateResponse{}
+	json.Unmarshal(w.Body.Bytes(), &actual)
+	s.Equal(http.StatusOK, w.Code)
+	s.Equal("acl url_go-demo path_beg /demo", actual.Config)
+}
+
+func (s *TemplateTestSuite) Test_Validate_ReturnsBadRequest_WhenTemplateCannotBeParsed() {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(
+		"POST",
+		"/v1/docker-flow-proxy/templates/validate?type=backend",
+		strings.NewReader("backend {{.ServiceName}}\n    server {{.ServiceName"),
+	)
+
+	NewTemplates(s.dir, actions.BaseReconfigure{}).Validate(w, req)
+
+	actual := TemplateResponse{}
+	json.Unmarshal(w.Body.Bytes(), &actual)
+	s.Equal(http.StatusBadRequest, w.Code)
+	s.Equal("NOK", actual.Status)
+	s.Contains(actual.Message, "backend template:2")
+}
+
+func (s *TemplateTestSuite) Test_Validate_ReturnsBadRequest_WhenTemplateUsesUnknownField() {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(
+		"POST",
+		"/v1/docker-flow-proxy/templates/validate?type=frontend",
+		strings.NewReader("acl {{.DoesNotExist}}"),
+	)
+
+	NewTemplates(s.dir, actions.BaseReconfigure{}).Validate(w, req)
+
+	actual := TemplateResponse{}
+	json.Unmarshal(w.Body.Bytes(), &actual)
+	s.Equal(http.StatusBadRequest, w.Code)
+	s.Contains(actual.Message, "DoesNotExist")
+}
+
+func (s *TemplateTestSuite) Test_Validate_ReturnsBadRequest_WhenTypeIsNotSupported() {
+	for _, kind := range []string{"", "listen"} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(
+			"POST",
+			"/v1/docker-flow-proxy/templates/validate?type="+kind,
+			strings.NewReader("backend {{.ServiceName}}"),
+		)
+
+		NewTemplates(s.dir, actions.BaseReconfigure{}).Validate(w, req)
+
+		s.Equal(http.StatusBadRequest, w.Code)
+	}
+}
+
+func (s *TemplateTestSuite) Test_Validate_ReturnsBadRequest_WhenBodyIsEmpty() {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/v1/docker-flow-proxy/templates/validate?type=backend", nil)
+
+	NewTemplates(s.dir, actions.BaseReconfigure{}).Validate(w, req)
+
+	s.Equal(http.StatusBadRequest, w.Code)
+}
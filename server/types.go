@@ -10,3 +10,10 @@ type removeParams struct {
 	Distribute  bool   `schema:"distribute"`
 	ServiceName string `schema:"serviceName"`
 }
+
+type maintenanceParams struct {
+	AllowedIPs  string `schema:"allowedIps"`
+	Distribute  bool   `schema:"distribute"`
+	Enabled     bool   `schema:"enabled"`
+	ServiceName string `schema:"serviceName"`
+}
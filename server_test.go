@@ -223,6 +223,38 @@ L:
 	}
 }
 
+func (s *ServerTestSuite) Test_Execute_SubscribesToListenerAddresses_WhenListenerSubscribeIsTrue() {
+	subscribeOrig := os.Getenv("LISTENER_SUBSCRIBE")
+	defer func() { os.Setenv("LISTENER_SUBSCRIBE", subscribeOrig) }()
+	os.Setenv("LISTENER_SUBSCRIBE", "true")
+	actualListenerAddressesChan := make(chan []string, 2)
+	defer MockFetch(FetchMock{
+		ReloadConfigMock: func(baseData actions.BaseReconfigure, listenerAddr string) error {
+			s.Fail("ReloadConfig should not be invoked")
+			return nil
+		},
+		SubscribeConfigMock: func(baseData actions.BaseReconfigure, listenerAddrs []string, onSync func(), stop <-chan struct{}) error {
+			actualListenerAddressesChan <- listenerAddrs
+			return nil
+		},
+	})()
+	serverImpl.ListenerAddresses = []string{"swarm-listener-1", "swarm-listener-2"}
+
+	serverImpl.Execute([]string{})
+
+	select {
+	case <-time.After(5 * time.Second):
+		s.FailNow("Time out")
+	case addrs := <-actualListenerAddressesChan:
+		s.Equal([]string{"http://swarm-listener-1:8080", "http://swarm-listener-2:8080"}, addrs)
+	}
+	select {
+	case <-actualListenerAddressesChan:
+		s.Fail("SubscribeConfig should be invoked only once")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
 func (s *ServerTestSuite) Test_Execute_RetriesContactingSwarmListenerAddress_WhenError() {
 	expectedListenerAddress := []string{"swarm-listener"}
 	actualListenerAddressChan := make(chan string)
@@ -410,6 +442,7 @@ func (m CertMock) Init() error {
 type ServerMock struct {
 	GetServicesFromEnvVarsMock func() *[]proxy.Service
 	GetServiceFromUrlMock      func(req *http.Request) *proxy.Service
+	MaintenanceHandlerMock     func(w http.ResponseWriter, req *http.Request)
 	PingHandlerMock            func(w http.ResponseWriter, req *http.Request)
 	ReconfigureHandlerMock     func(w http.ResponseWriter, req *http.Request)
 	ReloadHandlerMock          func(w http.ResponseWriter, req *http.Request)
@@ -442,6 +475,10 @@ func (m ServerMock) ReconfigureHandler(w http.ResponseWriter, req *http.Request)
 	m.ReconfigureHandlerMock(w, req)
 }
 
+func (m ServerMock) MaintenanceHandler(w http.ResponseWriter, req *http.Request) {
+	m.MaintenanceHandlerMock(w, req)
+}
+
 func (m ServerMock) PingHandler(w http.ResponseWriter, req *http.Request) {
 	m.PingHandlerMock(w, req)
 }
@@ -512,6 +549,7 @@ func (m ReloadMock) Execute(recreate bool) error {
 type FetchMock struct {
 	ReloadClusterConfigMock func(listenerAddr string) error
 	ReloadConfigMock        func(baseData actions.BaseReconfigure, listenerAddr string) error
+	SubscribeConfigMock     func(baseData actions.BaseReconfigure, listenerAddrs []string, onSync func(), stop <-chan struct{}) error
 }
 
 func (m FetchMock) ReloadClusterConfig(listenerAddr string) error {
@@ -520,9 +558,12 @@ func (m FetchMock) ReloadClusterConfig(listenerAddr string) error {
 func (m FetchMock) ReloadConfig(baseData actions.BaseReconfigure, listenerAddr string) error {
 	return m.ReloadConfigMock(baseData, listenerAddr)
 }
+func (m FetchMock) SubscribeConfig(baseData actions.BaseReconfigure, listenerAddrs []string, onSync func(), stop <-chan struct{}) error {
+	return m.SubscribeConfigMock(baseData, listenerAddrs, onSync, stop)
+}
 func MockFetch(mock FetchMock) func() {
 	newFetchOrig := actions.NewFetch
-	actions.NewFetch = func(baseData actions.BaseReconfigure) actions.Fetchable {
+	actions.NewFetch = func(baseData actions.BaseReconfigure, listenerAddrs []string) actions.Fetchable {
 		return &mock
 	}
 	return func() {